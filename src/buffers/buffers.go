@@ -2,13 +2,17 @@ package buffers
 
 import (
 	"bufio"
+	"bytes"
+	"compress/flate"
 	"container/list"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"math"
 	"os"
+	"sort"
 	"strings"
 	"sync"
 )
@@ -21,17 +25,27 @@ const DefaultTotalSizeLimit = 64 * MB
 
 const swapFileTemplate = "m_swap_*.tmp"
 
+// ErrFileChanged is returned, when lines indexed cannot be read back from the source file any more, i.e. the file
+// has been truncated or rewritten since it was read.
+var ErrFileChanged = errors.New("the file has changed since it was read")
+
 type dataBlock struct {
 	lines []string
 }
 
 type dataFrame struct {
-	offset    int64
-	firstLine int
-	noOfLines int
-	block     *dataBlock
+	offset     int64
+	size       int64
+	firstLine  int
+	noOfLines  int
+	fromSource bool // lines are read back from the source file, not from the swap file
+	block      *dataBlock
 }
 
+// LineFilter transforms a line read back from the source file, so it matches the line originally added.
+// A filter may keep a state (e.g. of a decoder), it is never called concurrently.
+type LineFilter func(line string) string
+
 type BufferedData struct {
 	maxTotalSize   int64
 	blockSizeLimit int
@@ -39,6 +53,9 @@ type BufferedData struct {
 	frames         []dataFrame
 	lruFrames      *list.List
 	swapFile       *os.File
+	sourceFile     *os.File
+	newLineFilter  func() LineFilter
+	compressSwap   bool
 	lastBlockSize  int
 }
 
@@ -128,16 +145,26 @@ func (i *LineIndex) IndexSetIfValid(index int) bool {
 }
 
 func (i *LineIndex) GetLine() (string, error) {
-	if frame, err := i.data.getFrame(i.frameIndex); err != nil {
-		return "", err
-	} else {
-		j := i.lineIndex - frame.firstLine
-		if j < 0 || j >= frame.noOfLines {
-			return "", errors.New(fmt.Sprintf("wrong line index (%d) in frame %d", j, i.frameIndex))
-		} else {
-			return frame.block.lines[j], nil
-		}
+	defer i.data.mutex.Unlock()
+	i.data.mutex.Lock()
+	return i.data.getLineLocked(i.frameIndex, i.lineIndex)
+}
+
+func (buff *BufferedData) Iterator() LineIterator {
+	return buff.NewLineIndexer()
+}
+
+func (buff *BufferedData) GetLine(index int) (string, error) {
+	defer buff.mutex.Unlock()
+	buff.mutex.Lock()
+	length := len(buff.frames)
+	frameIndex := sort.Search(length, func(i int) bool {
+		return buff.frames[i].firstLine+buff.frames[i].noOfLines > index
+	})
+	if index < 0 || frameIndex >= length {
+		return "", errors.New(fmt.Sprintf("wrong line index %d", index))
 	}
+	return buff.getLineLocked(frameIndex, index)
 }
 
 func NewBufferedData(blockSizeLimit int, totalSizeLimit int64) *BufferedData {
@@ -156,6 +183,9 @@ func NewBufferedData(blockSizeLimit int, totalSizeLimit int64) *BufferedData {
 		frames:         []dataFrame{},
 		lruFrames:      list.New(),
 		swapFile:       nil,
+		sourceFile:     nil,
+		newLineFilter:  nil,
+		compressSwap:   false,
 	}
 }
 
@@ -167,29 +197,111 @@ func NewBufferedDataDefault() *BufferedData {
 	return NewBufferedData(-1, -1)
 }
 
+// NewEmpty creates a new, empty buffer with the same limits.
+func (buff *BufferedData) NewEmpty() LineAppender {
+	return NewBufferedData(buff.blockSizeLimit, buff.maxTotalSize)
+}
+
+// SetSourceFile switches the (still empty) buffer to the offset index mode: frames keep only the offsets
+// of their first lines in the given, seekable file and are reloaded straight from it, instead of being
+// copied into the swap file. The buffer takes ownership of the file and closes it in Close().
+func (buff *BufferedData) SetSourceFile(file *os.File) error {
+	defer buff.mutex.Unlock()
+	buff.mutex.Lock()
+	if len(buff.frames) > 0 {
+		return errors.New("cannot set the source file of a non empty buffer")
+	}
+	if info, err := file.Stat(); err != nil {
+		return err
+	} else if !info.Mode().IsRegular() {
+		return errors.New(fmt.Sprintf("\"%s\" is not a regular file", file.Name()))
+	}
+	buff.sourceFile = file
+	return nil
+}
+
+// IsFileBacked tells whether frames are reloaded from the source file rather than from the swap file.
+func (buff *BufferedData) IsFileBacked() bool {
+	return buff.sourceFile != nil
+}
+
+// SetSwapCompression makes frames be compressed, each one on its own, when they are written into the swap file.
+// The frames table then serves as a random access checkpoint index of the (usually compressed) input:
+// an unloaded frame is restored by inflating just its own chunk of the swap file.
+func (buff *BufferedData) SetSwapCompression(compress bool) {
+	defer buff.mutex.Unlock()
+	buff.mutex.Lock()
+	buff.compressSwap = compress
+}
+
+// SetLineFilter sets the function making filters of lines read back from the source file. A filter is made for
+// every frame read, so frames read concurrently (e.g. by the search) do not share filters.
+func (buff *BufferedData) SetLineFilter(newFilter func() LineFilter) {
+	defer buff.mutex.Unlock()
+	buff.mutex.Lock()
+	buff.newLineFilter = newFilter
+}
+
 func (buff *BufferedData) AddLine(line string) {
+	if buff.sourceFile != nil {
+		panic("internal error: AddLine called for a file backed buffer, AddLineAt expected")
+	}
+	buff.addLine(line, -1)
+}
+
+// AddLineAt adds a line that starts at the given offset of the source file. A line with a negative offset is not
+// in the source file (e.g. it has been read from a file replacing it), it is kept in the swap file instead.
+func (buff *BufferedData) AddLineAt(line string, offset int64) {
+	if buff.sourceFile == nil {
+		offset = -1
+	}
+	buff.addLine(line, offset)
+}
+
+func (buff *BufferedData) addLine(line string, offset int64) {
 	defer buff.mutex.Unlock()
 	buff.mutex.Lock()
 	line = strings.TrimRight(line, " \t\r\n")
 	lineLength := len(line)
-	if len(buff.frames) == 0 || buff.lastBlockSize > 0 && buff.lastBlockSize+lineLength > buff.blockSizeLimit {
-		buff.frames = append(buff.frames, *newDataFrame(buff.Len()))
-		buff.lastBlockSize = 0
+	fromSource := offset >= 0
+	if l := len(buff.frames); l == 0 || buff.frames[l-1].fromSource != fromSource ||
+		buff.lastBlockSize > 0 && buff.lastBlockSize+lineLength > buff.blockSizeLimit {
+		buff.appendFrame(offset)
 	}
 	lastFrameIndex := len(buff.frames) - 1
 	lastFrame := &(buff.frames[lastFrameIndex])
-	buff.reloadFrame(lastFrame, lastFrameIndex)
+	if err := buff.reloadFrame(lastFrame, lastFrameIndex); err != nil {
+		// The last frame cannot be read back from the changed source file, the line starts a new frame
+		buff.appendFrame(offset)
+		lastFrameIndex++
+		lastFrame = &(buff.frames[lastFrameIndex])
+		buff.reloadFrame(lastFrame, lastFrameIndex)
+	}
 	lastFrame.block.lines = append(lastFrame.block.lines, line)
 	lastFrame.noOfLines += 1
 	buff.lastBlockSize += lineLength
 }
 
+// appendFrame starts a new, empty frame, whose first line is at the given offset of the source file (or not
+// in the source file at all, when the offset is negative).
+func (buff *BufferedData) appendFrame(offset int64) {
+	frame := newDataFrame(buff.Len())
+	frame.offset = offset
+	frame.fromSource = offset >= 0
+	buff.frames = append(buff.frames, *frame)
+	buff.lastBlockSize = 0
+}
+
 func (buff *BufferedData) Close() {
 	if buff.swapFile != nil {
 		buff.swapFile.Close()
 		os.Remove(buff.swapFile.Name())
 		buff.swapFile = nil
 	}
+	if buff.sourceFile != nil {
+		buff.sourceFile.Close()
+		buff.sourceFile = nil
+	}
 	buff.lruFrames = nil
 	for _, frame := range buff.frames {
 		frame.block = nil
@@ -197,6 +309,96 @@ func (buff *BufferedData) Close() {
 	buff.frames = nil
 }
 
+// FrameIndex is a copy of the frames table of a file backed buffer, which can be stored and restored later.
+type FrameIndex struct {
+	Frames        []FrameEntry
+	LastBlockSize int
+}
+
+type FrameEntry struct {
+	Offset    int64
+	FirstLine int
+	NoOfLines int
+}
+
+// Len returns the number of lines covered by the index.
+func (idx *FrameIndex) Len() int {
+	if l := len(idx.Frames); l > 0 {
+		return idx.Frames[l-1].FirstLine + idx.Frames[l-1].NoOfLines
+	}
+	return 0
+}
+
+// Truncate limits the index to the given number of lines.
+func (idx *FrameIndex) Truncate(noOfLines int) {
+	for l := len(idx.Frames); l > 0; l = len(idx.Frames) {
+		last := &idx.Frames[l-1]
+		if last.FirstLine >= noOfLines {
+			idx.Frames = idx.Frames[:l-1]
+		} else {
+			if last.FirstLine+last.NoOfLines > noOfLines {
+				last.NoOfLines = noOfLines - last.FirstLine
+			}
+			break
+		}
+	}
+}
+
+func (buff *BufferedData) ExportIndex() (*FrameIndex, error) {
+	defer buff.mutex.Unlock()
+	buff.mutex.Lock()
+	if buff.sourceFile == nil {
+		return nil, errors.New("only the index of a file backed buffer can be exported")
+	}
+	result := &FrameIndex{
+		Frames:        make([]FrameEntry, len(buff.frames)),
+		LastBlockSize: buff.lastBlockSize,
+	}
+	for i, frame := range buff.frames {
+		if !frame.fromSource {
+			return nil, errors.New("lines not read from the source file cannot be indexed")
+		}
+		result.Frames[i] = FrameEntry{
+			Offset:    frame.offset,
+			FirstLine: frame.firstLine,
+			NoOfLines: frame.noOfLines,
+		}
+	}
+	return result, nil
+}
+
+// ImportIndex restores the index exported earlier from a buffer backed by the same file;
+// lines appended to the file since then may be added with AddLineAt afterwards.
+func (buff *BufferedData) ImportIndex(index *FrameIndex) error {
+	defer buff.mutex.Unlock()
+	buff.mutex.Lock()
+	if buff.sourceFile == nil {
+		return errors.New("an index can be imported only into a file backed buffer")
+	}
+	if len(buff.frames) > 0 {
+		return errors.New("cannot import an index into a non empty buffer")
+	}
+	firstLine := 0
+	for _, entry := range index.Frames {
+		if entry.Offset < 0 || entry.FirstLine != firstLine || entry.NoOfLines <= 0 {
+			return errors.New(fmt.Sprintf("inconsistent index entry: %v", entry))
+		}
+		firstLine += entry.NoOfLines
+	}
+	buff.frames = make([]dataFrame, len(index.Frames))
+	for i, entry := range index.Frames {
+		buff.frames[i] = dataFrame{
+			offset:     entry.Offset,
+			firstLine:  entry.FirstLine,
+			noOfLines:  entry.NoOfLines,
+			fromSource: true,
+			block:      nil,
+		}
+	}
+	buff.lastBlockSize = index.LastBlockSize
+	return nil
+}
+
 func (f *dataFrame) isLineInFrame(lineIndex int) bool {
 	return lineIndex >= f.firstLine && lineIndex < f.firstLine+f.noOfLines
 }
@@ -213,6 +415,7 @@ func (buff *BufferedData) Len() int {
 func newDataFrame(firstLine int) *dataFrame {
 	return &dataFrame{
 		offset:    -1,
+		size:      0,
 		firstLine: firstLine,
 		noOfLines: 0,
 		block: &dataBlock{
@@ -221,16 +424,24 @@ func newDataFrame(firstLine int) *dataFrame {
 	}
 }
 
-func (buff *BufferedData) getFrame(frameIndex int) (*dataFrame, error) {
-	defer buff.mutex.Unlock()
-	buff.mutex.Lock()
+// getLineLocked returns the line of the frame, loading the frame if needed; the mutex has to be held. The line is
+// taken before the mutex is released, as the frame may be unloaded by another reader right afterwards.
+func (buff *BufferedData) getLineLocked(frameIndex int, lineIndex int) (string, error) {
 	length := len(buff.frames)
 	if frameIndex < 0 || frameIndex >= length {
-		return nil, errors.New(fmt.Sprintf("wrong index %d in getFrame()", frameIndex))
+		return "", errors.New(fmt.Sprintf("wrong index %d in getLineLocked()", frameIndex))
 	}
-	result := &(buff.frames[frameIndex])
-	buff.reloadFrame(result, frameIndex)
-	return result, nil
+	frame := &(buff.frames[frameIndex])
+	if err := buff.reloadFrame(frame, frameIndex); err != nil {
+		return "", err
+	}
+	j := lineIndex - frame.firstLine
+	if j < 0 || j >= frame.noOfLines {
+		return "", errors.New(fmt.Sprintf("wrong line index (%d) in frame %d", j, frameIndex))
+	} else if j >= len(frame.block.lines) {
+		return "", ErrFileChanged
+	}
+	return frame.block.lines[j], nil
 }
 
 func (buff *BufferedData) getWorkingFile() *os.File {
@@ -250,14 +461,24 @@ func (buff *BufferedData) unloadFrame(frame *dataFrame) {
 			f := buff.getWorkingFile()
 			offset, err := f.Seek(0, 2)
 			if err == nil {
-				var sb strings.Builder
+				var data bytes.Buffer
+				var w io.Writer = &data
+				var compressor *flate.Writer
+				if buff.compressSwap {
+					compressor, _ = flate.NewWriter(&data, flate.BestSpeed)
+					w = compressor
+				}
 				for _, line := range frame.block.lines {
-					sb.WriteString(line)
-					sb.WriteByte('\n')
+					io.WriteString(w, line)
+					io.WriteString(w, "\n")
+				}
+				if compressor != nil {
+					err = compressor.Close()
 				}
 				if err == nil {
-					_, err = f.WriteString(sb.String())
+					_, err = f.Write(data.Bytes())
 				}
+				frame.size = int64(data.Len())
 				if err == nil {
 					err = f.Sync()
 				}
@@ -271,41 +492,87 @@ func (buff *BufferedData) unloadFrame(frame *dataFrame) {
 	}
 }
 
-func (buff *BufferedData) loadFrame(frame *dataFrame) {
+// loadFrame reads lines of the frame back into memory; ErrFileChanged is returned, when the source file does not
+// have all of them any more.
+func (buff *BufferedData) loadFrame(frame *dataFrame) error {
 	if frame.block == nil {
-		f := buff.getWorkingFile()
+		var f *os.File
+		if frame.fromSource {
+			f = buff.sourceFile
+		} else {
+			f = buff.getWorkingFile()
+		}
 		if frame.offset < 0 {
 			panic("internal error: loadFrame for empty block and frame offset < 0")
 		}
-		if _, err := f.Seek(frame.offset, 0); err != nil {
-			panic(fmt.Sprintf("cannot seek in loadFrame(): %s", err.Error()))
+		lines, err := buff.readFrameLines(f, frame, buff.compressSwap && !frame.fromSource, buff.newLineFilter)
+		if err == ErrFileChanged {
+			return err
+		} else if err != nil {
+			log.Fatal(err)
 		}
 		frame.block = &dataBlock{
-			lines: []string{},
+			lines: lines,
 		}
-		reader := bufio.NewReader(f)
-		eof := false
-		for l := 0; l < frame.noOfLines && !eof; l++ {
-			line, err := reader.ReadString('\n')
-			if err != nil {
-				if err == io.EOF {
-					eof = true
-				} else {
-					log.Fatal(err)
-				}
+	}
+	return nil
+}
+
+// readFrameLines reads lines of the frame from the swap or the source file, without loading the frame.
+// It does not change the buffer, so it may be used concurrently. ErrFileChanged is returned, when there are less
+// lines than the frame has.
+func (buff *BufferedData) readFrameLines(f *os.File, frame *dataFrame, compressed bool,
+	newFilter func() LineFilter) ([]string, error) {
+	lines := make([]string, 0, frame.noOfLines)
+	var filter LineFilter
+	if newFilter != nil && frame.fromSource {
+		filter = newFilter()
+	}
+	// A section reader does not move the file position, which is still used by the file reading loop.
+	var reader *bufio.Reader
+	if compressed {
+		reader = bufio.NewReader(flate.NewReader(io.NewSectionReader(f, frame.offset, frame.size)))
+	} else {
+		reader = bufio.NewReader(io.NewSectionReader(f, frame.offset, math.MaxInt64-frame.offset))
+	}
+	eof := false
+	for l := 0; l < frame.noOfLines && !eof; l++ {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				eof = true
 			} else {
-				frame.block.lines = append(frame.block.lines, strings.TrimRight(line, "\n"))
+				return nil, err
 			}
 		}
+		if err == nil || eof && len(line) > 0 {
+			lines = append(lines, restoreLine(filter, line, frame.fromSource))
+		}
 	}
+	if len(lines) < frame.noOfLines {
+		return nil, ErrFileChanged
+	}
+	return lines, nil
+}
+
+func restoreLine(filter LineFilter, line string, fromSource bool) string {
+	if !fromSource {
+		return strings.TrimRight(line, "\n")
+	}
+	if filter != nil {
+		line = filter(line)
+	}
+	return strings.TrimRight(line, " \t\r\n")
 }
 
-func (buff *BufferedData) reloadFrame(frame *dataFrame, frameIndex int) {
+func (buff *BufferedData) reloadFrame(frame *dataFrame, frameIndex int) error {
 	if head := buff.lruFrames.Front(); head != nil && head.Value.(int) == frameIndex && frame.block != nil {
 		// No need to reload
-		return
+		return nil
+	}
+	if err := buff.loadFrame(frame); err != nil {
+		return err
 	}
-	buff.loadFrame(frame)
 	for e := buff.lruFrames.Front(); e != nil; e = e.Next() {
 		if e.Value == frameIndex {
 			buff.lruFrames.MoveToFront(e)
@@ -320,4 +587,5 @@ func (buff *BufferedData) reloadFrame(frame *dataFrame, frameIndex int) {
 		buff.unloadFrame(&(buff.frames[last.Value.(int)]))
 		buff.lruFrames.Remove(last)
 	}
+	return nil
 }
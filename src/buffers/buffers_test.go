@@ -2,12 +2,16 @@ package buffers
 
 import (
 	"bufio"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"path"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 const testdataDir = "../../testdata"
@@ -168,3 +172,452 @@ func TestIndexDecrement(t *testing.T) {
 		}
 	}
 }
+
+func TestSourceFile(t *testing.T) {
+	const noOfLines = 2000
+	tmp, err := ioutil.TempFile("", "m_test_*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmp.Name())
+	for l := 0; l < noOfLines; l++ {
+		fmt.Fprintf(tmp, "Line %d\tof the source file\r\n", l)
+	}
+	tmp.Close()
+
+	file, err := os.Open(tmp.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	buff := NewBufferedData(testBlockSize, testTotalSize)
+	defer buff.Close()
+	if err := buff.SetSourceFile(file); err != nil {
+		t.Fatal(err)
+	}
+	// Filters with a state, shared filters would be reported by the race detector when searching
+	buff.SetLineFilter(func() LineFilter {
+		filtered := 0
+		return func(line string) string {
+			filtered++
+			return strings.Replace(line, "Line", "LINE", 1)
+		}
+	})
+	reader := bufio.NewReader(file)
+	var offset int64 = 0
+	for line, err := reader.ReadString('\n'); err == nil; line, err = reader.ReadString('\n') {
+		buff.AddLineAt(strings.Replace(line, "Line", "LINE", 1), offset)
+		offset += int64(len(line))
+	}
+	if got := buff.Len(); got != noOfLines {
+		t.Errorf("BufferedData.Len ==> %d; want %d", got, noOfLines)
+	}
+	i := buff.NewLineIndexer()
+	for _, index := range []int{1999, 0, 1000, 5, 1500} {
+		i.IndexSet(index, false)
+		expected := fmt.Sprintf("LINE %d\tof the source file", index)
+		if got, err := i.GetLine(); err != nil {
+			t.Error(err)
+		} else if got != expected {
+			t.Errorf("BufferedData.GetLine ==> \"%s\"; want \"%s\"", got, expected)
+		}
+	}
+	found, err := Search(buff, &SearchRequest{From: 0, Workers: 4, Match: func(line string) [][]int {
+		if i := strings.Index(line, "LINE 1"); i >= 0 {
+			return [][]int{{i, i + 6}}
+		}
+		return nil
+	}})
+	if err != nil || len(found) != 1111 {
+		t.Errorf("Search(\"LINE 1\") ==> %d lines, %v; want 1111", len(found), err)
+	}
+	if buff.swapFile != nil {
+		t.Errorf("BufferedData.swapFile created for a file backed buffer")
+	}
+}
+
+func TestSourceFileTruncated(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "m_test_*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmp.Name())
+	for l := 0; l < 2000; l++ {
+		fmt.Fprintf(tmp, "Line %d of the source file\n", l)
+	}
+	tmp.Close()
+	file, err := os.Open(tmp.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	buff := NewBufferedData(testBlockSize, testTotalSize)
+	defer buff.Close()
+	if err := buff.SetSourceFile(file); err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(file)
+	var offset int64 = 0
+	for line, err := reader.ReadString('\n'); err == nil; line, err = reader.ReadString('\n') {
+		buff.AddLineAt(line, offset)
+		offset += int64(len(line))
+	}
+	// The file is truncated in place (like by logrotate copytruncate), the first frame has been unloaded already
+	if err := os.Truncate(tmp.Name(), 100); err != nil {
+		t.Fatal(err)
+	}
+	for _, index := range []int{0, 10} {
+		if _, err := buff.GetLine(index); err != ErrFileChanged {
+			t.Errorf("BufferedData.GetLine(%d) of a truncated file ==> %v; want %v", index, err, ErrFileChanged)
+		}
+	}
+	if _, err := Search(buff, &SearchRequest{Match: func(line string) [][]int { return nil }}); err != ErrFileChanged {
+		t.Errorf("Search() of a truncated file ==> %v; want %v", err, ErrFileChanged)
+	}
+	buff.AddLineAt("Line 2000 of the source file\n", offset)
+	if got, err := buff.GetLine(2000); err != nil || got != "Line 2000 of the source file" {
+		t.Errorf("BufferedData.GetLine(2000) of a truncated file ==> \"%s\", %v; want the line added", got, err)
+	}
+}
+
+func TestLinesNotInSourceFile(t *testing.T) {
+	tmp, err := ioutil.TempFile("", "m_test_*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmp.Name())
+	for l := 0; l < 1000; l++ {
+		fmt.Fprintf(tmp, "Line %d of the source file\n", l)
+	}
+	tmp.Close()
+	file, err := os.Open(tmp.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	buff := NewBufferedData(testBlockSize, testTotalSize)
+	defer buff.Close()
+	if err := buff.SetSourceFile(file); err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(file)
+	var offset int64 = 0
+	for line, err := reader.ReadString('\n'); err == nil; line, err = reader.ReadString('\n') {
+		buff.AddLineAt(line, offset)
+		offset += int64(len(line))
+	}
+	// Lines of a file replacing the source file (e.g. by the log rotation) are kept in the swap file
+	for l := 0; l < 1000; l++ {
+		buff.AddLineAt(fmt.Sprintf("Line %d of the new file", l), -1)
+	}
+	for _, index := range []int{0, 999, 1000, 1500, 1999, 10} {
+		want := fmt.Sprintf("Line %d of the source file", index)
+		if index >= 1000 {
+			want = fmt.Sprintf("Line %d of the new file", index-1000)
+		}
+		if got, err := buff.GetLine(index); err != nil || got != want {
+			t.Errorf("BufferedData.GetLine(%d) ==> \"%s\", %v; want \"%s\"", index, got, err, want)
+		}
+	}
+	found, err := Search(buff, &SearchRequest{Match: func(line string) [][]int {
+		if strings.HasPrefix(line, "Line 500 ") {
+			return [][]int{{0, 4}}
+		}
+		return nil
+	}})
+	if err != nil || len(found) != 2 || found[0].Line != 500 || found[1].Line != 1500 {
+		t.Errorf("Search() of lines in the source and in the swap file ==> %v, %v; want lines 500 and 1500", found, err)
+	}
+	if _, err := buff.ExportIndex(); err == nil {
+		t.Errorf("BufferedData.ExportIndex() ==> no error for lines not in the source file")
+	}
+}
+
+func TestBufferedDataGetLine(t *testing.T) {
+	i := theBuffer.NewLineIndexer()
+	for _, index := range []int{0, 10, 1775, 5016, 10750, theBuffer.Len() - 1} {
+		i.IndexSet(index, false)
+		expected, _ := i.GetLine()
+		if got, err := theBuffer.GetLine(index); err != nil {
+			t.Error(err)
+		} else if got != expected {
+			t.Errorf("BufferedData.GetLine(%d) ==> \"%s\"; want \"%s\"", index, got, expected)
+		}
+	}
+	if _, err := theBuffer.GetLine(theBuffer.Len()); err == nil {
+		t.Errorf("BufferedData.GetLine(%d) ==> no error for the line out of range", theBuffer.Len())
+	}
+}
+
+func TestConcurrentGetLine(t *testing.T) {
+	buff := NewBufferedData(testBlockSize, testTotalSize)
+	defer buff.Close()
+	for l := 0; l < 3000; l++ {
+		buff.AddLine(fmt.Sprintf("line %d of the concurrency test\n", l))
+	}
+	// Readers of distant lines unload frames read by other readers at the same time
+	errs := make(chan error, 4)
+	for r := 0; r < cap(errs); r++ {
+		go func(r int) {
+			for k := 0; k < 500; k++ {
+				index := (k*797 + r*1009) % buff.Len()
+				want := fmt.Sprintf("line %d of the concurrency test", index)
+				if got, err := buff.GetLine(index); err != nil || got != want {
+					errs <- fmt.Errorf("BufferedData.GetLine(%d) ==> \"%s\", %v; want \"%s\"", index, got, err, want)
+					return
+				}
+			}
+			errs <- nil
+		}(r)
+	}
+	for r := 0; r < cap(errs); r++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestMemoryData(t *testing.T) {
+	var store LineStore = NewMemoryData()
+	lines := []string{"first line  \r\n", "\tsecond line\n", "", "last line"}
+	for _, line := range lines {
+		store.(LineAppender).AddLine(line)
+	}
+	defer store.Close()
+	if got := store.Len(); got != len(lines) {
+		t.Errorf("MemoryData.Len ==> %d; want %d", got, len(lines))
+	}
+	expected := []string{"first line", "\tsecond line", "", "last line"}
+	got := []string{}
+	for i := store.Iterator(); i.IndexOK(); i.IndexIncrement() {
+		if line, err := i.GetLine(); err != nil {
+			t.Error(err)
+		} else {
+			got = append(got, line)
+		}
+	}
+	if strings.Join(got, "|") != strings.Join(expected, "|") {
+		t.Errorf("MemoryData.Iterator ==> \"%s\"; want \"%s\"", strings.Join(got, "|"), strings.Join(expected, "|"))
+	}
+	i := store.Iterator()
+	if i.IndexSetIfValid(len(lines)) || i.Index() != 0 {
+		t.Errorf("StoreIterator.IndexSetIfValid accepted the index out of range")
+	}
+}
+
+func TestFilteredData(t *testing.T) {
+	source := NewMemoryData()
+	for _, line := range []string{"zero", "one", "two", "three", "four", "five"} {
+		source.AddLine(line)
+	}
+	store := NewFilteredData(source)
+	for _, index := range []int{1, 3, 4} {
+		store.AddIndex(index)
+	}
+	defer store.Close()
+	if got := store.Len(); got != 3 {
+		t.Errorf("FilteredData.Len ==> %d; want %d", got, 3)
+	}
+	got := []string{}
+	for i := store.Iterator(); i.IndexOK(); i.IndexIncrement() {
+		if line, err := i.GetLine(); err != nil {
+			t.Error(err)
+		} else {
+			got = append(got, line)
+		}
+	}
+	if strings.Join(got, "|") != "one|three|four" {
+		t.Errorf("FilteredData.Iterator ==> \"%s\"; want \"%s\"", strings.Join(got, "|"), "one|three|four")
+	}
+	if _, err := store.GetLine(3); err == nil {
+		t.Errorf("FilteredData.GetLine accepted the index out of range")
+	}
+	values := []struct {
+		Index       int
+		SourceIndex int
+	}{
+		{0, 1}, {2, 4}, {3, -1}, {-1, -1},
+	}
+	for _, v := range values {
+		if got := store.SourceIndex(v.Index); got != v.SourceIndex {
+			t.Errorf("FilteredData.SourceIndex(%d) ==> %d; want %d", v.Index, got, v.SourceIndex)
+		}
+	}
+	for sourceIndex, want := range []int{0, 0, 1, 1, 2, 3} {
+		if got := store.IndexOf(sourceIndex); got != want {
+			t.Errorf("FilteredData.IndexOf(%d) ==> %d; want %d", sourceIndex, got, want)
+		}
+	}
+}
+
+func TestFrameIndexTruncate(t *testing.T) {
+	values := []struct {
+		Lines          int
+		ExpectedFrames int
+	}{
+		{25, 3},
+		{20, 2},
+		{11, 2},
+		{10, 1},
+		{0, 0},
+	}
+	for _, v := range values {
+		index := &FrameIndex{
+			Frames: []FrameEntry{{0, 0, 10}, {100, 10, 10}, {200, 20, 10}},
+		}
+		index.Truncate(v.Lines)
+		if got := len(index.Frames); got != v.ExpectedFrames || index.Len() != v.Lines {
+			t.Errorf("FrameIndex.Truncate(%d) => %d frames, %d lines; want %d, %d",
+				v.Lines, got, index.Len(), v.ExpectedFrames, v.Lines)
+		}
+	}
+}
+
+func TestSwapCompression(t *testing.T) {
+	buff := NewBufferedData(testBlockSize, testTotalSize)
+	defer buff.Close()
+	buff.SetSwapCompression(true)
+	i := theBuffer.NewLineIndexer()
+	for ok := i.IndexBegin(); ok; ok = i.IndexIncrement() {
+		line, _ := i.GetLine()
+		buff.AddLine(line)
+	}
+	for _, index := range []int{10, 10750, 45, 5016, 0} {
+		expected, _ := theBuffer.GetLine(index)
+		if got, err := buff.GetLine(index); err != nil {
+			t.Error(err)
+		} else if got != expected {
+			t.Errorf("BufferedData.GetLine(%d) ==> \"%s\"; want \"%s\"", index, got, expected)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	buff := NewBufferedData(testBlockSize, testTotalSize)
+	defer buff.Close()
+	memory := NewMemoryData()
+	lines := make([]string, 3000)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %d of the search test", i)
+		buff.AddLine(lines[i] + "\n")
+		memory.AddLine(lines[i] + "\n")
+	}
+	match := func(line string) [][]int {
+		if i := strings.Index(line, "7 of"); i >= 0 {
+			return [][]int{{i, i + 4}}
+		}
+		return nil
+	}
+	expected := func(from int, backward bool, limit int) []int {
+		result := make([]int, 0)
+		for i := from; i >= 0 && i < len(lines) && (limit == 0 || len(result) < limit); {
+			if match(lines[i]) != nil {
+				result = append(result, i)
+			}
+			if backward {
+				i--
+			} else {
+				i++
+			}
+		}
+		return result
+	}
+	lruBefore := make([]int, 0)
+	for e := buff.lruFrames.Front(); e != nil; e = e.Next() {
+		lruBefore = append(lruBefore, e.Value.(int))
+	}
+	values := []struct {
+		From     int
+		Backward bool
+		Limit    int
+	}{
+		{0, false, 0},
+		{1234, false, 0},
+		{1234, false, 1},
+		{2999, true, 0},
+		{1500, true, 3},
+		{2998, false, 5},
+	}
+	for _, store := range []LineStore{buff, memory} {
+		for _, v := range values {
+			found, err := Search(store, &SearchRequest{From: v.From, Backward: v.Backward, Limit: v.Limit, Match: match})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]int, len(found))
+			for i, f := range found {
+				got[i] = f.Line
+			}
+			if want := expected(v.From, v.Backward, v.Limit); fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("Search(%T, %d, %v, %d) ==> %v; want %v", store, v.From, v.Backward, v.Limit, got, want)
+			}
+		}
+	}
+	collected := 0
+	found, err := Search(memory, &SearchRequest{Match: match, Collect: func(found []LineMatch) {
+		collected += len(found)
+	}})
+	if want := len(expected(0, false, 0)); err != nil || len(found) != 0 || collected != want {
+		t.Errorf("Search(collected) ==> %d lines returned, %d collected, %v; want 0, %d", len(found), collected, err, want)
+	}
+	lruAfter := make([]int, 0)
+	for e := buff.lruFrames.Front(); e != nil; e = e.Next() {
+		lruAfter = append(lruAfter, e.Value.(int))
+	}
+	if fmt.Sprint(lruAfter) != fmt.Sprint(lruBefore) {
+		t.Errorf("BufferedData.Search() changed frames in memory ==> %v; want %v", lruAfter, lruBefore)
+	}
+
+	cancel := make(chan struct{})
+	close(cancel)
+	if _, err := Search(buff, &SearchRequest{Match: match, Cancel: cancel, Workers: 1}); err != ErrSearchCancelled {
+		t.Errorf("Search(cancelled) ==> %v; want %v", err, ErrSearchCancelled)
+	}
+
+	// The search cancelled while a chunk is searched stops within the chunk
+	cancel = make(chan struct{})
+	matched := 0
+	cancelling := func(line string) [][]int {
+		if matched++; matched == 10 {
+			close(cancel)
+		}
+		return nil
+	}
+	if _, err := Search(memory, &SearchRequest{Match: cancelling, Cancel: cancel, Workers: 1}); err != ErrSearchCancelled ||
+		matched != 10 {
+		t.Errorf("Search(cancelled in a chunk) ==> %v after %d lines; want %v after 10 lines", err, matched,
+			ErrSearchCancelled)
+	}
+}
+
+func TestSearchChunksInFlight(t *testing.T) {
+	const workers = 4
+	var read int32
+	chunks := make([]searchChunk, 100)
+	for i := range chunks {
+		chunks[i] = searchChunk{
+			firstLine: i,
+			noOfLines: 1,
+			read: func() ([]string, error) {
+				atomic.AddInt32(&read, 1)
+				return []string{"Litwo!"}, nil
+			},
+		}
+	}
+	inFlight := int32(0)
+	request := &SearchRequest{
+		Workers: workers,
+		Limit:   1,
+		Match: func(line string) [][]int {
+			return [][]int{{0, 1}}
+		},
+		Collect: func(found []LineMatch) {
+			// Workers would read all the chunks by now, if they were not waiting for the merge
+			time.Sleep(100 * time.Millisecond)
+			inFlight = atomic.LoadInt32(&read)
+		},
+	}
+	if _, err := runSearch(chunks, request); err != nil {
+		t.Fatal(err)
+	}
+	if inFlight > 2*workers+1 {
+		t.Errorf("runSearch() ==> %d chunks read before the first one merged; want at most %d", inFlight, 2*workers+1)
+	}
+}
@@ -0,0 +1,255 @@
+package buffers
+
+import (
+	"errors"
+	"os"
+	"runtime"
+)
+
+// searchChunkLines is the number of lines searched at once by a single worker, in stores without frames.
+const searchChunkLines = 1024
+
+var ErrSearchCancelled = errors.New("search cancelled")
+
+// SearchFunc returns byte offsets of the start and the end of occurrences found in the line,
+// like regexp.Regexp.FindAllStringIndex does.
+type SearchFunc func(line string) [][]int
+
+// SearchRequest describes lines to be searched and how.
+type SearchRequest struct {
+	From     int                       // the line the search starts with
+	Backward bool                      // lines are searched from the From line back to the first one
+	Limit    int                       // the search stops after so many lines with occurrences found, 0 for no limit
+	Workers  int                       // the number of lines searching goroutines, the number of CPUs when 0
+	Match    SearchFunc                // finds occurrences in a line
+	Cancel   <-chan struct{}           // closed, when the search has to be stopped
+	Progress func(done int, total int) // reports the number of lines searched so far, may be nil
+	Collect  func(found []LineMatch)   // receives lines found as the search goes, in its order, they are not returned
+}
+
+// LineMatch is a line with occurrences found in it.
+type LineMatch struct {
+	Line  int
+	Text  string
+	Found [][]int
+}
+
+// SearchableStore is a LineStore able to search its lines on its own, more efficiently than line by line.
+type SearchableStore interface {
+	Search(request *SearchRequest) ([]LineMatch, error)
+}
+
+// Search looks for lines with occurrences in the store, using concurrent workers. Lines found are returned
+// in the order of the search, i.e. descending for a backward search, unless they are passed to Collect. ErrSearchCancelled is returned, when
+// the search has been cancelled.
+func Search(store LineStore, request *SearchRequest) ([]LineMatch, error) {
+	if searchable, ok := store.(SearchableStore); ok {
+		return searchable.Search(request)
+	}
+	chunks := make([]searchChunk, 0)
+	for first := 0; first < store.Len(); first += searchChunkLines {
+		first := first
+		count := searchChunkLines
+		if first+count > store.Len() {
+			count = store.Len() - first
+		}
+		chunks = append(chunks, searchChunk{
+			firstLine: first,
+			noOfLines: count,
+			read: func() ([]string, error) {
+				lines := make([]string, count)
+				for i := range lines {
+					line, err := store.GetLine(first + i)
+					if err != nil {
+						return nil, err
+					}
+					lines[i] = line
+				}
+				return lines, nil
+			},
+		})
+	}
+	return runSearch(chunks, request)
+}
+
+// Search looks for lines with occurrences frame by frame, using concurrent workers. Frames not in memory
+// are read straight from the swap (or the source) file, so frames in memory are not evicted by the search.
+func (buff *BufferedData) Search(request *SearchRequest) ([]LineMatch, error) {
+	buff.mutex.Lock()
+	chunks := make([]searchChunk, len(buff.frames))
+	for i := range buff.frames {
+		frame := buff.frames[i]
+		chunks[i] = searchChunk{
+			firstLine: frame.firstLine,
+			noOfLines: frame.noOfLines,
+		}
+		if frame.block != nil {
+			lines := frame.block.lines
+			chunks[i].read = func() ([]string, error) {
+				if len(lines) < frame.noOfLines {
+					return nil, ErrFileChanged
+				}
+				return lines[:frame.noOfLines], nil
+			}
+		} else {
+			var f *os.File
+			if frame.fromSource {
+				f = buff.sourceFile
+			} else {
+				f = buff.swapFile
+			}
+			compressed, newFilter := buff.compressSwap && !frame.fromSource, buff.newLineFilter
+			chunks[i].read = func() ([]string, error) {
+				return buff.readFrameLines(f, &frame, compressed, newFilter)
+			}
+		}
+	}
+	buff.mutex.Unlock()
+	return runSearch(chunks, request)
+}
+
+// searchChunk is a range of consecutive lines searched by a single worker.
+type searchChunk struct {
+	firstLine int
+	noOfLines int
+	read      func() ([]string, error)
+}
+
+type chunkResult struct {
+	found []LineMatch
+	lines int
+	err   error
+}
+
+// runSearch searches chunks (in the ascending order of lines) concurrently and merges their results
+// in the order of the search.
+func runSearch(chunks []searchChunk, request *SearchRequest) ([]LineMatch, error) {
+	selected := make([]searchChunk, 0, len(chunks))
+	total := 0
+	for _, chunk := range chunks {
+		first, last := chunk.firstLine, chunk.firstLine+chunk.noOfLines-1
+		if request.Backward && first <= request.From || !request.Backward && last >= request.From {
+			selected = append(selected, chunk)
+			if request.Backward && last > request.From {
+				last = request.From
+			} else if !request.Backward && first < request.From {
+				first = request.From
+			}
+			total += last - first + 1
+		}
+	}
+	if request.Backward {
+		for i, j := 0, len(selected)-1; i < j; i, j = i+1, j-1 {
+			selected[i], selected[j] = selected[j], selected[i]
+		}
+	}
+	workers := request.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	// Chunks are dispatched, as long as the merge keeps up with them, so the workers do not run far ahead
+	// of results consumed, keeping lines found in memory
+	slots := make(chan struct{}, 2*workers)
+	next := make(chan int)
+	go func() {
+		defer close(next)
+		for i := range selected {
+			select {
+			case slots <- struct{}{}:
+			case <-stop:
+				return
+			}
+			select {
+			case next <- i:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	results := make([]chan chunkResult, len(selected))
+	for i := range results {
+		results[i] = make(chan chunkResult, 1)
+	}
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := range next {
+				results[i] <- scanChunk(selected[i], request, stop)
+			}
+		}()
+	}
+
+	found := make([]LineMatch, 0)
+	count, done := 0, 0
+	for i := range selected {
+		var result chunkResult
+		select {
+		case <-request.Cancel:
+			return nil, ErrSearchCancelled
+		default:
+		}
+		select {
+		case result = <-results[i]:
+		case <-request.Cancel:
+			return nil, ErrSearchCancelled
+		}
+		<-slots
+		if result.err != nil {
+			return nil, result.err
+		}
+		done += result.lines
+		if request.Progress != nil {
+			request.Progress(done, total)
+		}
+		if request.Limit > 0 && count+len(result.found) > request.Limit {
+			result.found = result.found[:request.Limit-count]
+		}
+		count += len(result.found)
+		if request.Collect == nil {
+			found = append(found, result.found...)
+		} else if len(result.found) > 0 {
+			// Lines collected are not kept, as there may be too many of them
+			request.Collect(result.found)
+		}
+		if request.Limit > 0 && count >= request.Limit {
+			return found, nil
+		}
+	}
+	return found, nil
+}
+
+// scanChunk returns lines of the chunk with occurrences found, in the order of the search. It stops, when the search
+// is cancelled or its results are not needed any more.
+func scanChunk(chunk searchChunk, request *SearchRequest, stop <-chan struct{}) chunkResult {
+	lines, err := chunk.read()
+	if err != nil {
+		return chunkResult{err: err}
+	}
+	result := chunkResult{found: make([]LineMatch, 0)}
+	for k := range lines {
+		j := k
+		if request.Backward {
+			j = len(lines) - 1 - k
+		}
+		line := chunk.firstLine + j
+		if request.Backward && line > request.From || !request.Backward && line < request.From {
+			continue
+		}
+		select {
+		case <-request.Cancel:
+			return chunkResult{err: ErrSearchCancelled}
+		case <-stop:
+			return chunkResult{err: ErrSearchCancelled}
+		default:
+		}
+		result.lines++
+		if found := request.Match(lines[j]); len(found) > 0 {
+			result.found = append(result.found, LineMatch{Line: line, Text: lines[j], Found: found})
+		}
+	}
+	return result
+}
+
+var _ SearchableStore = (*BufferedData)(nil)
@@ -0,0 +1,242 @@
+package buffers
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// LineIterator walks through the lines of a LineStore.
+type LineIterator interface {
+	Index() int
+	IndexOK() bool
+	IndexBegin() bool
+	IndexSet(index int, force bool) bool
+	IndexSetIfValid(index int) bool
+	IndexNext(delta int) bool
+	IndexIncrement() bool
+	IndexDecrement() bool
+	GetLine() (string, error)
+}
+
+// LineStore is a random access storage of text lines.
+type LineStore interface {
+	Len() int
+	GetLine(index int) (string, error)
+	Iterator() LineIterator
+	Close()
+}
+
+// LineAppender is a LineStore filled line by line while the input is being read.
+type LineAppender interface {
+	LineStore
+	AddLine(line string)
+}
+
+// OffsetAppender is a LineAppender able to keep just the offsets of lines within a seekable source file.
+type OffsetAppender interface {
+	LineAppender
+	SetSourceFile(file *os.File) error
+	SetLineFilter(newFilter func() LineFilter)
+	AddLineAt(line string, offset int64)
+}
+
+// IndexableStore is an OffsetAppender whose frames index may be saved and restored later on.
+type IndexableStore interface {
+	OffsetAppender
+	ExportIndex() (*FrameIndex, error)
+	ImportIndex(index *FrameIndex) error
+}
+
+// CompressingStore is able to keep its swapped out data compressed.
+type CompressingStore interface {
+	SetSwapCompression(compress bool)
+}
+
+// RenewableStore is able to create a new, empty store of the same kind and settings.
+type RenewableStore interface {
+	NewEmpty() LineAppender
+}
+
+// MemoryData keeps all the lines in memory.
+type MemoryData struct {
+	mutex sync.RWMutex
+	lines []string
+}
+
+func NewMemoryData() *MemoryData {
+	return &MemoryData{
+		lines: []string{},
+	}
+}
+
+func (m *MemoryData) NewEmpty() LineAppender {
+	return NewMemoryData()
+}
+
+func (m *MemoryData) AddLine(line string) {
+	defer m.mutex.Unlock()
+	m.mutex.Lock()
+	m.lines = append(m.lines, strings.TrimRight(line, " \t\r\n"))
+}
+
+func (m *MemoryData) Len() int {
+	defer m.mutex.RUnlock()
+	m.mutex.RLock()
+	return len(m.lines)
+}
+
+func (m *MemoryData) GetLine(index int) (string, error) {
+	defer m.mutex.RUnlock()
+	m.mutex.RLock()
+	if index < 0 || index >= len(m.lines) {
+		return "", errors.New(fmt.Sprintf("wrong line index %d", index))
+	}
+	return m.lines[index], nil
+}
+
+func (m *MemoryData) Iterator() LineIterator {
+	return NewStoreIterator(m)
+}
+
+func (m *MemoryData) Close() {
+	defer m.mutex.Unlock()
+	m.mutex.Lock()
+	m.lines = nil
+}
+
+// FilteredData shows selected lines of another store. Just indexes of the lines are kept, the lines themselves
+// are read from the source store, which is not closed together with the filtered one.
+type FilteredData struct {
+	mutex   sync.RWMutex
+	source  LineStore
+	indexes []int
+}
+
+func NewFilteredData(source LineStore) *FilteredData {
+	return &FilteredData{
+		source:  source,
+		indexes: []int{},
+	}
+}
+
+// AddIndex adds the line of the source store to the lines shown; indexes have to be added in the ascending order.
+func (f *FilteredData) AddIndex(sourceIndex int) {
+	defer f.mutex.Unlock()
+	f.mutex.Lock()
+	f.indexes = append(f.indexes, sourceIndex)
+}
+
+func (f *FilteredData) Len() int {
+	defer f.mutex.RUnlock()
+	f.mutex.RLock()
+	return len(f.indexes)
+}
+
+func (f *FilteredData) GetLine(index int) (string, error) {
+	sourceIndex := f.SourceIndex(index)
+	if sourceIndex < 0 {
+		return "", errors.New(fmt.Sprintf("wrong line index %d", index))
+	}
+	return f.source.GetLine(sourceIndex)
+}
+
+// SourceIndex returns the index of the line in the source store, or -1 for a wrong index.
+func (f *FilteredData) SourceIndex(index int) int {
+	defer f.mutex.RUnlock()
+	f.mutex.RLock()
+	if index < 0 || index >= len(f.indexes) {
+		return -1
+	}
+	return f.indexes[index]
+}
+
+// IndexOf returns the index of the first line shown, which is not before the given line of the source store.
+// It returns Len(), when there is no such a line.
+func (f *FilteredData) IndexOf(sourceIndex int) int {
+	defer f.mutex.RUnlock()
+	f.mutex.RLock()
+	return sort.SearchInts(f.indexes, sourceIndex)
+}
+
+func (f *FilteredData) Iterator() LineIterator {
+	return NewStoreIterator(f)
+}
+
+func (f *FilteredData) Close() {
+	defer f.mutex.Unlock()
+	f.mutex.Lock()
+	f.indexes = nil
+}
+
+// StoreIterator is a LineIterator built on top of LineStore.GetLine, suitable for any store.
+type StoreIterator struct {
+	lineIndex int
+	store     LineStore
+}
+
+func NewStoreIterator(store LineStore) *StoreIterator {
+	return &StoreIterator{
+		lineIndex: 0,
+		store:     store,
+	}
+}
+
+func (i *StoreIterator) Index() int {
+	return i.lineIndex
+}
+
+func (i *StoreIterator) IndexOK() bool {
+	return i.lineIndex >= 0 && i.lineIndex < i.store.Len()
+}
+
+func (i *StoreIterator) IndexBegin() bool {
+	i.lineIndex = 0
+	return i.IndexOK()
+}
+
+func (i *StoreIterator) IndexSet(index int, force bool) bool {
+	if index < 0 || index >= i.store.Len() {
+		if force {
+			i.lineIndex = index
+		}
+		return false
+	}
+	i.lineIndex = index
+	return true
+}
+
+func (i *StoreIterator) IndexNext(delta int) bool {
+	if delta == 0 {
+		return false
+	}
+	return i.IndexSet(i.lineIndex+delta, true)
+}
+
+func (i *StoreIterator) IndexIncrement() bool {
+	return i.IndexNext(1)
+}
+
+func (i *StoreIterator) IndexDecrement() bool {
+	return i.IndexNext(-1)
+}
+
+func (i *StoreIterator) IndexSetIfValid(index int) bool {
+	return i.IndexSet(index, false)
+}
+
+func (i *StoreIterator) GetLine() (string, error) {
+	return i.store.GetLine(i.lineIndex)
+}
+
+var (
+	_ IndexableStore   = (*BufferedData)(nil)
+	_ CompressingStore = (*BufferedData)(nil)
+	_ RenewableStore   = (*BufferedData)(nil)
+	_ LineAppender     = (*MemoryData)(nil)
+	_ RenewableStore   = (*MemoryData)(nil)
+	_ LineStore        = (*FilteredData)(nil)
+)
@@ -14,13 +14,25 @@ import (
 const ConfigFile = "config.yaml"
 
 type CnfDataBuffer struct {
-	BlockSizeLimitMB int `yaml:"blockSizeLimitMB"`
-	TotalSizeLimitMB int `yaml:"totalSizeLimitMB"`
+	BlockSizeLimitMB int    `yaml:"blockSizeLimitMB"`
+	TotalSizeLimitMB int    `yaml:"totalSizeLimitMB"`
+	IndexCache       bool   `yaml:"indexCache"`
+	Encoding         string `yaml:"encoding"`
+	FallbackEncoding string `yaml:"fallbackEncoding"`
 }
 
 type CnfView struct {
-	SpacesPerTab       int `yaml:"spacesPerTab"`
-	ViewRefreshSeconds int `yaml:"viewRefreshSeconds"`
+	SpacesPerTab         int    `yaml:"spacesPerTab"`
+	ViewRefreshSeconds   int    `yaml:"viewRefreshSeconds"`
+	FollowIntervalMillis int    `yaml:"followIntervalMillis"`
+	Ansi                 string `yaml:"ansi"`
+	Overstrike           bool   `yaml:"overstrike"`
+	Wrap                 bool   `yaml:"wrap"`
+}
+
+type CnfReload struct {
+	Auto            bool `yaml:"auto"`
+	MaxTrackedLines int  `yaml:"maxTrackedLines"`
 }
 
 type CnfSideArrows struct {
@@ -41,7 +53,18 @@ type CnfRuler struct {
 }
 
 type CnfNumbers struct {
-	Color string `yaml:"color"`
+	Color        string `yaml:"color"`
+	ChangedColor string `yaml:"changedColor"`
+	ChangedMark  int    `yaml:"changedMark"`
+	MarkColor    string `yaml:"markColor"`
+}
+
+type CnfHighlight struct {
+	MatchTextColor       string   `yaml:"matchTextColor"`
+	MatchBackgroundColor string   `yaml:"matchBackgroundColor"`
+	MarkerTextColor      string   `yaml:"markerTextColor"`
+	MarkerColors         []string `yaml:"markerColors"`
+	NoMatchColor         string   `yaml:"noMatchColor"`
 }
 
 type CnfHelp struct {
@@ -51,7 +74,42 @@ type CnfHelp struct {
 }
 
 type CnfSearch struct {
-	IgnoreCase bool `yaml:"ignoreCase"`
+	IgnoreCase  bool `yaml:"ignoreCase"`
+	Incremental bool `yaml:"incremental"`
+	WholeWord   bool `yaml:"wholeWord"`
+	SmartCase   bool `yaml:"smartCase"`
+	WrapAround  bool `yaml:"wrapAround"`
+}
+
+type CnfHistory struct {
+	Size int `yaml:"size"`
+}
+
+type CnfTable struct {
+	Delimiter      string `yaml:"delimiter"`
+	Quote          string `yaml:"quote"`
+	Header         bool   `yaml:"header"`
+	MaxColumnWidth int    `yaml:"maxColumnWidth"`
+	SampleLines    int    `yaml:"sampleLines"`
+}
+
+// CnfFreeze freezes lines at the top and columns at the left of the view, for files of names matching the pattern.
+type CnfFreeze struct {
+	Pattern string `yaml:"pattern"`
+	Lines   int    `yaml:"lines"`
+	Columns int    `yaml:"columns"`
+}
+
+// CnfLayout selects the record layout file for files of names matching the pattern; a relative file name is
+// relative to the configuration directory.
+type CnfLayout struct {
+	Pattern string `yaml:"pattern"`
+	File    string `yaml:"file"`
+}
+
+type CnfTableView struct {
+	SeparatorColor string `yaml:"separatorColor"`
+	HeaderColor    string `yaml:"headerColor"`
 }
 
 type CnfTheme struct {
@@ -73,15 +131,23 @@ type CnfVisual struct {
 	StatusBar  CnfStatusBar  `yaml:"statusBar"`
 	Ruler      CnfRuler      `yaml:"ruler"`
 	Numbers    CnfNumbers    `yaml:"numbers"`
+	Highlight  CnfHighlight  `yaml:"highlight"`
 	Help       CnfHelp       `yaml:"help"`
+	Table      CnfTableView  `yaml:"table"`
 	Theme      CnfTheme      `yaml:"theme"`
 }
 
 type Config struct {
 	DataBuffer CnfDataBuffer `yaml:"dataBuffer"`
 	Search     CnfSearch     `yaml:"search"`
+	History    CnfHistory    `yaml:"history"`
+	Table      CnfTable      `yaml:"table"`
+	Freeze     []CnfFreeze   `yaml:"freeze"`
+	Layouts    []CnfLayout   `yaml:"layouts"`
 	View       CnfView       `yaml:"view"`
+	Reload     CnfReload     `yaml:"reload"`
 	Visual     CnfVisual     `yaml:"visual"`
+	prog       string
 }
 
 func NewDefaultConfig() *Config {
@@ -89,13 +155,43 @@ func NewDefaultConfig() *Config {
 		DataBuffer: CnfDataBuffer{
 			BlockSizeLimitMB: buffers.DefaultBlockSizeLimit / buffers.MB,
 			TotalSizeLimitMB: buffers.DefaultTotalSizeLimit / buffers.MB,
+			IndexCache:       true,
+			Encoding:         "auto",
+			FallbackEncoding: "windows-1252",
 		},
 		Search: CnfSearch{
-			IgnoreCase: true,
+			IgnoreCase:  true,
+			Incremental: true,
+			WholeWord:   false,
+			SmartCase:   false,
+			WrapAround:  false,
+		},
+		History: CnfHistory{
+			Size: 100,
 		},
+		Table: CnfTable{
+			Delimiter:      "auto",
+			Quote:          "\"",
+			Header:         true,
+			MaxColumnWidth: 40,
+			SampleLines:    1000,
+		},
+		Freeze: []CnfFreeze{
+			{Pattern: "*.csv", Lines: 1, Columns: 0},
+			{Pattern: "*.tsv", Lines: 1, Columns: 0},
+		},
+		Layouts: []CnfLayout{},
 		View: CnfView{
-			SpacesPerTab:       4,
-			ViewRefreshSeconds: 5,
+			SpacesPerTab:         4,
+			ViewRefreshSeconds:   5,
+			FollowIntervalMillis: 500,
+			Ansi:                 "render",
+			Overstrike:           true,
+			Wrap:                 false,
+		},
+		Reload: CnfReload{
+			Auto:            false,
+			MaxTrackedLines: 10000000,
 		},
 		Visual: CnfVisual{
 			SideArrows: CnfSideArrows{
@@ -119,13 +215,27 @@ func NewDefaultConfig() *Config {
 				TextAttrs: "",
 			},
 			Numbers: CnfNumbers{
-				Color: "gold",
+				Color:        "gold",
+				ChangedColor: "orangeRed",
+				ChangedMark:  '\u258C',
+				MarkColor:    "aqua",
+			},
+			Highlight: CnfHighlight{
+				MatchTextColor:       "black",
+				MatchBackgroundColor: "khaki",
+				MarkerTextColor:      "black",
+				MarkerColors:         []string{"lime", "aqua", "fuchsia", "orange", "deepskyblue", "salmon"},
+				NoMatchColor:         "red",
 			},
 			Help: CnfHelp{
 				BackgroundColor: "beige",
 				ForegroundColor: "darkGreen",
 				BorderColor:     "darkGreen",
 			},
+			Table: CnfTableView{
+				SeparatorColor: "gray",
+				HeaderColor:    "gold",
+			},
 			Theme: CnfTheme{
 				PrimitiveBackgroundColor:    "#001000",
 				ContrastBackgroundColor:     "maroon",
@@ -145,6 +255,7 @@ func NewDefaultConfig() *Config {
 
 func GetConfig(prog string) *Config {
 	result := NewDefaultConfig() // Default config
+	result.prog = prog
 	configFile := GetConfigFileName(prog)
 	if _, err := os.Stat(configFile); os.IsNotExist(err) {
 		if cnf, err := yaml.Marshal(result); err != nil {
@@ -183,3 +294,12 @@ func GetConfigDir(prog string) string {
 func GetConfigFileName(prog string) string {
 	return path.Join(GetConfigDir(prog), ConfigFile)
 }
+
+// GetDir returns the configuration directory of the program, or an empty string for a configuration
+// not obtained by GetConfig (e.g. the default one), which should not leave any files behind.
+func (c *Config) GetDir() string {
+	if len(c.prog) == 0 {
+		return ""
+	}
+	return GetConfigDir(c.prog)
+}
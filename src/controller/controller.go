@@ -2,76 +2,94 @@ package controller
 
 import (
 	"bufio"
+	"fmt"
 	"github.com/bry00/m/buffers"
 	"github.com/bry00/m/config"
+	"github.com/bry00/m/markup"
 	"github.com/bry00/m/utl"
 	"github.com/bry00/m/view"
 	"io"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
-	"regexp"
 	"strings"
 	"time"
 	"unicode/utf8"
 )
 
 type Controller struct {
-	fileName         *string
+	*document
+	docs             []*document
 	title            *string
 	conf             *config.Config
-	maxLineLength    int
 	view             view.TheView
-	data             *buffers.BufferedData
-	dataReady        bool
-	searchString     string
-	searchRegex      bool
-	searchIgnoreCase bool
-	searchLastRow    int
-	searchLastCol    int
-	pointedLine      int
 	removeBackspaces bool
+	autoReload       bool
+	encoding         *textEncoding
+	fallbackEncoding *textEncoding
+	ansiMode         markup.AnsiMode
+	overstrike       bool
+	markers          []*marker
+	nextMarker       int
+	search           *searchJob
+	results          *searchResults
+	incremental      *searchOrigin
+	history          *history
 }
 
-func NewController(fileName string, title string, data *buffers.BufferedData, view view.TheView, conf *config.Config, removeBackspaces bool) *Controller {
-	var (
-		filePath *string = nil
-	)
-	if len(fileName) > 0 {
+func NewController(fileNames []string, title string, data buffers.LineStore, view view.TheView, conf *config.Config, removeBackspaces bool) *Controller {
+	result := &Controller{
+		document:         nil,
+		docs:             []*document{},
+		title:            nil,
+		conf:             conf,
+		view:             view,
+		removeBackspaces: removeBackspaces,
+		overstrike:       conf.View.Overstrike && !removeBackspaces,
+		autoReload:       conf.Reload.Auto,
+		encoding:         nil,
+		fallbackEncoding: getFallbackEncoding(conf.DataBuffer.FallbackEncoding),
+	}
+	result.history = loadHistory(result.getHistoryFileName(), conf.History.Size)
+	if err := result.SetEncoding(conf.DataBuffer.Encoding); err != nil {
+		log.Fatal(err)
+	}
+	if mode, err := markup.ParseAnsiMode(conf.View.Ansi); err != nil {
+		log.Fatal(err)
+	} else {
+		result.ansiMode = mode
+	}
+	if len(fileNames) == 0 {
+		result.docs = append(result.docs, newDocument(nil, data, conf))
+	}
+	for _, fileName := range fileNames {
 		if absPath, err := filepath.Abs(fileName); err != nil {
 			log.Fatal(err)
 		} else {
 			if !fileExists(absPath) {
 				log.Fatalf("File \"%s\" does not exist!\n", absPath)
 			}
-			filePath = &absPath
+			if data == nil {
+				data = result.newStore()
+			}
+			doc := newDocument(&absPath, data, conf)
+			result.restoreMarks(doc)
+			result.docs = append(result.docs, doc)
+			data = nil
 		}
 	}
-	result := &Controller{
-		fileName:         filePath,
-		title:            nil,
-		conf:             conf,
-		maxLineLength:    0,
-		data:             data,
-		view:             view,
-		dataReady:        false,
-		searchString:     "",
-		searchRegex:      false,
-		searchIgnoreCase: false,
-		searchLastRow:    -1,
-		searchLastCol:    -1,
-		pointedLine:      -1,
-		removeBackspaces: removeBackspaces,
-	}
+	result.document = result.docs[0]
 	if !utl.IsEmptyString(title) {
 		result.title = &title
 	}
 	view.SetController(result)
+	view.SetWrapped(conf.View.Wrap)
 	return result
 }
 
 func (ctl *Controller) DataReady() bool {
-	return ctl.dataReady
+	return ctl.isDataReady()
 }
 
 func (ctl *Controller) GetConfig() *config.Config {
@@ -80,36 +98,72 @@ func (ctl *Controller) GetConfig() *config.Config {
 
 func (ctl *Controller) Run() {
 	ctl.view.Prepare()
-	go ctl.readFile()
+	for _, doc := range ctl.docs {
+		go ctl.readFile(doc)
+	}
 	ctl.view.Show()
 }
 
 func (ctl *Controller) OnExit() {
-	if ctl.data != nil {
-		ctl.data.Close()
-		ctl.data = nil
+	for _, doc := range ctl.docs {
+		if doc.data != nil {
+			doc.data.Close()
+			doc.data = nil
+		}
 	}
 }
 
 func (ctl *Controller) NoOfLines() int {
-	return ctl.data.Len()
+	return ctl.shown().Len()
 }
 
 func (ctl *Controller) GetFileNameTitle() string {
+	if len(ctl.docs) > 1 {
+		current, count := ctl.GetDocumentIndex()
+		return fmt.Sprintf("%s [%d/%d]", ctl.document.getTitle(), current+1, count)
+	}
 	if ctl.title == nil {
-		if ctl.fileName == nil {
-			return "<<stdin>>"
-		}
-		if home, err := os.UserHomeDir(); err == nil && strings.HasPrefix(*ctl.fileName, home) {
-			return "~" + strings.TrimPrefix(*ctl.fileName, home)
-		}
-		return *ctl.fileName
+		return ctl.document.getTitle()
 	}
 	return *ctl.title
 }
 
-func (ctl *Controller) GetDataIterator(firstRow int) (*buffers.LineIndex, bool) {
-	result := ctl.data.NewLineIndexer()
+// GetInputInfo describes how the input data is decoded: its compression format and encoding, the filters set and
+// the record layout.
+func (ctl *Controller) GetInputInfo() string {
+	info := make([]string, 0, 2)
+	if len(ctl.compression) > 0 {
+		info = append(info, ctl.compression)
+	}
+	if ctl.document.encoding != nil {
+		info = append(info, ctl.document.encoding.name)
+	}
+	if ctl.hexShown {
+		info = append(info, "hex")
+	}
+	if len(ctl.filters) > 0 {
+		info = append(info, "filter "+describeFilters(ctl.filters))
+	}
+	if ctl.GetLayoutFields() != nil {
+		info = append(info, "layout "+ctl.layout.name)
+	}
+	return strings.Join(info, ", ")
+}
+
+// ParseLine returns the visible text of the line and its styled parts.
+func (ctl *Controller) ParseLine(line string) (string, []markup.Span) {
+	if ctl.table != nil {
+		return ctl.table.formatRow(ctl.visibleText(line))
+	}
+	return markup.Parse(line, ctl.ansiMode == markup.AnsiRender, ctl.overstrike)
+}
+
+func (ctl *Controller) SetAnsiMode(mode markup.AnsiMode) {
+	ctl.ansiMode = mode
+}
+
+func (ctl *Controller) GetDataIterator(firstRow int) (buffers.LineIterator, bool) {
+	result := ctl.shown().Iterator()
 	if result.IndexSet(firstRow, false) {
 		return result, true
 	} else {
@@ -145,33 +199,38 @@ func setFoundStringPosition(left int, top int, width int, height int, foundLine
 }
 
 func (ctl *Controller) DoAction(action view.Action) {
-	lines := ctl.data.Len()
+	lines := ctl.shown().Len()
 	left, top, width, height := ctl.view.GetDisplayRect()
+	row := ctl.view.GetTopRow()
 
 	switch action {
 	case view.ActionReset:
+		ctl.cancelSearch()
 		ctl.pointedLine = -1
-		ctl.view.ShowLine(ctl.pointedLine)
+		ctl.showLine(ctl.pointedLine)
 		ctl.view.ShowRuler(false)
 		ctl.view.ShowNumbers(false)
-		ctl.view.ShowSearchResult(-1, -1, -1)
+		ctl.showSearchResult(-1, -1, -1)
 		ctl.searchString = ""
+		ctl.searchMatcher = nil
 	case view.ActionScrollUp:
-		top -= 1
+		top, row = ctl.scrollRows(top, row, -1, width)
 	case view.ActionScrollDown:
-		top += 1
+		top, row = ctl.scrollRows(top, row, 1, width)
 	case view.ActionTop:
-		top = 0
+		ctl.recordJump()
+		top, row = 0, 0
 	case view.ActionBottom:
-		top = lines - height
+		ctl.recordJump()
+		top, row = ctl.positionAbove(lines, height, width)
 	case view.ActionHome:
 		left = 0
 	case view.ActionEnd:
-		left = ctl.maxLineLength - width + 1
+		left = ctl.lineLength() - width + 1
 	case view.ActionPageUp:
-		top -= height
+		top, row = ctl.scrollRows(top, row, -height, width)
 	case view.ActionPageDown:
-		top += height
+		top, row = ctl.scrollRows(top, row, height, width)
 	case view.ActionScrollLeft:
 		left += 1
 	case view.ActionScrollRight:
@@ -200,16 +259,19 @@ func (ctl *Controller) DoAction(action view.Action) {
 		}
 	case view.ActionFlipNumbers:
 		ctl.view.ShowNumbers(!ctl.view.AreNumbersShown())
+	case view.ActionWrap:
+		ctl.view.SetWrapped(!ctl.view.IsWrapped())
+		left, row = 0, 0
 	case view.ActionSearch:
 		ctl.searchLastRow = -1
 		ctl.searchLastCol = -1
-		ctl.view.ShowSearchResult(-1, -1, -1)
+		ctl.showSearchResult(-1, -1, -1)
 		ctl.view.ShowSearchDialog()
 	case view.ActionFindFirst:
 		ctl.searchLastRow = 0
 		ctl.searchLastCol = 0
 		ctl.DoAction(view.ActionFindNext)
-		left, top, width, height = ctl.view.GetDisplayRect()
+		return
 	case view.ActionFindNext:
 		if len(ctl.searchString) == 0 {
 			ctl.DoAction(view.ActionSearch)
@@ -220,24 +282,9 @@ func (ctl *Controller) DoAction(action view.Action) {
 			if ctl.searchLastCol < 0 {
 				ctl.searchLastCol = left
 			}
-			foundLine, foundStart, foundEnd, foundLineText, err := ctl.findNext(ctl.searchLastRow, ctl.searchLastCol)
-			if err == nil {
-				ctl.searchLastRow = foundLine
-				ctl.searchLastCol = foundEnd
-				ctl.view.ShowSearchResult(foundLine, foundStart, foundEnd)
-				if ctl.searchLastRow >= 0 {
-					left, top = setFoundStringPosition(left, top, width, height, foundLine, foundStart, foundEnd, foundLineText)
-					ctl.view.GetStatusBar().Message("Found at: %d:%d \"%s\"",
-						foundLine+1, utl.CountRunesAtIndex(foundLineText, foundStart)+1, ctl.searchString)
-				} else {
-					ctl.view.GetStatusBar().Message("Cannot find: \"%s\"", ctl.searchString)
-					ctl.searchLastRow = 0
-					ctl.searchLastCol = 0
-				}
-			} else {
-				ctl.view.GetStatusBar().Message("Wrong search string \"%s\": %s", ctl.searchString, err.Error())
-			}
+			ctl.startSearch(true)
 		}
+		return
 	case view.ActionFindPrevious:
 		if ctl.searchLastRow < 0 {
 			ctl.searchLastRow = ctl.NoOfLines()
@@ -245,31 +292,17 @@ func (ctl *Controller) DoAction(action view.Action) {
 		} else {
 			ctl.searchLastCol--
 		}
-		foundLine, foundStart, foundEnd, foundLineText, err := ctl.findPrevious(ctl.searchLastRow, ctl.searchLastCol)
-		if err == nil {
-			ctl.searchLastRow = foundLine
-			ctl.searchLastCol = foundEnd
-			ctl.view.ShowSearchResult(foundLine, foundStart, foundEnd)
-			if ctl.searchLastRow >= 0 {
-				left, top = setFoundStringPosition(left, top, width, height, foundLine, foundStart, foundEnd, foundLineText)
-				ctl.view.GetStatusBar().Message("Previous at: %d:%d \"%s\"",
-					foundLine+1, utl.CountRunesAtIndex(foundLineText, foundStart)+1, ctl.searchString)
-			} else {
-				ctl.view.GetStatusBar().Message("Cannot find previous: \"%s\"", ctl.searchString)
-				ctl.searchLastRow = ctl.NoOfLines() - 1
-				ctl.searchLastCol = -1
-			}
-		} else {
-			ctl.view.GetStatusBar().Message("Wrong search string \"%s\": %s", ctl.searchString, err.Error())
-		}
+		ctl.startSearch(false)
+		return
 	case view.ActionGotoLine:
 		if ctl.pointedLine > 0 {
-			if ctl.pointedLine > lines {
+			if ctl.pointedLine > ctl.data.Len() {
 				ctl.view.GetStatusBar().Message("Wrong line number: %d", ctl.pointedLine)
 			} else {
-				lineIndex := ctl.pointedLine - 1
-				top = lineIndex - height/3
-				ctl.view.ShowLine(lineIndex)
+				ctl.recordJump()
+				lineIndex := utl.MinInt(ctl.shownIndex(ctl.pointedLine-1), lines-1)
+				top, row = ctl.positionAbove(lineIndex, height/3, width)
+				ctl.showLine(lineIndex)
 				ctl.view.GetStatusBar().Message("Line #%d", ctl.pointedLine)
 			}
 			ctl.pointedLine = -1
@@ -277,6 +310,102 @@ func (ctl *Controller) DoAction(action view.Action) {
 		} else {
 			ctl.view.ShowGotoLineDialog()
 		}
+	case view.ActionFollow:
+		if !ctl.isFollowable() {
+			ctl.view.GetStatusBar().Message("Only files, which are not compressed, can be followed")
+			return
+		}
+		ctl.setFollowing(!ctl.isFollowing())
+		ctl.view.GetStatusBar().Status(ctl.getReadyStatus())
+		if ctl.isFollowing() {
+			top, row = ctl.positionAbove(lines, height, width)
+		}
+	case view.ActionReload:
+		ctl.requestReload()
+		return
+	case view.ActionHexMode:
+		ctl.toggleHexMode()
+		return
+	case view.ActionMarker:
+		ctl.toggleMarker()
+		return
+	case view.ActionClearMarkers:
+		ctl.clearMarkers()
+		return
+	case view.ActionFilter:
+		ctl.view.ShowFilterDialog()
+		return
+	case view.ActionRemoveFilter:
+		ctl.RemoveFilter()
+		return
+	case view.ActionNextFile:
+		ctl.switchDocumentBy(1)
+		return
+	case view.ActionPreviousFile:
+		ctl.switchDocumentBy(-1)
+		return
+	case view.ActionFileList:
+		ctl.view.ShowDocumentList()
+		return
+	case view.ActionSearchResults:
+		ctl.listSearchResults()
+		return
+	case view.ActionMarkList:
+		ctl.view.ShowMarkList()
+		return
+	case view.ActionJumpBack:
+		ctl.jumpBack()
+		return
+	case view.ActionJumpForward:
+		ctl.jumpForward()
+		return
+	case view.ActionJumpList:
+		ctl.view.ShowJumpList()
+		return
+	case view.ActionTableMode:
+		ctl.toggleTableMode()
+		return
+	case view.ActionNextColumn:
+		if ctl.GetLayoutFields() != nil {
+			left = ctl.moveCursorToField(left, width, true)
+		} else {
+			left = ctl.moveColumn(left, true)
+		}
+	case view.ActionPreviousColumn:
+		if ctl.GetLayoutFields() != nil {
+			left = ctl.moveCursorToField(left, width, false)
+		} else {
+			left = ctl.moveColumn(left, false)
+		}
+	case view.ActionCursorLeft:
+		left = ctl.moveCursor(ctl.cursorColumn-1, left, width)
+	case view.ActionCursorRight:
+		left = ctl.moveCursor(ctl.cursorColumn+1, left, width)
+	case view.ActionRecordFields:
+		if ctl.GetLayoutFields() == nil {
+			ctl.view.GetStatusBar().Message("There is no record layout of the file (see -layout)")
+		} else {
+			ctl.view.ShowRecordFields()
+		}
+		return
+	case view.ActionFreezeLines:
+		ctl.toggleFrozenLines()
+	case view.ActionFreezeColumns:
+		ctl.toggleFrozenColumns(left)
+	case view.ActionTableColumns:
+		if ctl.table == nil {
+			ctl.view.GetStatusBar().Message("Columns can be chosen in the table mode only")
+		} else {
+			ctl.view.ShowColumnList()
+		}
+		return
+	case view.ActionCancel:
+		if ctl.search != nil || ctl.results != nil && !ctl.results.complete {
+			ctl.cancelSearch()
+		} else {
+			ctl.view.StopApplication()
+		}
+		return
 	case view.ActionQuit:
 		ctl.view.StopApplication()
 		return
@@ -286,17 +415,31 @@ func (ctl *Controller) DoAction(action view.Action) {
 	default:
 		return
 	}
+	ctl.displayAt(left, top, row)
+}
+
+// displayAt shows the data from the given position, which is corrected to fill the view if possible.
+func (ctl *Controller) displayAt(left int, top int, row int) {
+	lines := ctl.shown().Len()
+	_, _, width, height := ctl.view.GetDisplayRect()
+	if ctl.view.IsWrapped() {
+		ctl.displayWrapped(top, row, width, height)
+		return
+	}
 	if top >= lines-height {
 		top = lines - height
 	}
 	if top < 0 {
 		top = 0
 	}
-	if left > ctl.maxLineLength-width+1 {
-		left = ctl.maxLineLength - width + 1
+	if frozenTop := ctl.frozenTop(); top < frozenTop && frozenTop < lines {
+		top = frozenTop
 	}
-	if left < 0 {
-		left = 0
+	if maxLeft := ctl.lineLength() - width + 1; left > maxLeft {
+		left = maxLeft
+	}
+	if left < ctl.frozenColumns {
+		left = ctl.frozenColumns
 	}
 	ctl.view.DisplayAt(left, top)
 }
@@ -305,206 +448,520 @@ func (ctl *Controller) SetSearchText(text string, regex bool, ignoreCase bool) {
 	ctl.searchString = text
 	ctl.searchRegex = regex
 	ctl.searchIgnoreCase = ignoreCase
+	ctl.searchMatcher, _ = newMatcher(ctl.currentQuery())
 }
 
-func (ctl *Controller) findPrevious(startLine int, startColumn int) (int, int, int, string, error) {
-	var (
-		err error
-		re  *regexp.Regexp
-	)
-	tabSpaces := strings.Repeat(" ", ctl.conf.View.SpacesPerTab)
-	searchString := ctl.searchString
+// SetSearchOptions sets how the search string is matched and whether the search continues from the other end
+// of the lines, when it reaches the end (or the beginning) of them.
+func (ctl *Controller) SetSearchOptions(wholeWord bool, smartCase bool, wrapAround bool) {
+	ctl.searchWholeWord = wholeWord
+	ctl.searchSmartCase = smartCase
+	ctl.searchWrapAround = wrapAround
+	ctl.searchMatcher, _ = newMatcher(ctl.currentQuery())
+}
 
-	if ctl.searchRegex {
-		if ctl.searchIgnoreCase && !strings.HasPrefix(ctl.searchString, "(?i)") {
-			searchString = "(?i)" + searchString
-		}
-		re, err = regexp.Compile(searchString)
-		if err != nil {
-			return -1, -1, -1, "", err
-		}
-	} else {
-		if ctl.searchIgnoreCase {
-			searchString = strings.ToUpper(searchString)
-		}
+func (ctl *Controller) findPrevious(job *searchJob, startLine int, startColumn int) (int, int, int, string, error) {
+	q, hex, data, expand, first := ctl.searchSource(job)
+	if pattern, ok := q.hexPattern(hex); ok {
+		return findHex(job, data, pattern, startLine, startColumn, false)
 	}
-	search := func(txt string) []int {
-		if ctl.searchRegex {
-			if f := re.FindAllStringIndex(txt, -1); f != nil {
-				return f[len(f)-1]
-			}
-			return nil
-		}
-		if ctl.searchIgnoreCase {
-			txt = strings.ToUpper(txt)
-		}
-		i := strings.LastIndex(txt, searchString)
-		if i < 0 {
-			return nil
-		}
-		result := make([]int, 2)
-		result[0] = i
-		result[1] = i + len(searchString)
-		return result
-	}
-	line := -1
-	start := -1
-	end := -1
-	limit := startColumn
-	i := ctl.data.NewLineIndexer()
-	i.IndexSet(startLine, false)
-	lastLine := ""
-	for ; i.IndexOK(); i.IndexDecrement() {
-		if txt, err := i.GetLine(); err == nil {
-			txt = strings.Replace(txt, "\t", tabSpaces, -1)
-			lastLine = txt
-			if limit > 0 {
-				txt = txt[0:limit]
-				limit = 0
-			}
-			if found := search(txt); found != nil {
-				line = i.Index()
-				start = found[0]
-				end = found[1]
-				break
+	if job.cancelled() {
+		return -1, -1, -1, "", errSearchCancelled
+	}
+	m, err := newMatcher(q)
+	if err != nil {
+		return -1, -1, -1, "", err
+	}
+	if lines := data.Len(); startLine >= lines {
+		startLine = lines - 1
+		startColumn = -1
+	}
+	if startLine < first {
+		return -1, -1, -1, "", nil
+	}
+	if startLine >= 0 {
+		if txt, err := data.GetLine(startLine); err == nil {
+			// The whole line is searched, so whole words are told at the start column too
+			lastLine := expand(txt)
+			found := m.findAll(lastLine)
+			for k := len(found) - 1; k >= 0; k-- {
+				if startColumn <= 0 || found[k][1] <= startColumn {
+					return startLine, found[k][0], found[k][1], lastLine, nil
+				}
 			}
 		}
 	}
-	return line, start, end, lastLine, nil
+	return searchLines(job, data, m, expand, startLine-1, first, false)
 }
 
-func (ctl *Controller) findNext(startLine int, startColumn int) (int, int, int, string, error) {
-	var (
-		err error
-		re  *regexp.Regexp
-	)
-	tabSpaces := strings.Repeat(" ", ctl.conf.View.SpacesPerTab)
-	searchString := ctl.searchString
-
-	if ctl.searchRegex {
-		if ctl.searchIgnoreCase && !strings.HasPrefix(ctl.searchString, "(?i)") {
-			searchString = "(?i)" + searchString
-		}
-		re, err = regexp.Compile(searchString)
-		if err != nil {
-			return -1, -1, -1, "", err
-		}
-	} else {
-		if ctl.searchIgnoreCase {
-			searchString = strings.ToUpper(searchString)
-		}
-	}
-	search := func(txt string) []int {
-		if ctl.searchRegex {
-			return re.FindStringIndex(txt)
-		}
-		if ctl.searchIgnoreCase {
-			txt = strings.ToUpper(txt)
-		}
-		i := strings.Index(txt, searchString)
-		if i < 0 {
-			return nil
-		}
-		result := make([]int, 2)
-		result[0] = i
-		result[1] = i + len(searchString)
-		return result
-	}
-	line := -1
-	start := -1
-	end := -1
-	foundLineText := ""
-	offset := startColumn
-	i := ctl.data.NewLineIndexer()
-	i.IndexSet(startLine, false)
-	for ; i.IndexOK(); i.IndexIncrement() {
-		if txt, err := i.GetLine(); err == nil {
-			lastLine := strings.Replace(txt, "\t", tabSpaces, -1)
-			if offset < len(lastLine) {
-				if offset > 0 {
-					txt = lastLine[offset:]
-				} else {
-					txt = lastLine
-				}
-				if found := search(txt); found != nil {
-					line = i.Index()
-					start = found[0] + offset
-					end = found[1] + offset
-					foundLineText = lastLine
-					break
+func (ctl *Controller) findNext(job *searchJob, startLine int, startColumn int) (int, int, int, string, error) {
+	q, hex, data, expand, first := ctl.searchSource(job)
+	if pattern, ok := q.hexPattern(hex); ok {
+		return findHex(job, data, pattern, startLine, startColumn, true)
+	}
+	if job.cancelled() {
+		return -1, -1, -1, "", errSearchCancelled
+	}
+	m, err := newMatcher(q)
+	if err != nil {
+		return -1, -1, -1, "", err
+	}
+	if startLine < first {
+		startLine = first
+		startColumn = 0
+	}
+	if startLine < data.Len() {
+		if txt, err := data.GetLine(startLine); err == nil {
+			// The whole line is searched, so whole words are told at the start column too
+			lastLine := expand(txt)
+			for _, found := range m.findAll(lastLine) {
+				if found[0] >= startColumn {
+					return startLine, found[0], found[1], lastLine, nil
 				}
 			}
 		}
-		offset = 0
 	}
-	return line, start, end, foundLineText, nil
+	return searchLines(job, data, m, expand, startLine+1, first, true)
+}
+
+// searchTextExpander returns the function making the text searched of a line: the visible text with tabs expanded,
+// or the row of the table in the table mode.
+func (ctl *Controller) searchTextExpander() func(line string) string {
+	tabSpaces := strings.Repeat(" ", ctl.conf.View.SpacesPerTab)
+	render, overstrike := ctl.ansiMode == markup.AnsiRender, ctl.overstrike
+	if table := ctl.table; table != nil {
+		return func(line string) string {
+			return table.format(markup.Strip(line, render, overstrike))
+		}
+	}
+	return func(line string) string {
+		return strings.Replace(markup.Strip(line, render, overstrike), "\t", tabSpaces, -1)
+	}
+}
+
+// searchLines looks for the first line with an occurrence, starting from the given line, with frames
+// searched in parallel; lines above the first one given are not searched. The first (or, searching backward,
+// the last) occurrence in the line is returned.
+func searchLines(job *searchJob, store buffers.LineStore, m *matcher, expand func(string) string,
+	from int, first int, forward bool) (int, int, int, string, error) {
+	if from < first || from >= store.Len() {
+		return -1, -1, -1, "", nil
+	}
+	request := &buffers.SearchRequest{
+		From:     from,
+		Backward: !forward,
+		Limit:    1,
+		Match: func(line string) [][]int {
+			return m.findAll(expand(line))
+		},
+	}
+	if job != nil {
+		request.Cancel = job.cancel
+		request.Progress = job.report
+	}
+	found, err := buffers.Search(store, request)
+	if err != nil || len(found) == 0 || found[0].Line < first {
+		return -1, -1, -1, "", err
+	}
+	occurrence := found[0].Found[0]
+	if !forward {
+		occurrence = found[0].Found[len(found[0].Found)-1]
+	}
+	return found[0].Line, occurrence[0], occurrence[1], expand(found[0].Text), nil
 }
 
 func (ctl *Controller) SetPointedLine(lineNo int) {
 	ctl.pointedLine = lineNo
 }
 
-func (ctl *Controller) readFile() {
+func (ctl *Controller) readFile(doc *document) {
+	for ctl.readInput(doc) {
+	}
+}
+
+// readInput reads the whole input into the data store, in the follow mode it keeps reading lines appended
+// to the file afterwards, also to a new file replacing it. It returns true, when the file has to be read again,
+// i.e. when reloading has been requested or the followed file has been truncated.
+func (ctl *Controller) readInput(doc *document) bool {
+	var (
+		file       *os.File
+		err        error
+		openedInfo os.FileInfo
+	)
+
+	if doc.data == nil {
+		doc.data = buffers.NewBufferedDataDefault()
+	}
+	store, ok := doc.data.(buffers.LineAppender)
+	if !ok {
+		// The store has been supplied together with its content
+		for i := doc.data.Iterator(); i.IndexOK(); i.IndexIncrement() {
+			if line, err := i.GetLine(); err == nil {
+				doc.maxLineLength = utl.MaxInt(doc.maxLineLength,
+					lengthExpandedTabs(ctl.visibleText(line), ctl.conf.View.SpacesPerTab))
+			}
+		}
+		doc.setDataReady(true)
+		ctl.setStatus(doc, view.StatusReady)
+		ctl.view.Refresh()
+		return false
+	}
+	if store.Len() > 0 {
+		store = ctl.newStore()
+		ctl.replaceData(doc, store)
+	}
+	addLine := func(line string, offset int64) {
+		store.AddLine(line)
+	}
 	var (
-		file *os.File
-		err  error
+		offset         int64 = 0
+		completeOffset int64 = 0
+		completeLines  int   = 0
+		partial        string
+		unterminated   bool
+		indexable      buffers.IndexableStore
 	)
 
-	if ctl.fileName != nil {
-		ctl.view.GetStatusBar().SafeStatus(view.StatusReading)
-		if file, err = os.Open(*ctl.fileName); err != nil {
+	// Switching to or from the hex dump is not a change of the file
+	reloading := doc.readCount > 0 && doc.hexShown == doc.hexMode
+	doc.readCount++
+	if reloading || ctl.autoReload {
+		doc.changes.activate()
+	}
+	doc.changes.start(reloading)
+
+	if doc.fileName != nil {
+		ctl.setStatus(doc, view.StatusReading)
+		if file, err = os.Open(*doc.fileName); err != nil {
+			log.Fatal(err)
+		}
+		if openedInfo, err = file.Stat(); err != nil {
 			log.Fatal(err)
-		} else {
-			defer file.Close()
 		}
 	} else {
-		ctl.view.GetStatusBar().SafeStatus(view.StatusReceivingData)
+		ctl.setStatus(doc, view.StatusReceivingData)
 		file = os.Stdin
 	}
-	if ctl.data == nil || ctl.data.Len() > 0 {
-		ctl.data = buffers.NewBufferedDataDefault()
+	reader := bufio.NewReader(file)
+	closeFile := doc.fileName != nil
+
+	format := detectCompression(reader)
+	var decompressor io.ReadCloser
+	if format != nil {
+		if decompressor, err = newDecompressor(format, reader); err != nil {
+			// The data is shown as it is, instead
+			ctl.safeMessage(doc, "Cannot decompress the input: %s", err.Error())
+			format = nil
+		}
+	}
+	if format != nil {
+		if closeFile {
+			defer file.Close()
+			closeFile = false
+		}
+		defer decompressor.Close()
+		reader = bufio.NewReader(decompressor)
+		if compressing, ok := store.(buffers.CompressingStore); ok {
+			compressing.SetSwapCompression(true)
+		}
+		doc.compression = format.name
+	}
+
+	// Binary data is detected first, so an encoding given explicitly does not apply to it
+	doc.encoding = detectEncoding(reader, ctl.fallbackEncoding)
+	if !doc.hexModeFixed && !doc.encoding.stream && isBinary(reader) {
+		doc.hexMode = true
+	}
+	if ctl.encoding != nil {
+		doc.encoding = ctl.encoding
+	}
+	hexMode := doc.hexMode
+	doc.hexShown = hexMode
+	var lineFilter func(string) string
+	if hexMode {
+		// Hex dump rows are much longer than the data shown, so they are kept in the compressed swap
+		doc.encoding = nil
+		if compressing, ok := store.(buffers.CompressingStore); ok {
+			compressing.SetSwapCompression(true)
+		}
+	} else {
+		if doc.encoding.stream {
+			reader = bufio.NewReader(doc.encoding.newReader(reader))
+		}
+		lineFilter = ctl.newLineFilter(doc.encoding)
+	}
+
+	if offsetStore, ok := store.(buffers.OffsetAppender); ok && format == nil && !hexMode && !doc.encoding.stream &&
+		doc.fileName != nil && offsetStore.SetSourceFile(file) == nil {
+		// Regular files are indexed by offsets, the data is not copied into the swap file.
+		closeFile = false
+		if lineFilter != nil {
+			// Frames are reloaded (and searched in parallel) by other goroutines, each of them with filters of its own
+			offsetStore.SetLineFilter(ctl.lineFilterFactory(doc.encoding))
+		}
+		addLine = offsetStore.AddLineAt
+		indexable, _ = store.(buffers.IndexableStore)
+		if entry := ctl.loadIndex(doc, file, indexable); entry != nil {
+			reader.Reset(file)
+			offset = entry.Indexed
+			completeOffset = offset
+			completeLines = store.Len()
+			doc.changes.keep(completeLines)
+			doc.maxLineLength = entry.MaxLineLength
+			ctl.view.Refresh()
+		}
 	}
+	// The file read may change, when it is replaced while followed
+	defer func() {
+		if closeFile {
+			file.Close()
+		}
+	}()
 
 	_, _, _, height := ctl.view.GetDisplayRect()
 
-	reader := bufio.NewReader(file)
-	ctl.dataReady = false
+	doc.setDataReady(false)
+	// The view is refreshed periodically, until the input is read
+	refreshDone := make(chan struct{})
 	go func() {
 		refreshPeriod := time.Duration(ctl.GetConfig().View.ViewRefreshSeconds) * time.Second
-		for !ctl.dataReady {
-			time.Sleep(refreshPeriod)
-			if !ctl.dataReady {
+		for {
+			select {
+			case <-refreshDone:
+				return
+			case <-time.After(refreshPeriod):
 				ctl.view.Refresh()
 			}
 		}
 	}()
 
-	for eof := false; !eof; {
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			if err == io.EOF {
-				eof = true
+	// readAvailable reads lines up to the end of the input; a not terminated line at the end is kept
+	// aside when there may be more data to come. It returns true when interrupted by a reload request.
+	readAvailable := func(keepPartial bool) bool {
+		for eof := false; !eof; {
+			if doc.isReloadRequested() {
+				return true
+			}
+			var (
+				raw string
+				err error
+			)
+			if hexMode {
+				raw, err = readHexRow(reader, hexRowSize-len(partial))
 			} else {
-				log.Fatal(err)
+				raw, err = reader.ReadString('\n')
 			}
-		} else {
-			if ctl.removeBackspaces {
-				line = utl.RemoveBackspaces(line)
+			if err != nil {
+				if err == io.EOF {
+					eof = true
+				} else {
+					log.Fatal(err)
+				}
 			}
-			currentLength := lengthExpandedTabs(line, ctl.conf.View.SpacesPerTab)
-			ctl.data.AddLine(line)
-			if currentLength > ctl.maxLineLength {
-				ctl.maxLineLength = currentLength
+			offset += int64(len(raw))
+			line := partial + raw
+			if eof && (keepPartial || len(line) == 0) {
+				partial = line
+				break
+			}
+			partial = ""
+			lineOffset := offset - int64(len(line))
+			if !eof {
+				completeOffset = offset
+				completeLines = doc.data.Len() + 1
+			}
+			if hexMode {
+				line = formatHexRow(lineOffset, line)
+			} else if lineFilter != nil {
+				line = lineFilter(line)
+			}
+			currentLength := lengthExpandedTabs(ctl.visibleText(line), ctl.conf.View.SpacesPerTab)
+			addLine(line, lineOffset)
+			unterminated = eof
+			doc.changes.add(line)
+			if currentLength > doc.maxLineLength {
+				doc.maxLineLength = currentLength
 			}
-			if ctl.data.Len() <= height {
+			if !doc.isDataReady() && doc.data.Len() <= height {
 				ctl.view.Refresh()
 			}
 		}
+		return false
+	}
+
+	if readAvailable(doc.isFollowing()) {
+		close(refreshDone)
+		return true
 	}
 
-	ctl.dataReady = true
-	ctl.view.GetStatusBar().SafeStatus(view.StatusReady)
+	doc.setDataReady(true)
+	close(refreshDone)
 	ctl.view.Refresh()
+	if indexable != nil {
+		ctl.saveIndex(doc, file, indexable, completeOffset, completeLines)
+	}
+	count, tracked := doc.changes.changedCount()
+	doc.changes.rebuild(doc.data)
+	ctl.setStatus(doc, doc.getReadyStatus())
+	if reloading && tracked {
+		ctl.safeMessage(doc, "File read again, %d changed lines", count)
+	}
+
+	if doc.fileName == nil {
+		return false
+	}
+	interval := time.Duration(ctl.conf.View.FollowIntervalMillis) * time.Millisecond
+	for {
+		select {
+		case <-doc.reloadRequests:
+			return true
+		case <-time.After(interval):
+		}
+		if doc.isFollowing() && doc.isFollowable() {
+			if unterminated {
+				// The last line has been added before it was complete (the file was not followed then),
+				// so it is read again as a whole, when the file grows
+				if info, err := file.Stat(); err == nil && info.Size() > offset {
+					return true
+				}
+			}
+			linesBefore := doc.data.Len()
+			if readAvailable(true) {
+				return true
+			}
+			truncated, rotated := fileReplaced(file, *doc.fileName, offset)
+			if truncated {
+				return true
+			}
+			if rotated {
+				if next, err := os.Open(*doc.fileName); err == nil {
+					// Lines written to the old file before it was renamed are read up to its end first
+					if readAvailable(false) {
+						next.Close()
+						return true
+					}
+					if closeFile {
+						file.Close()
+					}
+					file, closeFile = next, true
+					if openedInfo, err = file.Stat(); err != nil {
+						log.Fatal(err)
+					}
+					reader.Reset(file)
+					offset, partial, unterminated = 0, "", false
+					if offsetStore, ok := store.(buffers.OffsetAppender); ok {
+						// Lines of the new file are not in the source file of the store
+						addLine = func(line string, _ int64) {
+							offsetStore.AddLineAt(line, -1)
+						}
+					}
+				}
+			}
+			if doc.data.Len() > linesBefore && doc.filtered == nil {
+				ctl.onLinesAppended(doc, linesBefore)
+			}
+		} else if ctl.autoReload && fileModified(openedInfo, *doc.fileName) {
+			return true
+		}
+	}
+}
+
+// newLineFilter returns a function converting lines read to UTF-8, removing escape sequences and backspaces,
+// as requested, or nil when nothing is to be done.
+func (ctl *Controller) newLineFilter(enc *textEncoding) func(string) string {
+	return newLineFilter(enc, ctl.ansiMode == markup.AnsiStrip, ctl.removeBackspaces)
+}
+
+// lineFilterFactory returns the function making filters like newLineFilter, with the settings taken now. Every filter
+// made has a decoder of its own, so filters may be used by different goroutines at the same time.
+func (ctl *Controller) lineFilterFactory(enc *textEncoding) func() buffers.LineFilter {
+	stripAnsi, removeBackspaces := ctl.ansiMode == markup.AnsiStrip, ctl.removeBackspaces
+	return func() buffers.LineFilter {
+		return newLineFilter(enc, stripAnsi, removeBackspaces)
+	}
+}
+
+func newLineFilter(enc *textEncoding, stripAnsi bool, removeBackspaces bool) func(string) string {
+	filters := make([]func(string) string, 0, 3)
+	if decode := enc.lineDecoder(); decode != nil {
+		filters = append(filters, decode)
+	}
+	if stripAnsi {
+		filters = append(filters, markup.StripAnsi)
+	}
+	if removeBackspaces {
+		filters = append(filters, utl.RemoveBackspaces)
+	}
+	switch len(filters) {
+	case 0:
+		return nil
+	case 1:
+		return filters[0]
+	}
+	return func(line string) string {
+		for _, filter := range filters {
+			line = filter(line)
+		}
+		return line
+	}
+}
+
+// visibleText returns the text of the line as it is shown, i.e. without the escape sequences and backspaces
+// rendered.
+func (ctl *Controller) visibleText(line string) string {
+	return markup.Strip(line, ctl.ansiMode == markup.AnsiRender, ctl.overstrike)
+}
+
+func (ctl *Controller) getIndexCacheDir() string {
+	if ctl.conf.DataBuffer.IndexCache {
+		if dir := ctl.conf.GetDir(); len(dir) > 0 {
+			return path.Join(dir, indexCacheDir)
+		}
+	}
+	return ""
+}
+
+// loadIndex restores the cached index of the file into the store and positions the file
+// at the first byte not covered by it.
+func (ctl *Controller) loadIndex(doc *document, file *os.File, store buffers.IndexableStore) *indexCacheEntry {
+	if store == nil || doc.fileName == nil {
+		return nil
+	}
+	if dir := ctl.getIndexCacheDir(); len(dir) > 0 {
+		if entry := loadIndexCache(dir, file, *doc.fileName, ctl.indexSettings(doc)); entry != nil {
+			if err := store.ImportIndex(entry.Index); err == nil {
+				if _, err := file.Seek(entry.Indexed, io.SeekStart); err == nil {
+					return entry
+				}
+				log.Fatal(err)
+			}
+		}
+	}
+	return nil
+}
+
+// indexSettings describes options of reading the document, which the cached length of its longest line
+// depends on.
+func (ctl *Controller) indexSettings(doc *document) string {
+	encoding := ""
+	if doc.encoding != nil {
+		encoding = doc.encoding.name
+	}
+	return fmt.Sprintf("ansi=%d overstrike=%v backspaces=%v tab=%d encoding=%s", ctl.ansiMode, ctl.overstrike,
+		ctl.removeBackspaces, ctl.conf.View.SpacesPerTab, encoding)
+}
+
+// saveIndex stores the index of the complete (i.e. new line terminated) lines of the file in the cache.
+func (ctl *Controller) saveIndex(doc *document, file *os.File, store buffers.IndexableStore, indexed int64, lines int) {
+	if dir := ctl.getIndexCacheDir(); len(dir) > 0 && doc.fileName != nil && lines > 0 {
+		if index, err := store.ExportIndex(); err == nil {
+			index.Truncate(lines)
+			err := saveIndexCache(dir, file, *doc.fileName, ctl.indexSettings(doc), indexed, doc.maxLineLength, index)
+			if err != nil {
+				ctl.safeMessage(doc, "Cannot save the index of the file: %s", err.Error())
+			}
+		}
+	}
 }
 
 func fileExists(filename string) bool {
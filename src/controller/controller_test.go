@@ -2,14 +2,23 @@ package controller
 
 import (
 	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
 	"github.com/bry00/m/buffers"
 	"github.com/bry00/m/config"
+	"github.com/bry00/m/markup"
+	"github.com/bry00/m/utl"
 	"github.com/bry00/m/view"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"path"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 const testdataDir = "../../testdata"
@@ -26,7 +35,13 @@ type DummyTestView struct {
 	showNumbers   bool
 	showRuler     bool
 	rulerPosition int
+	wrapped       bool
 	statusBar     *DummyTestStatusBar
+	results       []view.SearchResult
+	found         int
+	complete      bool
+	shownLeft     int
+	shownTop      int
 }
 
 var testFilePath string
@@ -81,19 +96,42 @@ func (v *DummyTestView) SetController(ctl view.TheViewController) {
 	v.ctl = ctl
 }
 
-func (v *DummyTestView) StopApplication()            {}
-func (v *DummyTestView) DisplayAt(left int, top int) {}
+func (v *DummyTestView) StopApplication()              {}
+func (v *DummyTestView) DisplayAt(left int, top int)   { v.shownLeft, v.shownTop = left, top }
+func (v *DummyTestView) DisplayAtRow(top int, row int) { v.shownTop = top }
+func (v *DummyTestView) GetTopRow() int                { return 0 }
+func (v *DummyTestView) IsWrapped() bool               { return v.wrapped }
+func (v *DummyTestView) SetWrapped(wrap bool)          { v.wrapped = wrap }
 
 func (v *DummyTestView) GetDisplayRect() (int, int, int, int) {
 	return 0, 0, 0, 0
 }
 
-func (v *DummyTestView) Refresh()            {}
+func (v *DummyTestView) Refresh() {}
+func (v *DummyTestView) QueueUpdateDraw(f func()) {
+	f()
+}
 func (v *DummyTestView) ShowSearchDialog()   {}
 func (v *DummyTestView) ShowGotoLineDialog() {}
+func (v *DummyTestView) ShowDocumentList()   {}
+func (v *DummyTestView) ShowFilterDialog()   {}
 func (v *DummyTestView) Prepare()            {}
 func (v *DummyTestView) Show()               {}
 func (v *DummyTestView) ShowShortcuts()      {}
+func (v *DummyTestView) ShowSearchResults()  {}
+func (v *DummyTestView) ShowMarkList()       {}
+func (v *DummyTestView) ShowJumpList()       {}
+func (v *DummyTestView) ShowColumnList()     {}
+func (v *DummyTestView) ShowRecordFields()   {}
+
+func (v *DummyTestView) ClearSearchResults() {
+	v.results, v.found, v.complete = nil, 0, false
+}
+
+func (v *DummyTestView) AddSearchResults(results []view.SearchResult, found int, complete bool) {
+	v.results = append(v.results, results...)
+	v.found, v.complete = found, complete
+}
 
 func (v *DummyTestView) GetKeyShortcuts() map[view.Action][]string {
 	return make(map[view.Action][]string)
@@ -142,7 +180,7 @@ func TestMain(m *testing.M) {
 	}
 
 	defer theBuffer.Close()
-	theController = NewController(testFilePath, "test", theBuffer, NewDummyTestView(), config.NewDefaultConfig(),
+	theController = NewController([]string{testFilePath}, "test", theBuffer, NewDummyTestView(), config.NewDefaultConfig(),
 		false)
 	defer theController.OnExit()
 	code := m.Run()
@@ -193,7 +231,7 @@ func TestFindNext(t *testing.T) {
 	}
 	for _, v := range values {
 		theController.SetSearchText(v.SearchFor, v.Regex, false)
-		foundLine, _, _, foundLineText, err := theController.findNext(v.StartLine, 0)
+		foundLine, _, _, foundLineText, err := theController.findNext(nil, v.StartLine, 0)
 		if err != nil {
 			t.Error(err)
 		} else {
@@ -220,7 +258,7 @@ func TestFindPrevious(t *testing.T) {
 	}
 	for _, v := range values {
 		theController.SetSearchText(v.SearchFor, v.Regex, false)
-		foundLine, _, _, foundLineText, err := theController.findPrevious(v.StartLine, 0)
+		foundLine, _, _, foundLineText, err := theController.findPrevious(nil, v.StartLine, 0)
 		if err != nil {
 			t.Error(err)
 		} else {
@@ -231,3 +269,1402 @@ func TestFindPrevious(t *testing.T) {
 		}
 	}
 }
+
+func TestIndexCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "m_test_index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filePath := path.Join(dir, "data.txt")
+	content := strings.Repeat("Litwo! Ojczyzno moja! ty jesteś jak zdrowie:\n", 1000)
+	if err := ioutil.WriteFile(filePath, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	index := &buffers.FrameIndex{
+		Frames: []buffers.FrameEntry{{Offset: 0, FirstLine: 0, NoOfLines: 1000}},
+	}
+	if err := saveIndexCache(dir, file, filePath, "utf-8", int64(len(content)), 45, index); err != nil {
+		t.Fatal(err)
+	}
+	if entry := loadIndexCache(dir, file, filePath, "utf-8"); entry == nil || entry.Index.Len() != 1000 || entry.MaxLineLength != 45 {
+		t.Errorf("loadIndexCache(\"%s\") => %v; want the stored index", filePath, entry)
+	}
+	if entry := loadIndexCache(dir, file, filePath, "windows-1250"); entry != nil {
+		t.Errorf("loadIndexCache(\"%s\") with other settings => %v; want nil", filePath, entry)
+	}
+
+	appended, _ := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0600)
+	appended.WriteString("Ile cię trzeba cenić, ten tylko się dowie,\n")
+	appended.Close()
+	if entry := loadIndexCache(dir, file, filePath, "utf-8"); entry == nil || entry.Indexed != int64(len(content)) {
+		t.Errorf("loadIndexCache(\"%s\") => %v; want the index of the appended file", filePath, entry)
+	}
+
+	rewritten, _ := os.OpenFile(filePath, os.O_WRONLY, 0600)
+	rewritten.WriteAt([]byte("Kto"), int64(len(content))-10)
+	rewritten.Close()
+	if entry := loadIndexCache(dir, file, filePath, "utf-8"); entry != nil {
+		t.Errorf("loadIndexCache(\"%s\") => %v; want nil for the rewritten file", filePath, entry)
+	}
+
+	cacheDir := path.Join(dir, "cache")
+	os.Mkdir(cacheDir, 0700)
+	for i := 0; i < 5; i++ {
+		fileName := path.Join(cacheDir, fmt.Sprintf("%d%s", i, indexCacheSuffix))
+		ioutil.WriteFile(fileName, []byte{}, 0600)
+		modTime := time.Now().Add(-time.Duration(i) * time.Hour)
+		os.Chtimes(fileName, modTime, modTime)
+	}
+	ioutil.WriteFile(path.Join(cacheDir, "other.txt"), []byte{}, 0600)
+	pruneIndexCache(cacheDir, 3, 150*time.Minute)
+	infos, _ := ioutil.ReadDir(cacheDir)
+	names := []string{}
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	if got := strings.Join(names, " "); got != "0.idx 1.idx 2.idx other.txt" {
+		t.Errorf("pruneIndexCache(3) => %s; want the 3 recent index files kept", got)
+	}
+	pruneIndexCache(cacheDir, 3, 90*time.Minute)
+	if _, err := os.Stat(path.Join(cacheDir, "2.idx")); !os.IsNotExist(err) {
+		t.Errorf("pruneIndexCache() kept an index file older than the maximum age")
+	}
+}
+
+func TestDetectCompression(t *testing.T) {
+	values := []struct {
+		Expected string
+		Data     []byte
+	}{
+		{"gzip", []byte{0x1f, 0x8b, 0x08, 0x00}},
+		{"bzip2", []byte("BZh91AY&SY")},
+		{"bzip2", []byte("BZh9\x17\x72\x45\x38\x50\x90")},
+		{"", []byte("BZhello world")},
+		{"", []byte("BZh0" + "1AY&SY")},
+		{"xz", []byte{0xfd, '7', 'z', 'X', 'Z', 0x00, 0x00}},
+		{"zstd", []byte{0x28, 0xb5, 0x2f, 0xfd, 0x04}},
+		{"", []byte("Litwo! Ojczyzno moja!")},
+		{"", []byte{0x1f}},
+	}
+	for _, v := range values {
+		got := ""
+		if format := detectCompression(bufio.NewReader(bytes.NewReader(v.Data))); format != nil {
+			got = format.name
+		}
+		if got != v.Expected {
+			t.Errorf("detectCompression(%v) => \"%s\"; want \"%s\"", v.Data, got, v.Expected)
+		}
+	}
+}
+
+func TestGzipDecompressor(t *testing.T) {
+	expected := "Litwo! Ojczyzno moja! ty jesteś jak zdrowie:\n"
+	var data bytes.Buffer
+	w := gzip.NewWriter(&data)
+	w.Write([]byte(expected))
+	w.Close()
+	reader := bufio.NewReader(&data)
+	format := detectCompression(reader)
+	if format == nil {
+		t.Fatal("detectCompression => nil; want gzip")
+	}
+	decompressor, err := newDecompressor(format, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer decompressor.Close()
+	if got, err := ioutil.ReadAll(decompressor); err != nil {
+		t.Error(err)
+	} else if string(got) != expected {
+		t.Errorf("newDecompressor(gzip) => \"%s\"; want \"%s\"", string(got), expected)
+	}
+}
+
+func TestWrongGzipHeader(t *testing.T) {
+	// The magic bytes of gzip, but the header is truncated or its flags are wrong
+	for _, data := range [][]byte{{0x1f, 0x8b, 0x08, 0x00, 'L', 'i', 't'}, []byte("\x1f\x8b\x08\x04Litwo!\n")} {
+		reader := bufio.NewReader(bytes.NewReader(data))
+		format := detectCompression(reader)
+		if format == nil {
+			t.Fatalf("detectCompression(%v) => nil; want gzip", data)
+		}
+		if _, err := newDecompressor(format, reader); err == nil {
+			t.Errorf("newDecompressor(%v) => no error; want an error", data)
+		}
+		if got, _ := ioutil.ReadAll(reader); !bytes.Equal(got, data) {
+			t.Errorf("newDecompressor(%v) consumed the input => %v; want %v", data, got, data)
+		}
+	}
+}
+
+func TestMissingDecompressor(t *testing.T) {
+	data := []byte{0xfd, '7', 'z', 'X', 'Z', 0x00, 'x'}
+	reader := bufio.NewReader(bytes.NewReader(data))
+	format := *detectCompression(reader)
+	format.command = "m-test-no-such-decompressor"
+	if _, err := newDecompressor(&format, reader); err == nil {
+		t.Fatalf("newDecompressor() with a missing command => no error")
+	}
+	if got, _ := ioutil.ReadAll(reader); !bytes.Equal(got, data) {
+		t.Errorf("newDecompressor() with a missing command consumed the input => %v; want %v", got, data)
+	}
+}
+
+func TestDetectEncoding(t *testing.T) {
+	utf16le := []byte{'L', 0, 'i', 0, 't', 0, 'w', 0, 'o', 0, '!', 0, '\n', 0}
+	utf16be := []byte{0, 'L', 0, 'i', 0, 't', 0, 'w', 0, 'o', 0, '!', 0, '\n'}
+	values := []struct {
+		Expected string
+		Data     []byte
+	}{
+		{"utf-8", []byte("Litwo! Ojczyzno moja! ty jesteś jak zdrowie:")},
+		{"utf-8", []byte("\ufeffLitwo!")},
+		{"utf-8", []byte("Litwo! Ojczyzno moja! ty jeste\xc5")},
+		{"utf-16le", append([]byte{0xff, 0xfe}, utf16le...)},
+		{"utf-16be", append([]byte{0xfe, 0xff}, utf16be...)},
+		{"utf-16le", utf16le},
+		{"utf-16be", utf16be},
+		{"windows-1250", []byte("Litwo! Ojczyzno moja! ty jeste\x9c")},
+	}
+	fallback, _ := findEncoding("cp1250")
+	for _, v := range values {
+		if got := detectEncoding(bufio.NewReader(bytes.NewReader(v.Data)), fallback); got.name != v.Expected {
+			t.Errorf("detectEncoding(%v) => \"%s\"; want \"%s\"", v.Data, got.name, v.Expected)
+		}
+	}
+	if enc, err := findEncoding("Latin2"); err != nil || enc.name != "iso-8859-2" {
+		t.Errorf("findEncoding(\"Latin2\") => %v, %v; want iso-8859-2", enc, err)
+	}
+	if _, err := findEncoding("ebcdic"); err == nil {
+		t.Errorf("findEncoding(\"ebcdic\") => nil error; want an error")
+	}
+}
+
+func TestDecodeEncoding(t *testing.T) {
+	expected := "Litwo! Ojczyzno moja! ty jesteś\n"
+	cp1250, _ := findEncoding("windows-1250")
+	if got := cp1250.lineDecoder()("Litwo! Ojczyzno moja! ty jeste\x9c\n"); got != expected {
+		t.Errorf("lineDecoder(windows-1250) => \"%s\"; want \"%s\"", got, expected)
+	}
+	utf8, _ := findEncoding("utf-8")
+	if got := utf8.lineDecoder()("\ufeff" + expected); got != expected {
+		t.Errorf("lineDecoder(utf-8) => \"%s\"; want \"%s\"", got, expected)
+	}
+	var data []byte
+	for _, r := range "\ufeff" + expected {
+		data = append(data, byte(r), byte(r>>8))
+	}
+	utf16, _ := findEncoding("utf-16le")
+	if got, err := ioutil.ReadAll(utf16.newReader(bytes.NewReader(data))); err != nil {
+		t.Errorf("newReader(utf-16le) => error: %s", err.Error())
+	} else if string(got) != expected {
+		t.Errorf("newReader(utf-16le) => \"%s\"; want \"%s\"", string(got), expected)
+	}
+}
+
+func TestBinaryWithEncoding(t *testing.T) {
+	dir, err := ioutil.TempDir("", "m_test_binary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	values := []struct {
+		Data     string
+		Expected bool
+	}{
+		{"Litwo! Ojczyzno moja!\nty jeste\xb6 jak zdrowie\n", false},
+		{"Litwo!\x00\x01\x02 Ojczyzno moja!\n", true},
+	}
+	for i, v := range values {
+		filePath := path.Join(dir, fmt.Sprintf("data%d", i))
+		ioutil.WriteFile(filePath, []byte(v.Data), 0600)
+		testView := &queueTestView{DummyTestView: NewDummyTestView(), updates: make(chan func(), 1)}
+		ctl := NewController([]string{filePath}, "", buffers.NewBufferedData(1024, 8192), testView,
+			config.NewDefaultConfig(), false)
+		if err := ctl.SetEncoding("latin2"); err != nil {
+			t.Fatal(err)
+		}
+		go ctl.readFile(ctl.document)
+		for ctl.status != view.StatusReady {
+			select {
+			case update := <-testView.updates:
+				update()
+			case <-time.After(5 * time.Second):
+				t.Fatalf("file not read in time")
+			}
+		}
+		if ctl.hexShown != v.Expected {
+			t.Errorf("readInput(\"%s\") with latin2 => hex dump %v; want %v", v.Data, ctl.hexShown, v.Expected)
+		}
+		ctl.OnExit()
+	}
+}
+
+func TestHexRow(t *testing.T) {
+	values := []struct {
+		Offset   int64
+		Data     string
+		Expected string
+	}{
+		{0, "Litwo!\x00 Ojczyzno", "00000000  4c 69 74 77 6f 21 00 20  4f 6a 63 7a 79 7a 6e 6f  |Litwo!. Ojczyzno|"},
+		{0x1230, "moja!\n", "00001230  6d 6f 6a 61 21 0a                                 |moja!.|"},
+	}
+	for _, v := range values {
+		got := formatHexRow(v.Offset, v.Data)
+		if got != v.Expected {
+			t.Errorf("formatHexRow(%d, \"%s\") => \"%s\"; want \"%s\"", v.Offset, v.Data, got, v.Expected)
+		}
+		if data := parseHexRow(got); string(data) != v.Data {
+			t.Errorf("parseHexRow(\"%s\") => %v; want %v", got, data, []byte(v.Data))
+		}
+	}
+}
+
+func TestFindHex(t *testing.T) {
+	data := "Litwo! Ojczyzno moja! ty jeste\xc5\x9b jak zdrowie\x00"
+	store := buffers.NewMemoryData()
+	for offset := 0; offset < len(data); offset += hexRowSize {
+		store.AddLine(formatHexRow(int64(offset), data[offset:utl.MinInt(offset+hexRowSize, len(data))]))
+	}
+	ctl := NewController([]string{}, "", store, NewDummyTestView(), config.NewDefaultConfig(), false)
+	ctl.hexShown = true
+	values := []struct {
+		Pattern      string
+		Line         int
+		Start        int
+		End          int
+		LastLine     int
+		LastStart    int
+		PreviousLine int
+	}{
+		{"x:6f", 0, 22, 24, 0, 53, 2},
+		{"x:6f6a", 1, 13, 18, -1, -1, 1},
+		{"x:65 c5 9b 20", 1, 50, 58, -1, -1, 1},
+		{"x:00", 2, 47, 49, -1, -1, 2},
+		{"x:6f 20 6d 6f 6a 61 21 20 74 79 20 6a 65 73 74 65 c5 9b 20", 0, 53, 58, -1, -1, 0},
+		{"x:ff", -1, -1, -1, -1, -1, -1},
+		{"6f6a", -1, -1, -1, -1, -1, -1},
+		{"Ojcz", 0, 68, 72, -1, -1, 0},
+	}
+	for _, v := range values {
+		ctl.SetSearchText(v.Pattern, false, false)
+		line, start, end, _, err := ctl.findNext(nil, 0, 0)
+		if err != nil || line != v.Line || start != v.Start || end != v.End {
+			t.Errorf("findNext(\"%s\") => %d, %d, %d, %v; want %d, %d, %d", v.Pattern, line, start, end, err,
+				v.Line, v.Start, v.End)
+		}
+		if line >= 0 {
+			line, start, _, _, _ = ctl.findNext(nil, line, end)
+			if line != v.LastLine || start != v.LastStart {
+				t.Errorf("findNext(\"%s\") again => %d, %d; want %d, %d", v.Pattern, line, start, v.LastLine, v.LastStart)
+			}
+		}
+		if line, _, _, _, _ = ctl.findPrevious(nil, store.Len()-1, -1); line != v.PreviousLine {
+			t.Errorf("findPrevious(\"%s\") => %d; want %d", v.Pattern, line, v.PreviousLine)
+		}
+	}
+}
+
+func TestMoveRows(t *testing.T) {
+	store := buffers.NewMemoryData()
+	for _, line := range []string{"Litwo! Ojczyzno moja!", "", "ty jesteś\tjak zdrowie", "Ile cię trzeba cenić"} {
+		store.AddLine(line)
+	}
+	testView := NewDummyTestView()
+	testView.wrapped = true
+	ctl := NewController([]string{}, "", store, testView, config.NewDefaultConfig(), false)
+	values := []struct {
+		Line  int
+		Row   int
+		Delta int
+		Want  [2]int
+	}{
+		{0, 0, 1, [2]int{0, 1}},
+		{0, 0, 3, [2]int{1, 0}},
+		{0, 2, 2, [2]int{2, 0}},
+		{2, 0, 5, [2]int{3, 2}},
+		{2, 0, 20, [2]int{4, 0}},
+		{2, 1, -1, [2]int{2, 0}},
+		{2, 0, -2, [2]int{0, 2}},
+		{1, 0, -10, [2]int{0, 0}},
+		{4, 0, -3, [2]int{3, 0}},
+	}
+	for _, v := range values {
+		if line, row := ctl.moveRows(v.Line, v.Row, v.Delta, 8); line != v.Want[0] || row != v.Want[1] {
+			t.Errorf("moveRows(%d, %d, %d, 8) => %d, %d; want %d, %d", v.Line, v.Row, v.Delta, line, row,
+				v.Want[0], v.Want[1])
+		}
+	}
+}
+
+func TestFilters(t *testing.T) {
+	store := buffers.NewMemoryData()
+	lines := []string{
+		"Litwo! Ojczyzno moja! ty jesteś jak zdrowie:",
+		"Ile cię trzeba cenić, ten tylko się dowie,",
+		"Kto cię stracił. Dziś piękność twą w całej ozdobie",
+		"Widzę i opisuję, bo tęsknię po tobie.",
+	}
+	for _, line := range lines {
+		store.AddLine(line)
+	}
+	ctl := NewController([]string{}, "", store, NewDummyTestView(), config.NewDefaultConfig(), false)
+	ctl.setDataReady(true)
+	values := []struct {
+		Filters []string
+		Lines   []int
+	}{
+		{[]string{"+cię"}, []int{1, 2}},
+		{[]string{"-cię"}, []int{0, 3}},
+		{[]string{"+,$", "-^Ile"}, []int{}},
+		{[]string{"+[:!]", "-ozdobie"}, []int{0}},
+		{[]string{}, []int{0, 1, 2, 3}},
+	}
+	for _, v := range values {
+		filters := []*filterRule{}
+		for _, f := range v.Filters {
+			rule, err := newFilterRule(f[1:], f[0] == '-')
+			if err != nil {
+				t.Fatal(err)
+			}
+			filters = append(filters, rule)
+		}
+		filtered := buffers.NewFilteredData(store)
+		ctl.runFilters(ctl.document, filtered, store, filters, make(chan struct{}))
+		got := []int{}
+		for i := 0; i < filtered.Len(); i++ {
+			got = append(got, filtered.SourceIndex(i))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(v.Lines) {
+			t.Errorf("runFilters(%v) => %v; want %v", v.Filters, got, v.Lines)
+		}
+	}
+
+	if err := ctl.AddFilter("(", false); err == nil {
+		t.Errorf("AddFilter(\"(\") accepted a wrong pattern")
+	}
+	if err := ctl.AddFilter("cię", false); err != nil {
+		t.Fatal(err)
+	}
+	for start := time.Now(); ctl.NoOfLines() < 2 && time.Since(start) < time.Second; {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := ctl.GetSourceLine(1); ctl.NoOfLines() != 2 || got != 2 {
+		t.Errorf("GetSourceLine(1) => %d of %d lines; want 2 of 2 lines", got, ctl.NoOfLines())
+	}
+	if got := ctl.shownIndex(2); got != 1 {
+		t.Errorf("shownIndex(2) => %d; want 1", got)
+	}
+	ctl.RemoveFilter()
+	if got := ctl.NoOfLines(); got != len(lines) {
+		t.Errorf("RemoveFilter() => %d lines; want %d", got, len(lines))
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	values := []struct {
+		Query    searchQuery
+		Line     string
+		Expected string
+	}{
+		{searchQuery{text: "ty"}, "Litwo! Ojczyzno moja! ty jesteś jak zdrowie. Ty", "[[22 24]]"},
+		{searchQuery{text: "ty", ignoreCase: true}, "Litwo! Ojczyzno moja! ty jesteś jak zdrowie. Ty", "[[22 24] [46 48]]"},
+		{searchQuery{text: "moja!"}, "moja! moja!", "[[0 5] [6 11]]"},
+		{searchQuery{text: "ś."}, "jesteś jak", "[]"},
+		{searchQuery{text: "ś.", regex: true}, "jesteś jak", "[[5 8]]"},
+		{searchQuery{text: "x*", regex: true}, "axxb", "[[1 3]]"},
+		{searchQuery{text: "ZDROWIE", regex: true, ignoreCase: true}, "jak zdrowie", "[[4 11]]"},
+		{searchQuery{text: "STRASSE", ignoreCase: true}, "die Straße hier", "[[4 11]]"},
+		{searchQuery{text: "ß", ignoreCase: true}, "GROSS", "[[3 5]]"},
+		{searchQuery{text: "s", ignoreCase: true}, "ſ", "[[0 2]]"},
+		{searchQuery{text: "ı", ignoreCase: true}, "I ı i", "[[2 4]]"},
+		{searchQuery{text: "Σ", ignoreCase: true}, "ς σ", "[[0 2] [3 5]]"},
+		{searchQuery{text: "źdźbło", ignoreCase: true}, "ŹDŹBŁO i Źdźbło", "[[0 9] [12 21]]"},
+		{searchQuery{text: "ty", wholeWord: true}, "ty tyle, ty", "[[0 2] [9 11]]"},
+		{searchQuery{text: "j\\w+", regex: true, wholeWord: true}, "jak, jesteś", "[[0 3]]"},
+		{searchQuery{text: "(a", wholeWord: true}, "x(a (ab", "[[1 3]]"},
+		{searchQuery{text: "Ty", smartCase: true}, "ty Ty", "[[3 5]]"},
+		{searchQuery{text: "ty", smartCase: true}, "ty Ty", "[[0 2] [3 5]]"},
+		{searchQuery{text: "\\sst", regex: true, smartCase: true}, "x ST st", "[[1 4] [4 7]]"},
+	}
+	for _, v := range values {
+		m, err := newMatcher(v.Query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(m.findAll(v.Line)); got != v.Expected {
+			t.Errorf("findAll(%+v, \"%s\") => %s; want %s", v.Query, v.Line, got, v.Expected)
+		}
+	}
+	if _, err := newMatcher(searchQuery{text: "(", regex: true}); err == nil {
+		t.Errorf("newMatcher(\"(\") accepted a wrong regular expression")
+	}
+}
+
+func TestFindWholeWordFromColumn(t *testing.T) {
+	store := buffers.NewMemoryData()
+	for _, line := range []string{"xfoo bar", "foox bar", "bar foo"} {
+		store.AddLine(line)
+	}
+	ctl := NewController([]string{}, "", store, NewDummyTestView(), config.NewDefaultConfig(), false)
+	ctl.SetSearchText("foo", false, false)
+	ctl.SetSearchOptions(true, false, false)
+	if line, start, end, _, _ := ctl.findNext(nil, 0, 1); line != 2 || start != 4 || end != 7 {
+		t.Errorf("findNext(\"foo\", 0, 1) => %d, %d, %d; want 2, 4, 7", line, start, end)
+	}
+	if line, start, end, _, _ := ctl.findPrevious(nil, 1, 3); line != -1 || start != -1 || end != -1 {
+		t.Errorf("findPrevious(\"foo\", 1, 3) => %d, %d, %d; want -1, -1, -1", line, start, end)
+	}
+	if line, start, end, _, _ := ctl.findPrevious(nil, 2, -1); line != 2 || start != 4 || end != 7 {
+		t.Errorf("findPrevious(\"foo\", 2, -1) => %d, %d, %d; want 2, 4, 7", line, start, end)
+	}
+}
+
+func TestHighlights(t *testing.T) {
+	ctl := NewController([]string{}, "", buffers.NewMemoryData(), NewDummyTestView(), config.NewDefaultConfig(), false)
+	line := "Litwo!\tOjczyzno moja! ty jesteś jak zdrowie"
+	if got := ctl.GetHighlights(line); len(got) != 0 {
+		t.Errorf("GetHighlights() => %v; want none", got)
+	}
+	ctl.SetSearchText("o", false, false)
+	ctl.toggleMarker()
+	ctl.SetSearchText("moja", false, false)
+	ctl.toggleMarker()
+	ctl.SetSearchText("j.", true, false)
+	expected := [][]int{{4, 5}, {17, 18}, {20, 21}, {43, 44}, {19, 23}, {11, 13}, {21, 23}, {28, 30}, {36, 38}}
+	got := ctl.GetHighlights(line)
+	if len(got) != len(expected) {
+		t.Fatalf("GetHighlights() => %v; want %v", got, expected)
+	}
+	for i, span := range got {
+		if span.Start != expected[i][0] || span.End != expected[i][1] {
+			t.Errorf("GetHighlights()[%d] => %d:%d; want %d:%d", i, span.Start, span.End, expected[i][0], expected[i][1])
+		}
+	}
+	if got[0].Style == got[4].Style || got[4].Style == got[5].Style {
+		t.Errorf("GetHighlights() => the same style for different terms")
+	}
+	ctl.SetSearchText("o", false, false)
+	ctl.toggleMarker()
+	if len(ctl.markers) != 1 || ctl.markers[0].query.text != "moja" {
+		t.Errorf("toggleMarker() did not remove the marker")
+	}
+	ctl.clearMarkers()
+	ctl.DoAction(view.ActionReset)
+	if got := ctl.GetHighlights(line); len(got) != 0 {
+		t.Errorf("GetHighlights() after reset => %v; want none", got)
+	}
+}
+
+// queueTestView passes updates queued to the test, like the view passes them to the UI thread.
+type queueTestView struct {
+	*DummyTestView
+	updates chan func()
+}
+
+func (v *queueTestView) QueueUpdateDraw(f func()) {
+	v.updates <- f
+}
+
+func TestSearchJob(t *testing.T) {
+	store := buffers.NewMemoryData()
+	for i := 0; i < 1000; i++ {
+		store.AddLine(fmt.Sprintf("line %d: Litwo! Ojczyzno moja!", i))
+	}
+	store.AddLine("ty jesteś jak zdrowie")
+	testView := &queueTestView{DummyTestView: NewDummyTestView(), updates: make(chan func(), 1)}
+	ctl := NewController([]string{}, "", store, testView, config.NewDefaultConfig(), false)
+	ctl.SetSearchText("zdrowie", false, false)
+
+	percents := []int{}
+	job := ctl.newSearchJob(func(percent int) {
+		percents = append(percents, percent)
+	})
+	job.started = time.Now().Add(-time.Second)
+	// The job searches what has been set when it was created
+	doc := ctl.document
+	ctl.document = newDocument(nil, buffers.NewMemoryData(), ctl.conf)
+	ctl.SetSearchText("Litwo", false, false)
+	if line, _, _, _, err := ctl.findNext(job, 0, 0); line != 1000 || err != nil {
+		t.Errorf("findNext() => %d, %v; want %d, nil", line, err, 1000)
+	}
+	if len(percents) == 0 || percents[len(percents)-1] != 100 {
+		t.Errorf("findNext() reported progress %v; want up to 100", percents)
+	}
+	close(job.cancel)
+	if line, _, _, _, err := ctl.findNext(job, 0, 0); line != -1 || err != errSearchCancelled {
+		t.Errorf("findNext() cancelled => %d, %v; want -1, %v", line, err, errSearchCancelled)
+	}
+	if _, _, _, _, err := ctl.findPrevious(job, 1000, -1); err != errSearchCancelled {
+		t.Errorf("findPrevious() cancelled => %v; want %v", err, errSearchCancelled)
+	}
+
+	ctl.document = doc
+	ctl.DoAction(view.ActionFindFirst)
+	select {
+	case update := <-testView.updates:
+		update()
+		if ctl.foundLine != 1000 || ctl.foundStart != 15 {
+			t.Errorf("ActionFindFirst => %d:%d; want %d:%d", ctl.foundLine, ctl.foundStart, 1000, 15)
+		}
+		if ctl.search != nil {
+			t.Errorf("ActionFindFirst => the search is still running")
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("ActionFindFirst did not complete")
+	}
+}
+
+func TestFileReplaced(t *testing.T) {
+	dir, err := ioutil.TempDir("", "m_test_follow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filePath := path.Join(dir, "data.log")
+	content := "Litwo! Ojczyzno moja!\n"
+	ioutil.WriteFile(filePath, []byte(content), 0600)
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	offset := int64(len(content))
+
+	if truncated, rotated := fileReplaced(file, filePath, offset); truncated || rotated {
+		t.Errorf("fileReplaced(\"%s\") => %t, %t; want false, false for the same file", filePath, truncated, rotated)
+	}
+	ioutil.WriteFile(filePath, []byte("Litwo!\n"), 0600)
+	if truncated, rotated := fileReplaced(file, filePath, offset); !truncated || rotated {
+		t.Errorf("fileReplaced(\"%s\") => %t, %t; want true, false for the truncated file", filePath, truncated, rotated)
+	}
+	os.Rename(filePath, filePath+".1")
+	ioutil.WriteFile(filePath, []byte(content+content), 0600)
+	if truncated, rotated := fileReplaced(file, filePath, 0); truncated || !rotated {
+		t.Errorf("fileReplaced(\"%s\") => %t, %t; want false, true for the rotated file", filePath, truncated, rotated)
+	}
+}
+
+func TestFollowRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "m_test_follow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filePath := path.Join(dir, "data.log")
+	ioutil.WriteFile(filePath, []byte("Litwo!\n"), 0600)
+	conf := config.NewDefaultConfig()
+	conf.View.FollowIntervalMillis = 10
+	testView := &queueTestView{DummyTestView: NewDummyTestView(), updates: make(chan func(), 1)}
+	ctl := NewController([]string{filePath}, "", buffers.NewBufferedData(1024, 8192), testView, conf, false)
+	// The reader keeps running, its data is not closed, but it stays idle when the file is not followed
+	defer ctl.SetFollowing(false)
+	ctl.SetFollowing(true)
+	go ctl.readFile(ctl.document)
+	// The test runs updates of the reader, like the UI thread, until the condition is met
+	waitFor := func(what string, done func() bool) {
+		for deadline := time.Now().Add(5 * time.Second); !done(); {
+			select {
+			case update := <-testView.updates:
+				update()
+			case <-time.After(10 * time.Millisecond):
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%s not read in time", what)
+			}
+		}
+	}
+	waitFor("the file", func() bool { return ctl.status == view.StatusFollowing })
+	// The last line is written to the old file without its end, just before the file is renamed
+	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString("Ojczyzno moja!")
+	file.Close()
+	os.Rename(filePath, filePath+".1")
+	ioutil.WriteFile(filePath, []byte("Ty jesteś jak zdrowie.\n"), 0600)
+	expected := []string{"Litwo!", "Ojczyzno moja!", "Ty jesteś jak zdrowie."}
+	waitFor("the new file", func() bool {
+		_, err := ctl.data.GetLine(len(expected) - 1)
+		return err == nil
+	})
+	for i, want := range expected {
+		if got, err := ctl.data.GetLine(i); err != nil || got != want {
+			t.Errorf("GetLine(%d) of the rotated file => \"%s\", %v; want \"%s\"", i, got, err, want)
+		}
+	}
+}
+
+func TestFollowPartialLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "m_test_follow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filePath := path.Join(dir, "data.log")
+	ioutil.WriteFile(filePath, []byte("Litwo!\nOjczyzno"), 0600)
+	conf := config.NewDefaultConfig()
+	conf.View.FollowIntervalMillis = 10
+	testView := &queueTestView{DummyTestView: NewDummyTestView(), updates: make(chan func(), 1)}
+	ctl := NewController([]string{filePath}, "", buffers.NewBufferedData(1024, 8192), testView, conf, false)
+	// The reader keeps running, its data is not closed, but it stays idle when the file is not followed
+	defer ctl.SetFollowing(false)
+	go ctl.readFile(ctl.document)
+	for ctl.status != view.StatusReady {
+		select {
+		case update := <-testView.updates:
+			update()
+		case <-time.After(5 * time.Second):
+			t.Fatalf("file not read in time")
+		}
+	}
+	// The line not terminated is shown, as the file is not followed, then it is completed
+	if got, err := ctl.data.GetLine(1); err != nil || got != "Ojczyzno" {
+		t.Errorf("GetLine(1) of the file not followed => \"%s\", %v; want \"Ojczyzno\"", got, err)
+	}
+	ctl.SetFollowing(true)
+	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(" moja!\n")
+	file.Close()
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		select {
+		case update := <-testView.updates:
+			update()
+		case <-time.After(10 * time.Millisecond):
+		}
+		if ctl.status == view.StatusFollowing {
+			if got, err := ctl.data.GetLine(1); err == nil && got == "Ojczyzno moja!" {
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the line completed not read in time")
+		}
+	}
+	if got := ctl.data.Len(); got != 2 {
+		t.Errorf("Len() of the followed file => %d; want 2", got)
+	}
+}
+
+func TestChangeTracker(t *testing.T) {
+	tracker := newChangeTracker(100)
+	tracker.start(false)
+	tracker.add("Litwo!")
+	if tracker.hashes != nil {
+		t.Errorf("changeTracker.add() before activate() => %d hashes; want none", len(tracker.hashes))
+	}
+	tracker.activate()
+	tracker.start(false)
+	for _, line := range []string{"Litwo!", "Ojczyzno moja!", "ty jesteś jak zdrowie:", "Litwo!"} {
+		tracker.add(line)
+	}
+	tracker.start(true)
+	for _, line := range []string{"Ojczyzno moja!", "Litwo!", "ty jesteś jak zdrowie!", "Litwo!", "Litwo!"} {
+		tracker.add(line)
+	}
+	expected := []bool{false, false, true, false, true}
+	for i, e := range expected {
+		if got := tracker.isChanged(i); got != e {
+			t.Errorf("changeTracker.isChanged(%d) => %v; want %v", i, got, e)
+		}
+	}
+	if count, tracked := tracker.changedCount(); count != 2 || !tracked {
+		t.Errorf("changeTracker.changedCount() => %d, %v; want 2, true", count, tracked)
+	}
+}
+
+func TestSwitchDocument(t *testing.T) {
+	dir, err := ioutil.TempDir("", "m_test_docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	contents := []string{"Litwo!\n", "Ojczyzno moja!\nty jesteś jak zdrowie.\n"}
+	var fileNames []string
+	for i, content := range contents {
+		filePath := path.Join(dir, fmt.Sprintf("data%d.log", i))
+		ioutil.WriteFile(filePath, []byte(content), 0600)
+		fileNames = append(fileNames, filePath)
+	}
+	testView := &queueTestView{DummyTestView: NewDummyTestView(), updates: make(chan func(), 1)}
+	ctl := NewController(fileNames, "", buffers.NewBufferedData(1024, 8192), testView, config.NewDefaultConfig(),
+		false)
+	defer ctl.OnExit()
+	for _, doc := range ctl.docs {
+		go ctl.readFile(doc)
+	}
+	// The test runs updates of the readers, like the UI thread, until all the documents are read
+	for ready := 0; ready < len(ctl.docs); {
+		select {
+		case update := <-testView.updates:
+			update()
+		case <-time.After(5 * time.Second):
+			t.Fatalf("documents not read in time")
+		}
+		ready = 0
+		for _, doc := range ctl.docs {
+			if doc.status == view.StatusReady {
+				ready++
+			}
+		}
+	}
+	for i, content := range append(contents, contents[0]) {
+		expected := strings.Count(content, "\n")
+		if current, count := ctl.GetDocumentIndex(); current != i%len(contents) || count != len(contents) {
+			t.Errorf("GetDocumentIndex() => %d, %d; want %d, %d", current, count, i%len(contents), len(contents))
+		}
+		if got := ctl.data.Len(); got != expected {
+			t.Errorf("document %d: Len() => %d; want %d", i, got, expected)
+		}
+		ctl.switchDocumentBy(1)
+	}
+}
+
+func TestSearchResults(t *testing.T) {
+	store := buffers.NewMemoryData()
+	for i := 0; i < 3000; i++ {
+		if i%100 == 7 {
+			store.AddLine(fmt.Sprintf("line %d:\tLitwo! Ojczyzno moja!", i))
+		} else {
+			store.AddLine(fmt.Sprintf("line %d: ty jesteś jak zdrowie", i))
+		}
+	}
+	testView := &queueTestView{DummyTestView: NewDummyTestView(), updates: make(chan func(), 1)}
+	ctl := NewController([]string{}, "", store, testView, config.NewDefaultConfig(), false)
+	ctl.setDataReady(true)
+	ctl.SetSearchText("ojczyzno", false, true)
+	ctl.DoAction(view.ActionSearchResults)
+	for !testView.complete {
+		select {
+		case update := <-testView.updates:
+			update()
+		case <-time.After(5 * time.Second):
+			t.Fatal("ActionSearchResults did not complete")
+		}
+	}
+	if testView.found != 30 || len(testView.results) != 30 {
+		t.Fatalf("ActionSearchResults => %d lines found, %d listed; want 30, 30", testView.found, len(testView.results))
+	}
+	if got := testView.results[1]; got.LineNo != 108 || got.Text[got.Start:got.End] != "Ojczyzno" {
+		t.Errorf("ActionSearchResults => %d \"%s\"; want %d \"%s\"", got.LineNo, got.Text[got.Start:got.End], 108, "Ojczyzno")
+	}
+	ctl.GotoSearchResult(2)
+	if ctl.foundLine != 207 || ctl.shownLine != 207 || ctl.searchLastRow != 207 {
+		t.Errorf("GotoSearchResult(2) => %d, %d; want %d, %d", ctl.foundLine, ctl.shownLine, 207, 207)
+	}
+	if r := ctl.resultsOfSearch(); r == nil || r.matchIndex(2907) != 29 || r.matchIndex(2906) != -1 {
+		t.Errorf("searchResults.matchIndex() => wrong index")
+	} else if got := r.describeMatch(29); got != "Match 30 of 30" {
+		t.Errorf("searchResults.describeMatch(29) => \"%s\"; want \"%s\"", got, "Match 30 of 30")
+	}
+	ctl.SetSearchText("zdrowie", false, false)
+	if ctl.resultsOfSearch() != nil {
+		t.Errorf("resultsOfSearch() => results of another search")
+	}
+	ctl.DoAction(view.ActionReset)
+	if ctl.results != nil {
+		t.Errorf("ActionReset => search results kept")
+	}
+}
+
+func TestSearchResultsNotListed(t *testing.T) {
+	store := buffers.NewMemoryData()
+	for i := 0; i < maxListedResults+5; i++ {
+		store.AddLine(fmt.Sprintf("line %d: Litwo! Ojczyzno moja!", i))
+	}
+	testView := &queueTestView{DummyTestView: NewDummyTestView(), updates: make(chan func(), 1)}
+	ctl := NewController([]string{}, "", store, testView, config.NewDefaultConfig(), false)
+	ctl.setDataReady(true)
+	ctl.SetSearchText("litwo", false, true)
+	ctl.DoAction(view.ActionSearchResults)
+	for !testView.complete {
+		select {
+		case update := <-testView.updates:
+			update()
+		case <-time.After(5 * time.Second):
+			t.Fatal("ActionSearchResults did not complete")
+		}
+	}
+	if testView.found != maxListedResults+5 || len(testView.results) != maxListedResults {
+		t.Fatalf("ActionSearchResults => %d lines found, %d listed; want %d, %d", testView.found,
+			len(testView.results), maxListedResults+5, maxListedResults)
+	}
+	r := ctl.resultsOfSearch()
+	if r == nil || len(r.entries) != maxListedResults || len(r.unlisted) != 5 {
+		t.Fatalf("ActionSearchResults => results of lines not listed kept")
+	}
+	if got := r.matchIndex(maxListedResults + 3); got != maxListedResults+3 {
+		t.Errorf("searchResults.matchIndex(%d) => %d; want %d", maxListedResults+3, got, maxListedResults+3)
+	} else if got, want := r.describeMatch(got), fmt.Sprintf("Match %d of %d", maxListedResults+4,
+		maxListedResults+5); got != want {
+		t.Errorf("searchResults.describeMatch(%d) => \"%s\"; want \"%s\"", maxListedResults+3, got, want)
+	}
+}
+
+func TestIncrementalSearch(t *testing.T) {
+	store := buffers.NewMemoryData()
+	for i := 0; i < 100; i++ {
+		store.AddLine(fmt.Sprintf("line %d: Litwo! Ojczyzno moja!", i))
+	}
+	store.AddLine("ty jesteś jak zdrowie")
+	testView := &queueTestView{DummyTestView: NewDummyTestView(), updates: make(chan func(), 1)}
+	ctl := NewController([]string{}, "", store, testView, config.NewDefaultConfig(), false)
+	ctl.setDataReady(true)
+	ctl.SetSearchText("moja", false, false)
+	ctl.searchLastRow, ctl.searchLastCol = -1, -1
+
+	ctl.BeginIncrementalSearch()
+	values := []struct {
+		Text      string
+		Regex     bool
+		Found     bool
+		FoundLine int
+	}{
+		{"zd", false, true, 100},
+		{"zdx", false, false, -1},
+		{"Ojcz", false, true, 0},
+		{"[a-", true, false, -1},
+		{"jak\\s+z", true, true, 100},
+	}
+	for _, v := range values {
+		result := make(chan bool, 1)
+		ctl.IncrementalSearch(v.Text, v.Regex, false, func(found bool) {
+			result <- found
+		})
+		select {
+		case found := <-result:
+			if found != v.Found || ctl.foundLine != v.FoundLine {
+				t.Errorf("IncrementalSearch(\"%s\") => %v, %d; want %v, %d", v.Text, found, ctl.foundLine, v.Found, v.FoundLine)
+			}
+			continue
+		default:
+		}
+		select {
+		case update := <-testView.updates:
+			update()
+		case <-time.After(5 * time.Second):
+			t.Fatalf("IncrementalSearch(\"%s\") did not complete", v.Text)
+		}
+		if found := <-result; found != v.Found || ctl.foundLine != v.FoundLine {
+			t.Errorf("IncrementalSearch(\"%s\") => %v, %d; want %v, %d", v.Text, found, ctl.foundLine, v.Found, v.FoundLine)
+		}
+	}
+	ctl.EndIncrementalSearch(true)
+	if ctl.searchString != "moja" || ctl.foundLine != -1 || ctl.searchLastRow != -1 || ctl.incremental != nil {
+		t.Errorf("EndIncrementalSearch(true) => \"%s\", %d, %d; want \"%s\", %d, %d",
+			ctl.searchString, ctl.foundLine, ctl.searchLastRow, "moja", -1, -1)
+	}
+	ctl.BeginIncrementalSearch()
+	ctl.EndIncrementalSearch(false)
+	if ctl.searchLastRow != 0 || ctl.searchLastCol != 0 {
+		t.Errorf("EndIncrementalSearch(false) => %d:%d; want %d:%d", ctl.searchLastRow, ctl.searchLastCol, 0, 0)
+	}
+}
+
+func TestWrapAround(t *testing.T) {
+	store := buffers.NewMemoryData()
+	for _, line := range []string{"alpha", "beta", "alpha beta", "gamma"} {
+		store.AddLine(line)
+	}
+	ctl := NewController([]string{}, "", store, NewDummyTestView(), config.NewDefaultConfig(), false)
+	ctl.setDataReady(true)
+	values := []struct {
+		Text       string
+		Forward    bool
+		WrapAround bool
+		Line       int
+		Column     int
+		FoundLine  int
+		Wrapped    bool
+	}{
+		{"beta", true, true, 0, 0, 1, false},
+		{"alpha", true, false, 3, 0, -1, false},
+		{"alpha", true, true, 3, 0, 0, true},
+		{"beta", true, true, 2, 10, 1, true},
+		{"gamma", false, false, 0, 0, -1, false},
+		{"gamma", false, true, 0, 0, 3, true},
+		{"delta", true, true, 2, 0, -1, false},
+		{"delta", false, true, 2, 0, -1, false},
+	}
+	for _, v := range values {
+		ctl.SetSearchOptions(false, false, v.WrapAround)
+		ctl.SetSearchText(v.Text, false, false)
+		line, _, _, _, wrapped, err := ctl.findWrapping(nil, v.Forward, ctl.searchWrapAround, v.Line, v.Column)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != v.FoundLine || wrapped != v.Wrapped {
+			t.Errorf("findWrapping(\"%s\", %v, %v, %d, %d) => %d, %v; want %d, %v",
+				v.Text, v.Forward, v.WrapAround, v.Line, v.Column, line, wrapped, v.FoundLine, v.Wrapped)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	fileName := path.Join(t.TempDir(), historyFile)
+	h := loadHistory(fileName, 3)
+	for _, text := range []string{"ala", "ma", "kota", "ma", "psa"} {
+		h.addSearch(searchHistoryEntry{Text: text, Regex: text == "psa"})
+	}
+	for _, lineNo := range []int{10, 20, 10} {
+		h.addGoto(lineNo)
+	}
+	if err := h.save(); err != nil {
+		t.Fatal(err)
+	}
+	h = loadHistory(fileName, 2)
+	if got, want := fmt.Sprint(h.Search), "[{psa true false} {ma false false}]"; got != want {
+		t.Errorf("loadHistory(...).Search => %s; want %s", got, want)
+	}
+	if got, want := fmt.Sprint(h.Goto), "[10 20]"; got != want {
+		t.Errorf("loadHistory(...).Goto => %s; want %s", got, want)
+	}
+	if h := loadHistory(path.Join(t.TempDir(), historyFile), 3); len(h.Search) != 0 || len(h.Goto) != 0 {
+		t.Errorf("loadHistory(missing file) => %v, %v; want empty history", h.Search, h.Goto)
+	}
+
+	// Another instance of the program saves its history meanwhile
+	h = loadHistory(fileName, 3)
+	other := loadHistory(fileName, 3)
+	other.addGoto(30)
+	if err := other.save(); err != nil {
+		t.Fatal(err)
+	}
+	h.refresh()
+	h.addGoto(50)
+	if got, want := fmt.Sprint(h.Goto), "[50 30 10]"; got != want {
+		t.Errorf("history.refresh() => %s; want %s", got, want)
+	}
+	h.size = 5
+	h.Goto = []int{20, 40}
+	h.refresh()
+	if got, want := fmt.Sprint(h.Goto), "[30 10 20 40]"; got != want {
+		t.Errorf("history.refresh() => %s; want %s", got, want)
+	}
+}
+
+func TestMarks(t *testing.T) {
+	store := buffers.NewMemoryData()
+	for i := 0; i < 10; i++ {
+		store.AddLine(fmt.Sprintf("line %d", i))
+	}
+	ctl := NewController([]string{}, "", store, NewDummyTestView(), config.NewDefaultConfig(), false)
+	ctl.setDataReady(true)
+	ctl.SetMark('a')
+	ctl.SetMark('1')
+	if got := ctl.GetMarks(); len(got) != 1 || got[0].Name != 'a' || got[0].LineNo != 1 || got[0].Text != "line 0" {
+		t.Errorf("GetMarks() => %v; want [{a 1 line 0}]", got)
+	}
+	if mark := ctl.GetLineMark(0); mark != 'a' {
+		t.Errorf("GetLineMark(0) => %q; want %q", mark, 'a')
+	}
+	ctl.marks['b'] = 7
+	ctl.GotoMark('b')
+	if ctl.shownLine != 7 {
+		t.Errorf("GotoMark('b') => line %d; want %d", ctl.shownLine, 7)
+	}
+	ctl.DeleteMark('a')
+	if mark := ctl.GetLineMark(0); mark != 0 {
+		t.Errorf("GetLineMark(0) after DeleteMark('a') => %q; want none", mark)
+	}
+
+	dir := t.TempDir()
+	fileName := path.Join(dir, marksFile)
+	filePath := path.Join(dir, "data.txt")
+	if err := ioutil.WriteFile(filePath, []byte("line 0\nline 1\nline 2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveMarks(fileName, filePath, map[rune]int{'a': 1, 'z': 2}); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(loadMarks(fileName, filePath)); got != "map[97:1 122:2]" {
+		t.Errorf("loadMarks(...) => %s; want %s", got, "map[97:1 122:2]")
+	}
+	if got := loadMarks(fileName, path.Join(dir, "other.txt")); got != nil {
+		t.Errorf("loadMarks(other file) => %v; want nil", got)
+	}
+	if err := ioutil.WriteFile(filePath, []byte("line 0\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if got := loadMarks(fileName, filePath); got != nil {
+		t.Errorf("loadMarks(rewritten file) => %v; want nil", got)
+	}
+}
+
+func TestJumpList(t *testing.T) {
+	at := func(top int) jumpPosition { return jumpPosition{top: top, line: -1} }
+	var j jumpList
+	if _, ok := j.back(at(0)); ok {
+		t.Errorf("back() on an empty list => true; want false")
+	}
+	j.push(at(0))
+	j.push(at(10))
+	j.push(at(10))
+	values := []struct {
+		Back bool
+		Top  int
+		OK   bool
+	}{
+		{true, 10, true},
+		{true, 0, true},
+		{true, 0, false},
+		{false, 10, true},
+		{false, 20, true},
+		{false, 20, false},
+		{true, 10, true},
+	}
+	here := at(20)
+	for i, v := range values {
+		var p jumpPosition
+		var ok bool
+		if v.Back {
+			p, ok = j.back(here)
+		} else {
+			p, ok = j.forward()
+		}
+		if ok {
+			here = p
+		}
+		if ok != v.OK || here.top != v.Top {
+			t.Errorf("#%d back=%v => %d, %v; want %d, %v", i, v.Back, here.top, ok, v.Top, v.OK)
+		}
+	}
+	j.push(at(15))
+	if got := fmt.Sprint(j.entries); got != "[{0 0 0 -1} {0 15 0 -1}]" {
+		t.Errorf("push() after going back => %s; want positions 0, 15", got)
+	}
+	for i := 0; i < maxJumps+10; i++ {
+		j.push(at(i))
+	}
+	if len(j.entries) != maxJumps || j.entries[0].top != 10 || j.current != maxJumps {
+		t.Errorf("push() => %d entries from %d; want %d entries from %d", len(j.entries), j.entries[0].top, maxJumps, 10)
+	}
+
+	store := buffers.NewMemoryData()
+	for i := 0; i < 10; i++ {
+		store.AddLine(fmt.Sprintf("line %d", i))
+	}
+	ctl := NewController([]string{}, "", store, NewDummyTestView(), config.NewDefaultConfig(), false)
+	ctl.setDataReady(true)
+	ctl.pointedLine = 5
+	ctl.DoAction(view.ActionGotoLine)
+	ctl.DoAction(view.ActionJumpBack)
+	if ctl.shownLine != -1 {
+		t.Errorf("ActionJumpBack => line %d; want %d", ctl.shownLine, -1)
+	}
+	ctl.DoAction(view.ActionJumpForward)
+	if ctl.shownLine != 4 {
+		t.Errorf("ActionJumpForward => line %d; want %d", ctl.shownLine, 4)
+	}
+	if jumps := ctl.GetJumps(); len(jumps) != 2 || !jumps[0].Current || jumps[1].Text != "line 0" {
+		t.Errorf("GetJumps() => %v; want 2 jumps, the recent one current", jumps)
+	}
+}
+
+func TestSplitFields(t *testing.T) {
+	values := []struct {
+		Line      string
+		Delimiter rune
+		Fields    []string
+	}{
+		{"a,b,c", ',', []string{"a", "b", "c"}},
+		{"a,,c,", ',', []string{"a", "", "c", ""}},
+		{"\"a,b\",c", ',', []string{"a,b", "c"}},
+		{"\"say \"\"hi\"\"\",x", ',', []string{"say \"hi\"", "x"}},
+		{"a\"b,c", ',', []string{"a\"b", "c"}},
+		{"  one \t two  three ", 0, []string{"one", "two", "three"}},
+		{"\"one two\" three", 0, []string{"one two", "three"}},
+		{"", ',', nil},
+		{"żółw;jeż", ';', []string{"żółw", "jeż"}},
+	}
+	for _, v := range values {
+		if got := splitFields(v.Line, v.Delimiter, '"'); !reflect.DeepEqual(got, v.Fields) {
+			t.Errorf("splitFields(%q, %q) => %q; want %q", v.Line, v.Delimiter, got, v.Fields)
+		}
+	}
+}
+
+func TestDetectDelimiter(t *testing.T) {
+	values := []struct {
+		Lines     []string
+		Delimiter rune
+	}{
+		{[]string{"a,b,c", "1,2,3", "4,5,6"}, ','},
+		{[]string{"a\tb", "1\t2", "3\t4"}, '\t'},
+		{[]string{"a;b,c;d", "1;2,3;4", "5;6;7"}, ';'},
+		{[]string{"\"a;b\",c", "1,2", "3,4"}, ','},
+		{[]string{"one two", "three four"}, 0},
+	}
+	for _, v := range values {
+		if got := detectDelimiter(v.Lines, '"'); got != v.Delimiter {
+			t.Errorf("detectDelimiter(%q) => %q; want %q", v.Lines, got, v.Delimiter)
+		}
+	}
+}
+
+func TestTableLayout(t *testing.T) {
+	layout := newTableLayout([]string{"id,name,city", "1,Anna,Kraków", "22,Bartholomew,Łódź"}, -1, '"', 8, true,
+		markup.Style{})
+	if !reflect.DeepEqual(layout.widths, []int{2, 8, 6}) || layout.columnName(1) != "name" {
+		t.Errorf("newTableLayout() => widths %v, name %q; want [2 8 6], \"name\"", layout.widths, layout.columnName(1))
+	}
+	values := []struct {
+		Columns []int
+		Line    string
+		Text    string
+	}{
+		{nil, "1,Anna,Kraków", "1  │ Anna     │ Kraków"},
+		{nil, "22,Bartholomew,Łódź", "22 │ Barthol… │ Łódź"},
+		{nil, "3,Ola,,extra", "3  │ Ola      │        │ extra"},
+		{nil, "4", "4  │          │"},
+		{[]int{2, 0}, "1,Anna,Kraków", "Kraków │ 1"},
+		{[]int{2, 0}, "3,Ola,,extra", "       │ 3"},
+	}
+	for _, v := range values {
+		l := layout
+		if v.Columns != nil {
+			l = layout.withColumns(v.Columns)
+		}
+		if got := l.format(v.Line); got != v.Text {
+			t.Errorf("format(%q) with columns %v => %q; want %q", v.Line, v.Columns, got, v.Text)
+		}
+	}
+	if starts := layout.columnStarts(); !reflect.DeepEqual(starts, []int{0, 5, 16}) || layout.width() != 22 {
+		t.Errorf("columnStarts() => %v, width() => %d; want [0 5 16], 22", starts, layout.width())
+	}
+}
+
+func TestTableMode(t *testing.T) {
+	store := buffers.NewMemoryData()
+	store.AddLine("id,name")
+	for i := 0; i < 20; i++ {
+		store.AddLine(fmt.Sprintf("%d,item %d", i, i))
+	}
+	ctl := NewController([]string{}, "", store, NewDummyTestView(), config.NewDefaultConfig(), false)
+	ctl.setDataReady(true)
+	ctl.DoAction(view.ActionTableMode)
+	if ctl.table == nil || ctl.table.delimiter != ',' {
+		t.Fatalf("ActionTableMode => no table with \",\" delimiter")
+	}
+	if text, _ := ctl.ParseLine("5,item 5"); text != "5  │ item 5" {
+		t.Errorf("ParseLine() => %q; want %q", text, "5  │ item 5")
+	}
+	if rows := ctl.lineRows(6, 10); rows != 2 {
+		t.Errorf("lineRows(6, 10) => %d; want 2", rows)
+	}
+	if header, _ := ctl.GetTableHeader(); header != "id │ name" {
+		t.Errorf("GetTableHeader() => %q; want %q", header, "id │ name")
+	}
+	if top := ctl.frozenTop(); top != 1 {
+		t.Errorf("frozenTop() with the header pinned => %d; want 1", top)
+	}
+	ctl.SetSearchText("name", false, false)
+	if line, _, _, _, _ := ctl.findNext(nil, 0, 0); line != -1 {
+		t.Errorf("findNext(\"name\") with the header pinned => %d; want -1", line)
+	}
+	ctl.SetSearchText("i", false, false)
+	if line, _, _, _, _ := ctl.findPrevious(nil, 1, 1); line != -1 {
+		t.Errorf("findPrevious(\"i\", 1, 1) with the header pinned => %d; want -1", line)
+	}
+	if line, _, _, _, _ := ctl.findNext(nil, 0, 0); line != 1 {
+		t.Errorf("findNext(\"i\", 0, 0) with the header pinned => %d; want 1", line)
+	}
+	if left := ctl.moveColumn(0, true); left != 5 {
+		t.Errorf("moveColumn(0, true) => %d; want 5", left)
+	}
+	if left := ctl.moveColumn(7, false); left != 5 {
+		t.Errorf("moveColumn(7, false) => %d; want 5", left)
+	}
+	ctl.SetTableColumns([]int{1})
+	if columns := ctl.GetTableColumns(); len(columns) != 2 || columns[0].Name != "name" || columns[1].Shown {
+		t.Errorf("GetTableColumns() => %v; want name shown, id hidden", columns)
+	}
+	ctl.DoAction(view.ActionTableMode)
+	if ctl.table != nil {
+		t.Errorf("ActionTableMode twice => table mode on; want off")
+	}
+}
+
+func TestFreeze(t *testing.T) {
+	conf := config.NewDefaultConfig()
+	conf.Freeze = append(conf.Freeze, config.CnfFreeze{Pattern: "access*.log", Lines: 0, Columns: 26})
+	values := []struct {
+		FileName string
+		Lines    int
+		Columns  int
+	}{
+		{"/tmp/report.csv", 1, 0},
+		{"/tmp/REPORT.CSV", 1, 0},
+		{"/tmp/data.tsv", 1, 0},
+		{"/var/log/access-2020.log", 0, 26},
+		{"/var/log/error.log", 0, 0},
+		{"", 0, 0},
+	}
+	for _, v := range values {
+		fileName := &v.FileName
+		if len(v.FileName) == 0 {
+			fileName = nil
+		}
+		if rule := freezeRule(conf, fileName); rule.Lines != v.Lines || rule.Columns != v.Columns {
+			t.Errorf("freezeRule(%q) => %d lines, %d columns; want %d, %d", v.FileName, rule.Lines, rule.Columns,
+				v.Lines, v.Columns)
+		}
+	}
+
+	store := buffers.NewMemoryData()
+	store.AddLine("TIME      MESSAGE")
+	for i := 0; i < 10; i++ {
+		store.AddLine(fmt.Sprintf("12:00:%02d  message %d", i, i))
+	}
+	dummy := NewDummyTestView()
+	ctl := NewController([]string{}, "", store, dummy, conf, false)
+	ctl.setDataReady(true)
+	ctl.DoAction(view.ActionFreezeLines)
+	ctl.DoAction(view.ActionTop)
+	if ctl.frozenLines != 1 || dummy.shownTop != 1 {
+		t.Errorf("ActionFreezeLines => %d lines frozen, top %d; want 1, 1", ctl.frozenLines, dummy.shownTop)
+	}
+	if frozen := ctl.GetFrozenLines(); len(frozen) != 1 || frozen[0].LineIndex != 0 || frozen[0].Text != "TIME      MESSAGE" {
+		t.Errorf("GetFrozenLines() => %v; want the first line", frozen)
+	}
+	if err := ctl.AddFilter("message [5-9]", false); err != nil {
+		t.Fatal(err)
+	}
+	for start := time.Now(); ctl.NoOfLines() < 5 && time.Since(start) < time.Second; {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if frozen := ctl.GetFrozenLines(); len(frozen) != 1 || frozen[0].LineIndex != -1 || ctl.frozenTop() != 0 {
+		t.Errorf("GetFrozenLines() when filtered => %v, top %d; want the first line not shown, top 0", frozen,
+			ctl.frozenTop())
+	}
+	ctl.ClearFilters()
+	ctl.DoAction(view.ActionFreezeColumns)
+	if ctl.frozenColumns != 0 {
+		t.Errorf("ActionFreezeColumns at the left => %d columns frozen; want 0", ctl.frozenColumns)
+	}
+	ctl.frozenColumns = 10
+	ctl.DoAction(view.ActionHome)
+	if dummy.shownLeft != 10 || ctl.GetFrozenColumns() != 10 {
+		t.Errorf("ActionHome with 10 columns frozen => left %d; want 10", dummy.shownLeft)
+	}
+	ctl.DoAction(view.ActionFreezeLines)
+	ctl.DoAction(view.ActionFreezeColumns)
+	ctl.DoAction(view.ActionTop)
+	if ctl.frozenLines != 0 || ctl.frozenColumns != 0 || dummy.shownTop != 0 {
+		t.Errorf("freeze actions twice => %d lines, %d columns frozen, top %d; want 0, 0, 0", ctl.frozenLines,
+			ctl.frozenColumns, dummy.shownTop)
+	}
+}
+
+func TestLayout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "m_test_layout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := []struct {
+		Name    string
+		Content string
+		Error   string
+	}{
+		{"customer.yaml", "name: customer\nfields:\n  - {name: NAME, start: 9, length: 12, type: char}\n" +
+			"  - {name: ID, start: 1, length: 8, type: numeric}\n  - {name: AMOUNT, start: 21, length: 7, type: decimal}\n",
+			""},
+		{"customer.txt", "# customer record\nID 1 8 numeric\n\nNAME 9 12 char\nAMOUNT 21 7 decimal\n", ""},
+		{"wrong.txt", "ID 1\n", "line 1"},
+		{"zero.txt", "ID 0 8\n", "line 1"},
+		{"empty.yaml", "name: empty\n", "no fields"},
+		{"overlap.txt", "ID 1 8\nNAME 8 12\n", "line 2: fields ID and NAME overlap"},
+		{"twice.txt", "ID 1 8\nNAME 9 12\nid 21 7\n", "line 3: field id is defined twice"},
+		{"overlap.yaml", "fields:\n  - {name: NAME, start: 9, length: 12}\n  - {name: ID, start: 1, length: 10}\n",
+			"field #2: fields ID and NAME overlap"},
+	}
+	for _, f := range files {
+		fileName := path.Join(dir, f.Name)
+		if err := ioutil.WriteFile(fileName, []byte(f.Content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		layout, err := loadLayout(fileName)
+		if len(f.Error) > 0 {
+			if err == nil || !strings.Contains(err.Error(), f.Error) {
+				t.Errorf("loadLayout(%s) => %v; want an error with \"%s\"", f.Name, err, f.Error)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("loadLayout(%s) => %v", f.Name, err)
+			continue
+		}
+		if got := fmt.Sprint(layout.fields); layout.name != "customer" ||
+			got != "[{ID 0 8 numeric} {NAME 8 12 char} {AMOUNT 20 7 decimal}]" {
+			t.Errorf("loadLayout(%s) => %s %s; want the customer layout sorted by starts", f.Name, layout.name, got)
+		}
+	}
+
+	values := []struct {
+		Type  string
+		Value string
+		Valid bool
+	}{
+		{"numeric", "00012345", true},
+		{"decimal", " -12.50", true},
+		{"NUMERIC", "0001234-", true},
+		{"numeric", "12a4", false},
+		{"numeric", "    ", true},
+		{"char", "12a4", true},
+		{"", "anything", true},
+	}
+	for _, v := range values {
+		if got := isValidValue(v.Type, v.Value); got != v.Valid {
+			t.Errorf("isValidValue(%q, %q) => %v; want %v", v.Type, v.Value, got, v.Valid)
+		}
+	}
+
+	conf := config.NewDefaultConfig()
+	conf.Layouts = []config.CnfLayout{{Pattern: "*.dat", File: path.Join(dir, "customer.yaml")}}
+	dataFile := path.Join(dir, "CUSTOMERS.DAT")
+	if err := ioutil.WriteFile(dataFile, []byte("00000001John Smith  0012.50\n00000002Jane Doe    00x7.00\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	store := buffers.NewMemoryData()
+	store.AddLine("00000001John Smith  0012.50")
+	store.AddLine("00000002Jane Doe    00x7.00")
+	dummy := NewDummyTestView()
+	ctl := NewController([]string{dataFile}, "", store, dummy, conf, false)
+	if err := ctl.SelectLayouts(); err != nil {
+		t.Fatal(err)
+	}
+	if ctl.layout == nil || ctl.GetColumnCursor() != 0 {
+		t.Fatalf("SelectLayouts() => no layout for %s", dataFile)
+	}
+	ctl.setDataReady(true)
+	ctl.DoAction(view.ActionNextColumn)
+	ctl.DoAction(view.ActionNextColumn)
+	ctl.DoAction(view.ActionCursorRight)
+	if ctl.cursorColumn != 21 || !dummy.showRuler {
+		t.Errorf("moving the column cursor => column %d, ruler %v; want 21, true", ctl.cursorColumn, dummy.showRuler)
+	}
+	ctl.DoAction(view.ActionPreviousColumn)
+	if ctl.cursorColumn != 20 {
+		t.Errorf("ActionPreviousColumn => column %d; want 20", ctl.cursorColumn)
+	}
+	lineNo, fields := ctl.GetRecordFields()
+	if got := fmt.Sprintf("%d %q %q %v", lineNo, fields[1].Value, fields[2].Value, fields[2].Valid); got !=
+		"1 \"John Smith  \" \"0012.50\" true" {
+		t.Errorf("GetRecordFields() => %s; want fields of the first line", got)
+	}
+	ctl.DoAction(view.ActionTableMode)
+	if ctl.GetLayoutFields() != nil || ctl.GetColumnCursor() != -1 {
+		t.Errorf("GetLayoutFields() in the table mode => %v; want none", ctl.GetLayoutFields())
+	}
+}
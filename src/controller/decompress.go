@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+)
+
+type compressionFormat struct {
+	name    string
+	magic   []byte
+	command string                   // external decompressor, for formats not supported by the standard library
+	valid   func(*bufio.Reader) bool // checks the header further, after the magic bytes, if not nil
+}
+
+// bzip2BlockMagic starts the first block of a bzip2 stream, bzip2EndMagic ends the stream (an empty one).
+var (
+	bzip2BlockMagic = []byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59}
+	bzip2EndMagic   = []byte{0x17, 0x72, 0x45, 0x38, 0x50, 0x90}
+)
+
+var compressionFormats = []compressionFormat{
+	{name: "gzip", magic: []byte{0x1f, 0x8b, 0x08}},
+	{name: "bzip2", magic: []byte("BZh"), valid: isBzip2},
+	{name: "xz", magic: []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, command: "xz"},
+	{name: "zstd", magic: []byte{0x28, 0xb5, 0x2f, 0xfd}, command: "zstd"},
+}
+
+// detectCompression sniffs the magic bytes of the input, without consuming them.
+func detectCompression(reader *bufio.Reader) *compressionFormat {
+	for i := range compressionFormats {
+		format := &compressionFormats[i]
+		if head, err := reader.Peek(len(format.magic)); err == nil && bytes.Equal(head, format.magic) &&
+			(format.valid == nil || format.valid(reader)) {
+			return format
+		}
+	}
+	return nil
+}
+
+// isBzip2 checks the bzip2 header: the magic is followed by the block size digit and the magic of the first block
+// (or of the end of the stream), so a text starting with "BZh" is not taken for bzip2.
+func isBzip2(reader *bufio.Reader) bool {
+	head, err := reader.Peek(4 + len(bzip2BlockMagic))
+	if err != nil || head[3] < '1' || head[3] > '9' {
+		return false
+	}
+	return bytes.Equal(head[4:], bzip2BlockMagic) || bytes.Equal(head[4:], bzip2EndMagic)
+}
+
+// checkGzipHeader reads the gzip header from a copy of the first bytes of the reader, without consuming them.
+// A header longer than the buffer of the reader is not checked.
+func checkGzipHeader(reader *bufio.Reader) error {
+	head, err := reader.Peek(reader.Size())
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if _, err := gzip.NewReader(bytes.NewReader(head)); err != nil && (len(head) < reader.Size() ||
+		err != io.EOF && err != io.ErrUnexpectedEOF) {
+		return err
+	}
+	return nil
+}
+
+type commandReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+func (r *commandReader) Close() error {
+	r.ReadCloser.Close()
+	return r.cmd.Wait()
+}
+
+// newDecompressor returns the reader of the data decompressed. It fails before consuming anything from the reader,
+// so the data can still be shown as it is: the gzip header is checked on a copy of the bytes buffered first,
+// external decompressors fail, when they are not available.
+func newDecompressor(format *compressionFormat, reader *bufio.Reader) (io.ReadCloser, error) {
+	switch {
+	case format.name == "gzip":
+		if err := checkGzipHeader(reader); err != nil {
+			return nil, err
+		}
+		return gzip.NewReader(reader)
+	case format.name == "bzip2":
+		return ioutil.NopCloser(bzip2.NewReader(reader)), nil
+	case len(format.command) > 0:
+		path, err := exec.LookPath(format.command)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("%s decompressor \"%s\" is not available: %s",
+				format.name, format.command, err.Error()))
+		}
+		cmd := exec.Command(path, "-d", "-c")
+		cmd.Stdin = reader
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := cmd.Start(); err != nil {
+			return nil, err
+		}
+		return &commandReader{ReadCloser: stdout, cmd: cmd}, nil
+	}
+	return nil, errors.New(fmt.Sprintf("unsupported compression format: %s", format.name))
+}
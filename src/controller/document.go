@@ -0,0 +1,231 @@
+package controller
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/bry00/m/buffers"
+	"github.com/bry00/m/config"
+	"github.com/bry00/m/view"
+)
+
+// document is a single input browsed (a file or the standard input), with its own data,
+// position and search state.
+type document struct {
+	fileName         *string
+	data             buffers.LineStore
+	dataReady        int32 // accessed atomically, as it is set by the reader of the document
+	maxLineLength    int
+	searchString     string
+	searchRegex      bool
+	searchIgnoreCase bool
+	searchWholeWord  bool
+	searchSmartCase  bool
+	searchWrapAround bool
+	searchMatcher    *matcher
+	searchLastRow    int
+	searchLastCol    int
+	pointedLine      int
+	compression      string
+	encoding         *textEncoding
+	hexMode          bool
+	hexModeFixed     bool
+	hexShown         bool
+	following        int32 // accessed atomically, as it is toggled by the UI goroutine and read by the reader
+	reloadRequests   chan struct{}
+	changes          *changeTracker
+	readCount        int
+	status           view.AppStatus
+	left             int
+	top              int
+	topRow           int
+	foundLine        int
+	foundStart       int
+	foundEnd         int
+	shownLine        int
+	filters          []*filterRule
+	filtered         *buffers.FilteredData
+	filterCancel     chan struct{}
+	marks            map[rune]int
+	jumps            jumpList
+	table            *tableLayout
+	freeze           config.CnfFreeze
+	frozenLines      int
+	frozenColumns    int
+	layout           *recordLayout
+	cursorColumn     int
+}
+
+func newDocument(fileName *string, data buffers.LineStore, conf *config.Config) *document {
+	freeze := freezeRule(conf, fileName)
+	return &document{
+		fileName:         fileName,
+		data:             data,
+		dataReady:        0,
+		maxLineLength:    0,
+		searchString:     "",
+		searchRegex:      false,
+		searchIgnoreCase: false,
+		searchWholeWord:  false,
+		searchSmartCase:  false,
+		searchWrapAround: false,
+		searchMatcher:    nil,
+		searchLastRow:    -1,
+		searchLastCol:    -1,
+		pointedLine:      -1,
+		compression:      "",
+		encoding:         nil,
+		hexMode:          false,
+		hexModeFixed:     false,
+		hexShown:         false,
+		following:        0,
+		reloadRequests:   make(chan struct{}, 1),
+		changes:          newChangeTracker(conf.Reload.MaxTrackedLines),
+		readCount:        0,
+		status:           view.StatusUnknown,
+		left:             0,
+		top:              0,
+		foundLine:        -1,
+		foundStart:       -1,
+		foundEnd:         -1,
+		shownLine:        -1,
+		filters:          nil,
+		filtered:         nil,
+		filterCancel:     nil,
+		marks:            nil,
+		freeze:           freeze,
+		frozenLines:      freeze.Lines,
+		frozenColumns:    freeze.Columns,
+		layout:           nil,
+		cursorColumn:     0,
+	}
+}
+
+func (doc *document) isDataReady() bool {
+	return atomic.LoadInt32(&doc.dataReady) != 0
+}
+
+func (doc *document) setDataReady(ready bool) {
+	atomic.StoreInt32(&doc.dataReady, boolToInt32(ready))
+}
+
+func (doc *document) isFollowing() bool {
+	return atomic.LoadInt32(&doc.following) != 0
+}
+
+func (doc *document) setFollowing(follow bool) {
+	atomic.StoreInt32(&doc.following, boolToInt32(follow))
+}
+
+func boolToInt32(value bool) int32 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+func (doc *document) getTitle() string {
+	if doc.fileName == nil {
+		return "<<stdin>>"
+	}
+	if home, err := os.UserHomeDir(); err == nil && strings.HasPrefix(*doc.fileName, home) {
+		return "~" + strings.TrimPrefix(*doc.fileName, home)
+	}
+	return *doc.fileName
+}
+
+// newStore creates a new, empty store of the same kind as the current one.
+func (ctl *Controller) newStore() buffers.LineAppender {
+	for _, doc := range ctl.docs {
+		if renewable, ok := doc.data.(buffers.RenewableStore); ok {
+			return renewable.NewEmpty()
+		}
+	}
+	return buffers.NewBufferedDataDefault()
+}
+
+func (ctl *Controller) isCurrent(doc *document) bool {
+	return ctl.document == doc
+}
+
+// setStatus sets the status of the document, which is shown if the document is the current one. It is called
+// from goroutines reading documents, so the document is checked to be the current one by the UI goroutine.
+func (ctl *Controller) setStatus(doc *document, status view.AppStatus) {
+	ctl.view.QueueUpdateDraw(func() {
+		doc.status = status
+		if ctl.isCurrent(doc) {
+			ctl.view.GetStatusBar().Status(status)
+		}
+	})
+}
+
+// safeMessage shows the message of a goroutine working on the document, if the document is the current one.
+func (ctl *Controller) safeMessage(doc *document, format string, a ...interface{}) {
+	message := fmt.Sprintf(format, a...)
+	ctl.view.QueueUpdateDraw(func() {
+		if ctl.isCurrent(doc) {
+			ctl.view.GetStatusBar().Message("%s", message)
+		}
+	})
+}
+
+func (ctl *Controller) showSearchResult(lineIndex int, start int, end int) {
+	ctl.foundLine = lineIndex
+	ctl.foundStart = start
+	ctl.foundEnd = end
+	ctl.view.ShowSearchResult(lineIndex, start, end)
+}
+
+func (ctl *Controller) showLine(lineIndex int) {
+	ctl.shownLine = lineIndex
+	ctl.view.ShowLine(lineIndex)
+}
+
+// GetDocumentIndex returns the index of the current document and the number of all documents.
+func (ctl *Controller) GetDocumentIndex() (int, int) {
+	for i, doc := range ctl.docs {
+		if ctl.isCurrent(doc) {
+			return i, len(ctl.docs)
+		}
+	}
+	return 0, len(ctl.docs)
+}
+
+func (ctl *Controller) GetDocumentTitles() []string {
+	result := make([]string, len(ctl.docs))
+	for i, doc := range ctl.docs {
+		result[i] = doc.getTitle()
+	}
+	return result
+}
+
+// SwitchDocument makes the document of the given index the current one, restoring its view state.
+func (ctl *Controller) SwitchDocument(index int) {
+	if index < 0 || index >= len(ctl.docs) {
+		return
+	}
+	ctl.cancelSearch()
+	ctl.left, ctl.top, _, _ = ctl.view.GetDisplayRect()
+	ctl.topRow = ctl.view.GetTopRow()
+	ctl.document = ctl.docs[index]
+	if ctl.view.IsWrapped() {
+		ctl.view.DisplayAtRow(ctl.top, ctl.topRow)
+	} else {
+		ctl.view.DisplayAt(ctl.left, ctl.top)
+	}
+	ctl.view.ShowSearchResult(ctl.foundLine, ctl.foundStart, ctl.foundEnd)
+	ctl.view.ShowLine(ctl.shownLine)
+	ctl.view.GetStatusBar().Status(ctl.status)
+	ctl.view.GetStatusBar().Message("File %d of %d: %s", index+1, len(ctl.docs), ctl.getTitle())
+}
+
+func (ctl *Controller) switchDocumentBy(delta int) {
+	if len(ctl.docs) < 2 {
+		ctl.view.GetStatusBar().Message("There is just one file")
+		return
+	}
+	current, count := ctl.GetDocumentIndex()
+	ctl.SwitchDocument(((current+delta)%count + count) % count)
+}
@@ -0,0 +1,178 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+const AutoEncoding = "auto"
+const defaultFallbackEncoding = "windows-1252"
+
+const utf8BOM = "\ufeff"
+
+type textEncoding struct {
+	name     string
+	aliases  []string
+	encoding encoding.Encoding // nil for UTF-8, which needs no conversion
+	bom      []byte
+	stream   bool // new lines are not single '\n' bytes, so the input has to be decoded as a whole
+}
+
+var textEncodings = []textEncoding{
+	{name: "utf-8", aliases: []string{"utf8"}, bom: []byte(utf8BOM)},
+	{name: "utf-16le", aliases: []string{"utf16le", "utf-16", "utf16", "ucs-2"},
+		encoding: unicode.UTF16(unicode.LittleEndian, unicode.UseBOM), bom: []byte{0xff, 0xfe}, stream: true},
+	{name: "utf-16be", aliases: []string{"utf16be"},
+		encoding: unicode.UTF16(unicode.BigEndian, unicode.UseBOM), bom: []byte{0xfe, 0xff}, stream: true},
+	{name: "iso-8859-1", aliases: []string{"latin1", "latin-1", "iso8859-1"}, encoding: charmap.ISO8859_1},
+	{name: "iso-8859-2", aliases: []string{"latin2", "latin-2", "iso8859-2"}, encoding: charmap.ISO8859_2},
+	{name: "iso-8859-5", aliases: []string{"iso8859-5"}, encoding: charmap.ISO8859_5},
+	{name: "iso-8859-15", aliases: []string{"latin9", "latin-9", "iso8859-15"}, encoding: charmap.ISO8859_15},
+	{name: "windows-1250", aliases: []string{"cp1250"}, encoding: charmap.Windows1250},
+	{name: "windows-1251", aliases: []string{"cp1251"}, encoding: charmap.Windows1251},
+	{name: "windows-1252", aliases: []string{"cp1252"}, encoding: charmap.Windows1252},
+	{name: "windows-1253", aliases: []string{"cp1253"}, encoding: charmap.Windows1253},
+	{name: "windows-1254", aliases: []string{"cp1254"}, encoding: charmap.Windows1254},
+	{name: "windows-1255", aliases: []string{"cp1255"}, encoding: charmap.Windows1255},
+	{name: "windows-1256", aliases: []string{"cp1256"}, encoding: charmap.Windows1256},
+	{name: "windows-1257", aliases: []string{"cp1257"}, encoding: charmap.Windows1257},
+	{name: "windows-1258", aliases: []string{"cp1258"}, encoding: charmap.Windows1258},
+	{name: "cp437", aliases: []string{"ibm437"}, encoding: charmap.CodePage437},
+	{name: "cp850", aliases: []string{"ibm850"}, encoding: charmap.CodePage850},
+	{name: "cp852", aliases: []string{"ibm852"}, encoding: charmap.CodePage852},
+	{name: "koi8-r", aliases: []string{"koi8r"}, encoding: charmap.KOI8R},
+}
+
+// findEncoding returns the encoding of the given name or alias, nil for the automatic detection.
+func findEncoding(name string) (*textEncoding, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || name == AutoEncoding {
+		return nil, nil
+	}
+	for i := range textEncodings {
+		enc := &textEncodings[i]
+		if enc.name == name {
+			return enc, nil
+		}
+		for _, alias := range enc.aliases {
+			if alias == name {
+				return enc, nil
+			}
+		}
+	}
+	names := make([]string, len(textEncodings))
+	for i, enc := range textEncodings {
+		names[i] = enc.name
+	}
+	return nil, errors.New(fmt.Sprintf("unknown encoding \"%s\", use %s or one of: %s",
+		name, AutoEncoding, strings.Join(names, ", ")))
+}
+
+// detectEncoding guesses the encoding from the byte order mark or from the content of the first block
+// of the input, without consuming it. When the content is not a valid UTF-8 the fallback encoding is assumed.
+func detectEncoding(reader *bufio.Reader, fallback *textEncoding) *textEncoding {
+	for i := range textEncodings {
+		enc := &textEncodings[i]
+		if head, err := reader.Peek(len(enc.bom)); len(enc.bom) > 0 && err == nil && bytes.Equal(head, enc.bom) {
+			return enc
+		}
+	}
+	reader.Peek(1)
+	sample, _ := reader.Peek(reader.Buffered()) // just the first block, not waiting for more
+	if enc := detectUTF16(sample); enc != nil {
+		return enc
+	}
+	if isValidUTF8(sample) {
+		return &textEncodings[0]
+	}
+	return fallback
+}
+
+// detectUTF16 recognises UTF-16 without the byte order mark, by the zero bytes of ASCII characters.
+func detectUTF16(sample []byte) *textEncoding {
+	var evenZeros, oddZeros int
+	for i, b := range sample {
+		if b == 0 {
+			if i%2 == 0 {
+				evenZeros++
+			} else {
+				oddZeros++
+			}
+		}
+	}
+	pairs := len(sample) / 2
+	switch {
+	case pairs == 0:
+		return nil
+	case oddZeros > pairs/2 && evenZeros <= pairs/20:
+		return &textEncodings[1]
+	case evenZeros > pairs/2 && oddZeros <= pairs/20:
+		return &textEncodings[2]
+	}
+	return nil
+}
+
+// isValidUTF8 checks the sample, that may end in the middle of a character.
+func isValidUTF8(sample []byte) bool {
+	for i := len(sample) - 1; i >= 0 && i >= len(sample)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(sample[i]) {
+			if !utf8.FullRune(sample[i:]) {
+				sample = sample[:i]
+			}
+			break
+		}
+	}
+	return utf8.Valid(sample)
+}
+
+// lineDecoder returns a function converting single lines to UTF-8, or nil when the input has to be decoded
+// as a whole.
+func (enc *textEncoding) lineDecoder() func(string) string {
+	if enc.stream {
+		return nil
+	}
+	if enc.encoding == nil {
+		return func(line string) string {
+			return strings.TrimPrefix(line, utf8BOM)
+		}
+	}
+	decoder := enc.encoding.NewDecoder()
+	return func(line string) string {
+		if result, err := decoder.String(line); err == nil {
+			return result
+		}
+		return line
+	}
+}
+
+// newReader returns a reader converting the whole input to UTF-8.
+func (enc *textEncoding) newReader(reader io.Reader) io.Reader {
+	return transform.NewReader(reader, enc.encoding.NewDecoder())
+}
+
+// SetEncoding sets the encoding of the input files, AutoEncoding (or an empty name) to detect it for each file.
+func (ctl *Controller) SetEncoding(name string) error {
+	enc, err := findEncoding(name)
+	if err == nil {
+		ctl.encoding = enc
+	}
+	return err
+}
+
+func getFallbackEncoding(name string) *textEncoding {
+	if enc, err := findEncoding(name); err == nil && enc != nil {
+		return enc
+	}
+	enc, _ := findEncoding(defaultFallbackEncoding)
+	return enc
+}
@@ -0,0 +1,182 @@
+package controller
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/bry00/m/buffers"
+)
+
+// filterRule selects lines shown: the ones matching the pattern, or the ones not matching it when excluding.
+type filterRule struct {
+	pattern string
+	re      *regexp.Regexp
+	exclude bool
+}
+
+func newFilterRule(pattern string, exclude bool) (*filterRule, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &filterRule{
+		pattern: pattern,
+		re:      re,
+		exclude: exclude,
+	}, nil
+}
+
+func (f *filterRule) String() string {
+	if f.exclude {
+		return "-" + f.pattern
+	}
+	return "+" + f.pattern
+}
+
+// matchFilters tells whether the line passes all the filters.
+func matchFilters(filters []*filterRule, line string) bool {
+	for _, f := range filters {
+		if f.re.MatchString(line) == f.exclude {
+			return false
+		}
+	}
+	return true
+}
+
+// shown returns lines being browsed: the filtered ones, when there are filters set.
+func (doc *document) shown() buffers.LineStore {
+	if doc.filtered != nil {
+		return doc.filtered
+	}
+	return doc.data
+}
+
+// GetSourceLine returns the index of the line in the whole data, for the index of the line shown.
+func (ctl *Controller) GetSourceLine(lineIndex int) int {
+	if ctl.filtered != nil {
+		return ctl.filtered.SourceIndex(lineIndex)
+	}
+	return lineIndex
+}
+
+// shownIndex returns the index of the first line shown, which is not before the given line of the whole data.
+func (ctl *Controller) shownIndex(sourceIndex int) int {
+	if ctl.filtered != nil {
+		return ctl.filtered.IndexOf(sourceIndex)
+	}
+	return sourceIndex
+}
+
+// AddFilter adds a filter to the ones of the current document, the lines shown are selected again.
+func (ctl *Controller) AddFilter(pattern string, exclude bool) error {
+	f, err := newFilterRule(pattern, exclude)
+	if err != nil {
+		return err
+	}
+	ctl.filters = append(ctl.filters, f)
+	ctl.applyFilters(ctl.document)
+	ctl.resetFilteredView()
+	return nil
+}
+
+// RemoveFilter removes the filter added last to the current document.
+func (ctl *Controller) RemoveFilter() {
+	if len(ctl.filters) == 0 {
+		ctl.view.GetStatusBar().Message("There are no filters")
+		return
+	}
+	ctl.filters = ctl.filters[:len(ctl.filters)-1]
+	ctl.applyFilters(ctl.document)
+	ctl.resetFilteredView()
+}
+
+// ClearFilters removes all the filters of the current document.
+func (ctl *Controller) ClearFilters() {
+	if len(ctl.filters) > 0 {
+		ctl.filters = nil
+		ctl.applyFilters(ctl.document)
+		ctl.resetFilteredView()
+	}
+}
+
+// describeFilters returns the filters as "+include -exclude".
+func describeFilters(filters []*filterRule) string {
+	result := make([]string, len(filters))
+	for i, f := range filters {
+		result[i] = f.String()
+	}
+	return strings.Join(result, " ")
+}
+
+// applyFilters selects the lines shown according to the filters of the document; the lines are selected
+// in the background, so the view shows the lines found so far. It has to be called in the UI thread.
+func (ctl *Controller) applyFilters(doc *document) {
+	if doc.filterCancel != nil {
+		close(doc.filterCancel)
+		doc.filterCancel = nil
+	}
+	doc.filtered = nil
+	if len(doc.filters) > 0 {
+		doc.filtered = buffers.NewFilteredData(doc.data)
+		doc.filterCancel = make(chan struct{})
+		filters := append([]*filterRule{}, doc.filters...)
+		go ctl.runFilters(doc, doc.filtered, doc.data, filters, doc.filterCancel)
+	}
+}
+
+// resetFilteredView shows the beginning of the lines selected by the filters changed.
+func (ctl *Controller) resetFilteredView() {
+	ctl.cancelSearch()
+	ctl.jumps.clear()
+	ctl.showSearchResult(-1, -1, -1)
+	ctl.showLine(-1)
+	ctl.searchLastRow = -1
+	ctl.searchLastCol = -1
+	ctl.displayAt(0, 0, 0)
+	if len(ctl.filters) == 0 {
+		ctl.view.GetStatusBar().Message("No filters")
+	}
+}
+
+// runFilters adds lines of the source matching the filters to the filtered store, until cancelled or until
+// the whole input is read; a followed file is filtered as it grows.
+func (ctl *Controller) runFilters(doc *document, filtered *buffers.FilteredData, source buffers.LineStore,
+	filters []*filterRule, cancel chan struct{}) {
+	interval := time.Duration(ctl.conf.View.FollowIntervalMillis) * time.Millisecond
+	refreshPeriod := time.Duration(ctl.conf.View.ViewRefreshSeconds) * time.Second
+	lastRefresh := time.Now()
+	next := 0
+	for {
+		linesBefore := filtered.Len()
+		ready := doc.isDataReady()
+		for ; next < source.Len(); next++ {
+			select {
+			case <-cancel:
+				return
+			default:
+			}
+			if line, err := source.GetLine(next); err == nil && matchFilters(filters, ctl.visibleText(line)) {
+				filtered.AddIndex(next)
+			}
+			if time.Since(lastRefresh) > refreshPeriod {
+				ctl.view.Refresh()
+				lastRefresh = time.Now()
+			}
+		}
+		if !ready || doc.isFollowing() && doc.isFollowable() {
+			if ready && filtered.Len() > linesBefore {
+				ctl.onLinesAppended(doc, linesBefore)
+			}
+			select {
+			case <-cancel:
+				return
+			case <-time.After(interval):
+			}
+			continue
+		}
+		ctl.safeMessage(doc, "Filter %s: %d of %d lines", describeFilters(filters), filtered.Len(), source.Len())
+		ctl.view.Refresh()
+		return
+	}
+}
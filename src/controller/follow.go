@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"os"
+
+	"github.com/bry00/m/buffers"
+	"github.com/bry00/m/view"
+)
+
+func (ctl *Controller) SetFollowing(follow bool) {
+	for _, doc := range ctl.docs {
+		doc.setFollowing(follow)
+	}
+}
+
+// isFollowable tells whether the input may grow: only not compressed files, that are not decoded
+// as a whole, are followed; the end of the standard input is final.
+func (doc *document) isFollowable() bool {
+	return doc.fileName != nil && len(doc.compression) == 0 && (doc.encoding == nil || !doc.encoding.stream)
+}
+
+func (doc *document) getReadyStatus() view.AppStatus {
+	if doc.isFollowing() && doc.isFollowable() {
+		return view.StatusFollowing
+	}
+	return view.StatusReady
+}
+
+// replaceData switches the document to the new store in the UI thread, then disposes the old one.
+func (ctl *Controller) replaceData(doc *document, store buffers.LineStore) {
+	done := make(chan struct{})
+	ctl.view.QueueUpdateDraw(func() {
+		old := doc.data
+		doc.data = store
+		doc.maxLineLength = 0
+		if ctl.isCurrent(doc) {
+			ctl.cancelSearch()
+		}
+		if len(doc.filters) > 0 {
+			ctl.applyFilters(doc)
+		}
+		if old != nil {
+			old.Close()
+		}
+		close(done)
+	})
+	<-done
+}
+
+// onLinesAppended keeps the end of the data visible, if it was visible before the new lines arrived.
+func (ctl *Controller) onLinesAppended(doc *document, linesBefore int) {
+	ctl.view.QueueUpdateDraw(func() {
+		if !ctl.isCurrent(doc) {
+			return
+		}
+		left, top, width, height := ctl.view.GetDisplayRect()
+		if ctl.view.IsWrapped() {
+			if bottomLine, _ := ctl.moveRows(top, ctl.view.GetTopRow(), height, width); bottomLine >= linesBefore {
+				ctl.displayWrapped(doc.shown().Len(), 0, width, height)
+			}
+		} else if top+height >= linesBefore {
+			if top = doc.shown().Len() - height; top < 0 {
+				top = 0
+			}
+			ctl.view.DisplayAt(left, top)
+		}
+	})
+}
+
+// fileReplaced detects the truncation of the file and its rotation, i.e. a new file created
+// under the same name.
+func fileReplaced(file *os.File, fileName string, offset int64) (truncated bool, rotated bool) {
+	info, err := file.Stat()
+	if err != nil {
+		return false, false
+	}
+	if info.Size() < offset {
+		return true, false
+	}
+	if current, err := os.Stat(fileName); err == nil && !os.SameFile(info, current) {
+		return false, true
+	}
+	return false, false
+}
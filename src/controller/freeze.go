@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/bry00/m/config"
+	"github.com/bry00/m/utl"
+	"github.com/bry00/m/view"
+)
+
+// freezeRule returns the rule of freezing lines and columns of the file: the first one with the pattern matching
+// its name (case insensitively), or no freezing at all.
+func freezeRule(conf *config.Config, fileName *string) config.CnfFreeze {
+	if fileName != nil {
+		name := strings.ToLower(filepath.Base(*fileName))
+		for _, rule := range conf.Freeze {
+			if matched, err := filepath.Match(strings.ToLower(rule.Pattern), name); err == nil && matched {
+				return rule
+			}
+		}
+	}
+	return config.CnfFreeze{}
+}
+
+// pinnedLines returns the number of the first lines of the data pinned at the top of the view: the lines frozen,
+// or the header row of the table.
+func (ctl *Controller) pinnedLines() int {
+	if ctl.frozenLines == 0 && ctl.table != nil && ctl.table.header {
+		return 1
+	}
+	return ctl.frozenLines
+}
+
+// frozenTop returns the index of the first line shown, which is not pinned; the view does not scroll above it.
+func (ctl *Controller) frozenTop() int {
+	return ctl.shownIndex(utl.MinInt(ctl.pinnedLines(), ctl.data.Len()))
+}
+
+// headerTop returns the index of the first line shown below the header row of the table pinned, or 0. Lines above it
+// are not searched, as the header row does not show search results.
+func (ctl *Controller) headerTop() int {
+	if ctl.frozenLines > 0 {
+		return 0
+	}
+	return ctl.frozenTop()
+}
+
+// toggleFrozenLines freezes lines at the top of the view: as many as the rule of the file says, or the first one.
+func (ctl *Controller) toggleFrozenLines() {
+	if ctl.frozenLines > 0 {
+		ctl.frozenLines = 0
+		ctl.view.GetStatusBar().Message("Lines unfrozen")
+		return
+	}
+	ctl.frozenLines = utl.MaxInt(ctl.freeze.Lines, 1)
+	ctl.view.GetStatusBar().Message("Frozen lines: %d", ctl.frozenLines)
+}
+
+// toggleFrozenColumns freezes columns at the left of the view: as many as the rule of the file says, the first
+// column of the table in the table mode, or the columns scrolled past.
+func (ctl *Controller) toggleFrozenColumns(left int) {
+	if ctl.frozenColumns > 0 {
+		ctl.frozenColumns = 0
+		ctl.view.GetStatusBar().Message("Columns unfrozen")
+		return
+	}
+	if ctl.view.IsWrapped() {
+		ctl.view.GetStatusBar().Message("Columns cannot be frozen, when lines are wrapped")
+		return
+	}
+	columns := ctl.freeze.Columns
+	if columns <= 0 && ctl.table != nil {
+		if starts := ctl.table.columnStarts(); len(starts) > 1 {
+			columns = starts[1]
+		}
+	}
+	if columns <= 0 {
+		columns = left
+	}
+	if columns <= 0 {
+		ctl.view.GetStatusBar().Message("Scroll right past the columns to freeze first")
+		return
+	}
+	ctl.frozenColumns = columns
+	ctl.view.GetStatusBar().Message("Frozen columns: %d", ctl.frozenColumns)
+}
+
+// GetFrozenLines returns lines frozen at the top of the view: the first lines of the whole data.
+func (ctl *Controller) GetFrozenLines() []view.FrozenLine {
+	count := utl.MinInt(ctl.frozenLines, ctl.data.Len())
+	result := make([]view.FrozenLine, 0, count)
+	for i := 0; i < count; i++ {
+		line, err := ctl.data.GetLine(i)
+		if err != nil {
+			break
+		}
+		frozen := view.FrozenLine{Text: line, LineNo: i + 1, LineIndex: -1}
+		if index := ctl.shownIndex(i); index < ctl.shown().Len() && ctl.GetSourceLine(index) == i {
+			frozen.LineIndex = index
+		}
+		result = append(result, frozen)
+	}
+	return result
+}
+
+// GetFrozenColumns returns the number of columns frozen at the left of the view; none, when lines are wrapped.
+func (ctl *Controller) GetFrozenColumns() int {
+	if ctl.view.IsWrapped() {
+		return 0
+	}
+	return ctl.frozenColumns
+}
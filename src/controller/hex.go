@@ -0,0 +1,253 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bry00/m/buffers"
+	"github.com/bry00/m/utl"
+)
+
+// hexRowSize is the number of bytes shown in a single row of the hex dump.
+const hexRowSize = 16
+
+// hexSearchPrefix starts search strings, which are sequences of bytes in hex to look for in the hex dump.
+const hexSearchPrefix = "x:"
+
+// SetHexMode makes all the files be shown as hex dumps (or as text), instead of detecting binary content.
+func (ctl *Controller) SetHexMode(hexMode bool) {
+	for _, doc := range ctl.docs {
+		doc.hexMode = hexMode
+		doc.hexModeFixed = true
+	}
+}
+
+// toggleHexMode switches the current file between the text and the hex dump, by reading it again.
+func (ctl *Controller) toggleHexMode() {
+	if ctl.fileName == nil {
+		ctl.view.GetStatusBar().Message("The standard input cannot be shown in another mode")
+		return
+	}
+	ctl.hexMode = !ctl.hexMode
+	ctl.hexModeFixed = true
+	ctl.jumps.clear()
+	ctl.table = nil
+	ctl.requestReload()
+}
+
+// isBinary tells whether there are NUL bytes in the first block of the input, without consuming it.
+func isBinary(reader *bufio.Reader) bool {
+	reader.Peek(1)
+	sample, _ := reader.Peek(reader.Buffered())
+	return bytes.IndexByte(sample, 0) >= 0
+}
+
+// readHexRow reads bytes of a single hex dump row; the row is short at the end of the input.
+func readHexRow(reader io.Reader, size int) (string, error) {
+	buffer := make([]byte, size)
+	n, err := io.ReadFull(reader, buffer)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return string(buffer[:n]), err
+}
+
+// formatHexRow formats bytes read at the given offset as: offset, bytes in hex and the printable characters.
+func formatHexRow(offset int64, data string) string {
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("%08x  ", offset))
+	for i := 0; i < hexRowSize; i++ {
+		if i < len(data) {
+			result.WriteString(fmt.Sprintf("%02x ", data[i]))
+		} else {
+			result.WriteString("   ")
+		}
+		if i == hexRowSize/2-1 {
+			result.WriteByte(' ')
+		}
+	}
+	result.WriteString(" |")
+	for i := 0; i < len(data); i++ {
+		if c := data[i]; c >= ' ' && c < 0x7f {
+			result.WriteByte(c)
+		} else {
+			result.WriteByte('.')
+		}
+	}
+	result.WriteByte('|')
+	return result.String()
+}
+
+// hexColumn returns the column of the n-th byte of a hex dump row.
+func hexColumn(row string, n int) int {
+	result := strings.Index(row, "  ") + 2 + 3*n
+	if n >= hexRowSize/2 {
+		result++
+	}
+	return result
+}
+
+// parseHexRow returns bytes shown in a hex dump row.
+func parseHexRow(row string) []byte {
+	result := make([]byte, 0, hexRowSize)
+	for n := 0; n < hexRowSize; n++ {
+		column := hexColumn(row, n)
+		if column+2 > len(row) || row[column] == ' ' {
+			break
+		}
+		b, err := hex.DecodeString(row[column : column+2])
+		if err != nil {
+			break
+		}
+		result = append(result, b[0])
+	}
+	return result
+}
+
+// parseHexPattern converts a search string like "de ad be ef" or "deadbeef" into bytes.
+func parseHexPattern(pattern string) ([]byte, bool) {
+	digits := strings.Join(strings.Fields(pattern), "")
+	if len(digits) == 0 {
+		return nil, false
+	}
+	result, err := hex.DecodeString(digits)
+	return result, err == nil
+}
+
+// getHexPattern returns bytes to look for, when a hex dump is shown and the search string is a hex sequence
+// given after the hex search prefix.
+func (ctl *Controller) getHexPattern() ([]byte, bool) {
+	return ctl.currentQuery().hexPattern(ctl.hexShown)
+}
+
+// hexPattern returns bytes searched for in the hex dump shown, when the query is a sequence of hex digits after
+// the hex search prefix (e.g. "x:de ad be ef"); other queries look for the text of the dump.
+func (q searchQuery) hexPattern(hexShown bool) ([]byte, bool) {
+	if !hexShown || q.regex || !strings.HasPrefix(q.text, hexSearchPrefix) {
+		return nil, false
+	}
+	return parseHexPattern(strings.TrimPrefix(q.text, hexSearchPrefix))
+}
+
+// hexWindow keeps the bytes of the hex dump rows following the current row of a search, so a sequence continued
+// in the following rows is matched without reading them again for every row.
+type hexWindow struct {
+	rows  [][]byte
+	next  buffers.LineIterator
+	count int
+}
+
+// newHexWindow keeps up to count bytes of the rows following the given one.
+func newHexWindow(data buffers.LineStore, lineIndex int, count int) *hexWindow {
+	next := data.Iterator()
+	next.IndexSet(lineIndex+1, false)
+	w := &hexWindow{
+		rows:  [][]byte{},
+		next:  next,
+		count: count,
+	}
+	w.fill()
+	return w
+}
+
+func (w *hexWindow) size() int {
+	size := 0
+	for _, row := range w.rows {
+		size += len(row)
+	}
+	return size
+}
+
+// fill reads the following rows, until there are enough bytes or no more rows.
+func (w *hexWindow) fill() {
+	for ; w.size() < w.count && w.next.IndexOK(); w.next.IndexIncrement() {
+		var rowBytes []byte
+		if row, err := w.next.GetLine(); err == nil {
+			rowBytes = parseHexRow(row)
+		}
+		w.rows = append(w.rows, rowBytes)
+	}
+}
+
+// bytes returns up to count bytes following the current row.
+func (w *hexWindow) bytes() []byte {
+	result := make([]byte, 0, w.count)
+	for _, row := range w.rows {
+		result = append(result, row...)
+	}
+	if len(result) > w.count {
+		result = result[:w.count]
+	}
+	return result
+}
+
+// forward moves the window to the row following the current one.
+func (w *hexWindow) forward() {
+	if len(w.rows) > 0 {
+		w.rows = w.rows[1:]
+	}
+	w.fill()
+}
+
+// backward moves the window to the row preceding the current one, whose bytes are given.
+func (w *hexWindow) backward(rowBytes []byte) {
+	w.rows = append([][]byte{rowBytes}, w.rows...)
+	for l := len(w.rows); l > 1 && w.size()-len(w.rows[l-1]) >= w.count; l = len(w.rows) {
+		w.rows = w.rows[:l-1]
+	}
+}
+
+// findHex looks for a sequence of bytes in the hex dump, a sequence may continue in the following rows.
+// Found positions are the columns of the hex bytes in the row, where the sequence starts.
+func findHex(job *searchJob, data buffers.LineStore, pattern []byte, startLine int, startColumn int,
+	forward bool) (int, int, int, string, error) {
+	i := data.Iterator()
+	i.IndexSet(startLine, false)
+	step := i.IndexIncrement
+	if !forward {
+		step = i.IndexDecrement
+	}
+	lines := data.Len()
+	window := newHexWindow(data, startLine, len(pattern)-1)
+	for first := true; i.IndexOK(); first = false {
+		if job.cancelled() {
+			return -1, -1, -1, "", errSearchCancelled
+		}
+		if forward {
+			job.report(i.Index()-startLine, lines-startLine)
+		} else {
+			job.report(startLine-i.Index(), startLine+1)
+		}
+		var rowBytes []byte
+		if row, err := i.GetLine(); err == nil {
+			rowBytes = parseHexRow(row)
+			rowData := append(append(make([]byte, 0, len(rowBytes)+window.count), rowBytes...), window.bytes()...)
+			for k := range rowBytes {
+				n := k
+				if !forward {
+					n = len(rowBytes) - 1 - k
+				}
+				if n+len(pattern) > len(rowData) || !bytes.Equal(rowData[n:n+len(pattern)], pattern) {
+					continue
+				}
+				start := hexColumn(row, n)
+				end := hexColumn(row, utl.MinInt(n+len(pattern), len(rowBytes))-1) + 2
+				if first && (forward && start < startColumn || !forward && startColumn > 0 && end > startColumn) {
+					continue
+				}
+				return i.Index(), start, end, row, nil
+			}
+		}
+		if forward {
+			window.forward()
+		} else {
+			window.backward(rowBytes)
+		}
+		step()
+	}
+	return -1, -1, -1, "", nil
+}
@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"strings"
+
+	"github.com/bry00/m/markup"
+	"github.com/gdamore/tcell"
+)
+
+// marker is a term highlighted with its own color, regardless of the search.
+type marker struct {
+	query   searchQuery
+	matcher *matcher
+	style   markup.Style
+}
+
+// markerStyle returns the style of the n-th marker, colors configured are used in turn.
+func (ctl *Controller) markerStyle(n int) markup.Style {
+	colors := ctl.conf.Visual.Highlight.MarkerColors
+	result := markup.Style{
+		Foreground: tcell.GetColor(ctl.conf.Visual.Highlight.MarkerTextColor),
+		Background: tcell.ColorDefault,
+		Attributes: tcell.AttrNone,
+	}
+	if len(colors) > 0 {
+		result.Background = tcell.GetColor(strings.ToLower(colors[n%len(colors)]))
+	}
+	return result
+}
+
+// toggleMarker makes the current search string a marker, or removes it from markers if it is one already.
+func (ctl *Controller) toggleMarker() {
+	if len(ctl.searchString) == 0 {
+		ctl.view.GetStatusBar().Message("Search for the term to be highlighted first")
+		return
+	}
+	query := ctl.currentQuery()
+	for i, m := range ctl.markers {
+		if m.query == query {
+			ctl.markers = append(ctl.markers[:i], ctl.markers[i+1:]...)
+			ctl.view.GetStatusBar().Message("Highlight removed: \"%s\"", m.query.text)
+			return
+		}
+	}
+	found, err := newMatcher(query)
+	if err != nil {
+		ctl.view.GetStatusBar().Message("Wrong search string \"%s\": %s", ctl.searchString, err.Error())
+		return
+	}
+	ctl.markers = append(ctl.markers, &marker{
+		query:   query,
+		matcher: found,
+		style:   ctl.markerStyle(ctl.nextMarker),
+	})
+	ctl.nextMarker++
+	ctl.view.GetStatusBar().Message("Highlighted: \"%s\"", ctl.searchString)
+}
+
+// clearMarkers removes all the terms highlighted.
+func (ctl *Controller) clearMarkers() {
+	ctl.markers = nil
+	ctl.nextMarker = 0
+	ctl.view.GetStatusBar().Message("No highlights")
+}
+
+// GetHighlights returns parts of the visible text of the line (with tabs expanded) to be highlighted: occurrences
+// of markers and of the search string. Parts may overlap, the latter ones are more important.
+func (ctl *Controller) GetHighlights(line string) []markup.Span {
+	if len(ctl.markers) == 0 && ctl.searchMatcher == nil {
+		return nil
+	}
+	text := ctl.searchTextExpander()(line)
+	result := make([]markup.Span, 0)
+	add := func(m *matcher, style markup.Style) {
+		for _, found := range m.findAll(text) {
+			result = append(result, markup.Span{Start: found[0], End: found[1], Style: style})
+		}
+	}
+	for _, m := range ctl.markers {
+		add(m.matcher, m.style)
+	}
+	if _, hex := ctl.getHexPattern(); ctl.searchMatcher != nil && !hex {
+		add(ctl.searchMatcher, markup.Style{
+			Foreground: tcell.GetColor(ctl.conf.Visual.Highlight.MatchTextColor),
+			Background: tcell.GetColor(ctl.conf.Visual.Highlight.MatchBackgroundColor),
+			Attributes: tcell.AttrNone,
+		})
+	}
+	return result
+}
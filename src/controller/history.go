@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/bry00/m/view"
+	"gopkg.in/yaml.v2"
+)
+
+const historyFile = "history.yaml"
+
+type searchHistoryEntry struct {
+	Text       string `yaml:"text"`
+	Regex      bool   `yaml:"regex"`
+	IgnoreCase bool   `yaml:"ignoreCase"`
+}
+
+// history keeps search strings and line numbers entered in the dialogs, the most recent ones first. It is saved
+// in the configuration directory, so it survives restarts of the program; an empty fileName keeps it in memory.
+type history struct {
+	Search   []searchHistoryEntry `yaml:"search"`
+	Goto     []int                `yaml:"goto"`
+	fileName string
+	size     int
+}
+
+// loadHistory reads the history from the file given; a missing or broken file gives an empty history.
+func loadHistory(fileName string, size int) *history {
+	result := &history{fileName: fileName, size: size}
+	if len(fileName) > 0 {
+		if data, err := ioutil.ReadFile(fileName); err == nil {
+			if err := yaml.Unmarshal(data, result); err != nil {
+				result.Search, result.Goto = nil, nil
+			}
+		}
+	}
+	result.trim()
+	return result
+}
+
+func (h *history) trim() {
+	if len(h.Search) > h.size {
+		h.Search = h.Search[:h.size]
+	}
+	if len(h.Goto) > h.size {
+		h.Goto = h.Goto[:h.size]
+	}
+}
+
+// refresh merges the history saved meanwhile by other instances of the program: entries read from the file come
+// first, followed by the ones not saved there.
+func (h *history) refresh() {
+	if len(h.fileName) == 0 {
+		return
+	}
+	saved := loadHistory(h.fileName, h.size)
+	for _, entry := range h.Search {
+		found := false
+		for _, e := range saved.Search {
+			found = found || e == entry
+		}
+		if !found {
+			saved.Search = append(saved.Search, entry)
+		}
+	}
+	for _, lineNo := range h.Goto {
+		found := false
+		for _, n := range saved.Goto {
+			found = found || n == lineNo
+		}
+		if !found {
+			saved.Goto = append(saved.Goto, lineNo)
+		}
+	}
+	h.Search, h.Goto = saved.Search, saved.Goto
+	h.trim()
+}
+
+// addSearch puts the search string in front of the history, removing its earlier occurrence.
+func (h *history) addSearch(entry searchHistoryEntry) {
+	result := []searchHistoryEntry{entry}
+	for _, e := range h.Search {
+		if e != entry {
+			result = append(result, e)
+		}
+	}
+	h.Search = result
+	h.trim()
+}
+
+// addGoto puts the line number in front of the history, removing its earlier occurrence.
+func (h *history) addGoto(lineNo int) {
+	result := []int{lineNo}
+	for _, n := range h.Goto {
+		if n != lineNo {
+			result = append(result, n)
+		}
+	}
+	h.Goto = result
+	h.trim()
+}
+
+// save writes the history to its file.
+func (h *history) save() error {
+	if len(h.fileName) == 0 {
+		return nil
+	}
+	return saveYaml(h.fileName, h)
+}
+
+// saveYaml writes the value to the file in YAML, replacing the file at once, so another instance of the program
+// never reads it half written.
+func saveYaml(fileName string, value interface{}) error {
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return err
+	}
+	dir := path.Dir(fileName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, "*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), fileName)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func (ctl *Controller) getHistoryFileName() string {
+	if ctl.conf.History.Size > 0 {
+		if dir := ctl.conf.GetDir(); len(dir) > 0 {
+			return path.Join(dir, historyFile)
+		}
+	}
+	return ""
+}
+
+func (ctl *Controller) saveHistory() {
+	if err := ctl.history.save(); err != nil {
+		ctl.view.GetStatusBar().Message("Cannot save the history: %s", err.Error())
+	}
+}
+
+// GetSearchHistory returns search strings entered recently, the most recent one first.
+func (ctl *Controller) GetSearchHistory() []view.SearchHistoryEntry {
+	result := make([]view.SearchHistoryEntry, len(ctl.history.Search))
+	for i, e := range ctl.history.Search {
+		result[i] = view.SearchHistoryEntry{Text: e.Text, Regex: e.Regex, IgnoreCase: e.IgnoreCase}
+	}
+	return result
+}
+
+// AddSearchHistory puts the search string in front of the search history.
+func (ctl *Controller) AddSearchHistory(text string, regex bool, ignoreCase bool) {
+	if len(text) == 0 || ctl.history.size <= 0 {
+		return
+	}
+	ctl.history.refresh()
+	ctl.history.addSearch(searchHistoryEntry{Text: text, Regex: regex, IgnoreCase: ignoreCase})
+	ctl.saveHistory()
+}
+
+// GetGotoHistory returns line numbers gone to recently, the most recent one first.
+func (ctl *Controller) GetGotoHistory() []int {
+	return append([]int(nil), ctl.history.Goto...)
+}
+
+// AddGotoHistory puts the line number in front of the history of lines gone to.
+func (ctl *Controller) AddGotoHistory(lineNo int) {
+	if lineNo <= 0 || ctl.history.size <= 0 {
+		return
+	}
+	ctl.history.refresh()
+	ctl.history.addGoto(lineNo)
+	ctl.saveHistory()
+}
@@ -0,0 +1,143 @@
+package controller
+
+// searchOrigin is the state of the view and of the search, when the search dialog was opened.
+type searchOrigin struct {
+	left, top, row               int
+	searchLastRow, searchLastCol int
+	startLine, startColumn       int
+	foundLine, foundStart        int
+	foundEnd, shownLine          int
+	query                        searchQuery
+	wrapAround                   bool
+	job                          *searchJob
+}
+
+// BeginIncrementalSearch remembers the position of the view, which incremental searches start from.
+func (ctl *Controller) BeginIncrementalSearch() {
+	ctl.endIncrementalJob()
+	left, top, _, _ := ctl.view.GetDisplayRect()
+	ctl.incremental = &searchOrigin{
+		left:          left,
+		top:           top,
+		row:           ctl.view.GetTopRow(),
+		searchLastRow: ctl.searchLastRow,
+		searchLastCol: ctl.searchLastCol,
+		foundLine:     ctl.foundLine,
+		foundStart:    ctl.foundStart,
+		foundEnd:      ctl.foundEnd,
+		shownLine:     ctl.shownLine,
+		query:         ctl.currentQuery(),
+		wrapAround:    ctl.searchWrapAround,
+		startLine:     ctl.searchLastRow,
+		startColumn:   ctl.searchLastCol,
+	}
+	if ctl.incremental.startLine < 0 {
+		ctl.incremental.startLine = top
+	}
+	if ctl.incremental.startColumn < 0 {
+		ctl.incremental.startColumn = left
+	}
+}
+
+// IncrementalSearch shows the next occurrence of the text being typed, counting from the position of the view
+// when the search dialog was opened. The search runs in the background, done is called in the UI thread with
+// false when there is no occurrence or the text is not a valid regular expression.
+func (ctl *Controller) IncrementalSearch(text string, regex bool, ignoreCase bool, done func(found bool)) {
+	if ctl.incremental == nil {
+		ctl.BeginIncrementalSearch()
+	}
+	ctl.endIncrementalJob()
+	o := ctl.incremental
+	if len(text) == 0 {
+		ctl.restoreQuery(o)
+		ctl.restoreOrigin(o)
+		done(true)
+		return
+	}
+	ctl.SetSearchText(text, regex, ignoreCase)
+	if _, hex := ctl.getHexPattern(); !hex && ctl.searchMatcher == nil {
+		ctl.showOrigin(o)
+		done(false)
+		return
+	}
+	doc := ctl.document
+	wrapAround := ctl.searchWrapAround
+	job := ctl.newSearchJob(func(percent int) {
+		ctl.safeMessage(doc, "Searching \"%s\"... %d%%", text, percent)
+	})
+	o.job = job
+	go func() {
+		line, start, end, lineText, wrapped, err := ctl.findWrapping(job, true, wrapAround, o.startLine, o.startColumn)
+		ctl.view.QueueUpdateDraw(func() {
+			if o.job != job || err == errSearchCancelled {
+				return
+			}
+			o.job = nil
+			if err != nil || line < 0 {
+				ctl.showOrigin(o)
+				done(false)
+				return
+			}
+			ctl.showSearchResult(line, start, end)
+			_, _, width, height := ctl.view.GetDisplayRect()
+			left, top, row := ctl.foundPosition(o.left, o.top, o.row, width, height, line, start, end, lineText)
+			if wrapped {
+				ctl.view.GetStatusBar().Message("Search wrapped to the beginning")
+			} else {
+				ctl.view.GetStatusBar().Reset()
+			}
+			ctl.displayAt(left, top, row)
+			done(true)
+		})
+	}()
+}
+
+// EndIncrementalSearch ends the incremental search, restoring the view and the search as they were before
+// it started, when the search is cancelled. Otherwise the view stays where it is, while the next search
+// starts from the original position, so it finds the occurrence shown.
+func (ctl *Controller) EndIncrementalSearch(cancel bool) {
+	o := ctl.incremental
+	if o == nil {
+		return
+	}
+	ctl.endIncrementalJob()
+	ctl.incremental = nil
+	if cancel {
+		ctl.restoreQuery(o)
+		ctl.restoreOrigin(o)
+		ctl.showLine(o.shownLine)
+		ctl.searchLastRow = o.searchLastRow
+		ctl.searchLastCol = o.searchLastCol
+	} else {
+		ctl.jumps.push(jumpPosition{left: o.left, top: o.top, row: o.row, line: o.shownLine})
+		ctl.searchLastRow = o.startLine
+		ctl.searchLastCol = o.startColumn
+	}
+}
+
+// endIncrementalJob stops the incremental search running, if any.
+func (ctl *Controller) endIncrementalJob() {
+	if o := ctl.incremental; o != nil && o.job != nil {
+		close(o.job.cancel)
+		o.job = nil
+	}
+}
+
+// restoreQuery sets the search string and options back to what they were when the search dialog was opened.
+func (ctl *Controller) restoreQuery(o *searchOrigin) {
+	ctl.SetSearchOptions(o.query.wholeWord, o.query.smartCase, o.wrapAround)
+	ctl.SetSearchText(o.query.text, o.query.regex, o.query.ignoreCase)
+}
+
+// showOrigin moves the view back to where it was when the search dialog was opened, without any occurrence shown.
+func (ctl *Controller) showOrigin(o *searchOrigin) {
+	ctl.showSearchResult(-1, -1, -1)
+	ctl.displayAt(o.left, o.top, o.row)
+}
+
+// restoreOrigin moves the view back to where it was when the search dialog was opened, with the occurrence
+// shown then.
+func (ctl *Controller) restoreOrigin(o *searchOrigin) {
+	ctl.showSearchResult(o.foundLine, o.foundStart, o.foundEnd)
+	ctl.displayAt(o.left, o.top, o.row)
+}
@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"crypto/sha1"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bry00/m/buffers"
+	"github.com/bry00/m/utl"
+)
+
+const indexCacheDir = "index"
+const indexCacheSuffix = ".idx"
+const indexTailSize = 4 * buffers.KB
+
+// maxIndexCacheFiles is the number of index files kept in the cache, the ones used least recently are removed.
+const maxIndexCacheFiles = 100
+
+// maxIndexCacheAge is the age of index files, which are removed from the cache as not used for too long.
+const maxIndexCacheAge = 90 * 24 * time.Hour
+
+// indexCacheEntry is the frames index of a file stored in the sidecar cache, together with the identity
+// of the file it was built for. Indexed is the number of bytes of the file covered by the index. Settings
+// describe options of reading the file, which the length of the longest line depends on.
+type indexCacheEntry struct {
+	Path          string
+	Settings      string
+	Size          int64
+	ModTime       int64
+	Inode         uint64
+	Indexed       int64
+	TailChecksum  uint32
+	MaxLineLength int
+	Index         *buffers.FrameIndex
+}
+
+func indexCacheFileName(dir string, filePath string) string {
+	sum := sha1.Sum([]byte(filePath))
+	return path.Join(dir, hex.EncodeToString(sum[:])+indexCacheSuffix)
+}
+
+// tailChecksum computes the checksum of the bytes preceding the end offset, which is enough to tell
+// whether the file was just appended to or rather rewritten.
+func tailChecksum(file *os.File, end int64) (uint32, error) {
+	start := end - indexTailSize
+	if start < 0 {
+		start = 0
+	}
+	hash := crc32.NewIEEE()
+	if _, err := io.Copy(hash, io.NewSectionReader(file, start, end-start)); err != nil {
+		return 0, err
+	}
+	return hash.Sum32(), nil
+}
+
+// loadIndexCache returns the cached index of the file, or nil if there is no valid one. The index is valid
+// if the file has the same identity, its indexed part did not change since the index was stored and it was read
+// with the same settings.
+func loadIndexCache(dir string, file *os.File, filePath string, settings string) *indexCacheEntry {
+	info, err := file.Stat()
+	if err != nil {
+		return nil
+	}
+	f, err := os.Open(indexCacheFileName(dir, filePath))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var entry indexCacheEntry
+	if err := gob.NewDecoder(f).Decode(&entry); err != nil || entry.Index == nil {
+		return nil
+	}
+	if entry.Path != filePath || entry.Settings != settings || entry.Inode != utl.FileInode(info) ||
+		entry.Indexed > info.Size() {
+		return nil
+	}
+	if entry.Size != info.Size() || entry.ModTime != info.ModTime().UnixNano() {
+		if sum, err := tailChecksum(file, entry.Indexed); err != nil || sum != entry.TailChecksum {
+			return nil
+		}
+	}
+	return &entry
+}
+
+func saveIndexCache(dir string, file *os.File, filePath string, settings string, indexed int64, maxLineLength int,
+	index *buffers.FrameIndex) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return errors.New("only the index of a regular file can be cached")
+	}
+	sum, err := tailChecksum(file, indexed)
+	if err != nil {
+		return err
+	}
+	entry := &indexCacheEntry{
+		Path:          filePath,
+		Settings:      settings,
+		Size:          info.Size(),
+		ModTime:       info.ModTime().UnixNano(),
+		Inode:         utl.FileInode(info),
+		Indexed:       indexed,
+		TailChecksum:  sum,
+		MaxLineLength: maxLineLength,
+		Index:         index,
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, "*.tmp")
+	if err != nil {
+		return err
+	}
+	err = gob.NewEncoder(tmp).Encode(entry)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), indexCacheFileName(dir, filePath))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	} else {
+		pruneIndexCache(dir, maxIndexCacheFiles, maxIndexCacheAge)
+	}
+	return err
+}
+
+// pruneIndexCache removes index files older than maxAge and the least recently stored ones above the number
+// of files to keep.
+func pruneIndexCache(dir string, keep int, maxAge time.Duration) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	files := make([]os.FileInfo, 0, len(infos))
+	for _, info := range infos {
+		if info.Mode().IsRegular() && strings.HasSuffix(info.Name(), indexCacheSuffix) {
+			files = append(files, info)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().After(files[j].ModTime())
+	})
+	for i, info := range files {
+		if i >= keep || time.Since(info.ModTime()) > maxAge {
+			os.Remove(path.Join(dir, info.Name()))
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"github.com/bry00/m/view"
+)
+
+// maxJumps is the number of positions kept in the jump list of a document.
+const maxJumps = 100
+
+// jumpPosition is a position of the view: its left column, top line and row, and the line highlighted.
+type jumpPosition struct {
+	left, top, row, line int
+}
+
+// jumpList keeps positions of the view left by big moves (searching, going to a line or a mark, to the top or
+// the bottom), to go back and forth through them, like a web browser does.
+type jumpList struct {
+	entries []jumpPosition
+	current int // the position gone back to; len(entries) when not going through the list
+}
+
+// push records the position left by a jump; positions gone back from are dropped. It returns the number of
+// the oldest positions dropped, to keep the list bounded.
+func (j *jumpList) push(p jumpPosition) int {
+	j.entries = j.entries[:j.current]
+	if n := len(j.entries); n == 0 || j.entries[n-1] != p {
+		j.entries = append(j.entries, p)
+	}
+	dropped := 0
+	if len(j.entries) > maxJumps {
+		dropped = len(j.entries) - maxJumps
+		j.entries = append(j.entries[:0], j.entries[dropped:]...)
+	}
+	j.current = len(j.entries)
+	return dropped
+}
+
+// back returns the position preceding the current one; here is the position of the view, which is recorded
+// to come back to it, unless going through the list already.
+func (j *jumpList) back(here jumpPosition) (jumpPosition, bool) {
+	if j.current == len(j.entries) {
+		if len(j.entries) == 0 {
+			return here, false
+		}
+		if j.entries[len(j.entries)-1] != here {
+			j.push(here)
+		}
+		j.current = len(j.entries) - 1
+	}
+	if j.current == 0 {
+		return here, false
+	}
+	j.current--
+	return j.entries[j.current], true
+}
+
+// forward returns the position following the current one, after going back.
+func (j *jumpList) forward() (jumpPosition, bool) {
+	if j.current+1 >= len(j.entries) {
+		return jumpPosition{}, false
+	}
+	j.current++
+	return j.entries[j.current], true
+}
+
+func (j *jumpList) clear() {
+	j.entries = nil
+	j.current = 0
+}
+
+// viewPosition returns the current position of the view.
+func (ctl *Controller) viewPosition() jumpPosition {
+	left, top, _, _ := ctl.view.GetDisplayRect()
+	return jumpPosition{left: left, top: top, row: ctl.view.GetTopRow(), line: ctl.shownLine}
+}
+
+// recordJump records the position of the view, which is about to be left by a big move.
+func (ctl *Controller) recordJump() {
+	ctl.jumps.push(ctl.viewPosition())
+}
+
+func (ctl *Controller) showJump(p jumpPosition) {
+	if frozenTop := ctl.frozenTop(); p.top < frozenTop && frozenTop < ctl.shown().Len() {
+		p.top, p.row = frozenTop, 0
+	}
+	ctl.showLine(p.line)
+	ctl.displayAt(p.left, p.top, p.row)
+	ctl.view.GetStatusBar().Message("Jump %d of %d: line #%d", ctl.jumps.current+1, len(ctl.jumps.entries),
+		ctl.GetSourceLine(p.top)+1)
+}
+
+func (ctl *Controller) jumpBack() {
+	if p, ok := ctl.jumps.back(ctl.viewPosition()); ok {
+		ctl.showJump(p)
+	} else {
+		ctl.view.GetStatusBar().Message("There is no position to go back to")
+	}
+}
+
+func (ctl *Controller) jumpForward() {
+	if p, ok := ctl.jumps.forward(); ok {
+		ctl.showJump(p)
+	} else {
+		ctl.view.GetStatusBar().Message("There is no position to go forward to")
+	}
+}
+
+// GetJumps returns positions of the jump list, the most recent one first.
+func (ctl *Controller) GetJumps() []view.Jump {
+	count := len(ctl.jumps.entries)
+	result := make([]view.Jump, count)
+	for i, p := range ctl.jumps.entries {
+		jump := view.Jump{LineNo: ctl.GetSourceLine(p.top) + 1, Current: i == ctl.jumps.current}
+		if line, err := ctl.shown().GetLine(p.top); err == nil {
+			jump.Text = ctl.visibleText(line)
+		}
+		result[count-1-i] = jump
+	}
+	return result
+}
+
+// GotoJump goes to the position of the index given, as returned by GetJumps.
+func (ctl *Controller) GotoJump(index int) {
+	index = len(ctl.jumps.entries) - 1 - index
+	if index < 0 || index >= len(ctl.jumps.entries) {
+		return
+	}
+	if ctl.jumps.current == len(ctl.jumps.entries) {
+		if here := ctl.viewPosition(); ctl.jumps.entries[len(ctl.jumps.entries)-1] != here {
+			index -= ctl.jumps.push(here)
+			if index < 0 {
+				return
+			}
+		}
+	}
+	ctl.jumps.current = index
+	ctl.showJump(ctl.jumps.entries[index])
+}
@@ -0,0 +1,308 @@
+package controller
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bry00/m/utl"
+	"github.com/bry00/m/view"
+	"gopkg.in/yaml.v2"
+)
+
+// numericValue matches values of numeric fields: digits with an optional decimal point and sign.
+var numericValue = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)[+-]?$`)
+
+// numericTypes are types of fields, which values are checked to be numbers.
+var numericTypes = []string{"numeric", "number", "num", "decimal", "integer", "int", "zoned"}
+
+// layoutFileField is a field of a record layout file; its start is counted from 1. The line of the field is known
+// for text files only.
+type layoutFileField struct {
+	Name   string `yaml:"name"`
+	Start  int    `yaml:"start"`
+	Length int    `yaml:"length"`
+	Type   string `yaml:"type"`
+	line   int
+}
+
+// where tells where the field of the given index is defined in the layout file, for error messages.
+func (f layoutFileField) where(fileName string, index int) string {
+	if f.line > 0 {
+		return fmt.Sprintf("layout %s, line %d", fileName, f.line)
+	}
+	return fmt.Sprintf("layout %s, field #%d", fileName, index+1)
+}
+
+type layoutFile struct {
+	Name   string            `yaml:"name"`
+	Fields []layoutFileField `yaml:"fields"`
+}
+
+// recordLayout describes fields of fixed-width lines (records), sorted by their starts.
+type recordLayout struct {
+	name   string
+	fields []view.LayoutField
+}
+
+// loadLayout reads the record layout file: a YAML file (.yaml or .yml) with the name of the layout and the list
+// of its fields, or a text file with a field per line given as: name, start, length and (optionally) type,
+// separated by blanks; lines starting with # are comments.
+func loadLayout(fileName string) (*recordLayout, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var file layoutFile
+	switch strings.ToLower(path.Ext(fileName)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("layout %s: %v", fileName, err)
+		}
+	default:
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for lineNo := 1; scanner.Scan(); lineNo++ {
+			words := strings.Fields(scanner.Text())
+			if len(words) == 0 || strings.HasPrefix(words[0], "#") {
+				continue
+			}
+			if len(words) < 3 || len(words) > 4 {
+				return nil, fmt.Errorf("layout %s, line %d: name, start, length and type expected", fileName, lineNo)
+			}
+			field := layoutFileField{Name: words[0], Type: strings.Join(words[3:], ""), line: lineNo}
+			var errStart, errLength error
+			field.Start, errStart = strconv.Atoi(words[1])
+			field.Length, errLength = strconv.Atoi(words[2])
+			if errStart != nil || errLength != nil {
+				return nil, fmt.Errorf("layout %s, line %d: wrong start or length", fileName, lineNo)
+			}
+			file.Fields = append(file.Fields, field)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return newRecordLayout(fileName, &file)
+}
+
+// newRecordLayout checks fields of the layout file and sorts them by their starts; the layout is named after
+// the file, unless it has a name. Names of fields must be unique (case insensitively) and fields must not overlap.
+func newRecordLayout(fileName string, file *layoutFile) (*recordLayout, error) {
+	if len(file.Fields) == 0 {
+		return nil, fmt.Errorf("layout %s: there are no fields", fileName)
+	}
+	result := &recordLayout{name: strings.TrimSpace(file.Name), fields: make([]view.LayoutField, len(file.Fields))}
+	if len(result.name) == 0 {
+		result.name = strings.TrimSuffix(filepath.Base(fileName), path.Ext(fileName))
+	}
+	names := make(map[string]bool, len(file.Fields))
+	for i, f := range file.Fields {
+		if len(strings.TrimSpace(f.Name)) == 0 || f.Start < 1 || f.Length < 1 {
+			return nil, fmt.Errorf("%s: a field needs a name, a start (from 1) and a length", f.where(fileName, i))
+		}
+		name := strings.TrimSpace(f.Name)
+		if names[strings.ToLower(name)] {
+			return nil, fmt.Errorf("%s: field %s is defined twice", f.where(fileName, i), name)
+		}
+		names[strings.ToLower(name)] = true
+		result.fields[i] = view.LayoutField{Name: name, Start: f.Start - 1, Length: f.Length,
+			Type: strings.TrimSpace(f.Type)}
+	}
+	order := make([]int, len(file.Fields))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return result.fields[order[i]].Start < result.fields[order[j]].Start
+	})
+	sorted := make([]view.LayoutField, len(order))
+	for k, i := range order {
+		sorted[k] = result.fields[i]
+		if k == 0 {
+			continue
+		}
+		if previous := sorted[k-1]; sorted[k].Start < previous.Start+previous.Length {
+			// The field defined later in the file is reported
+			later := utl.MaxInt(i, order[k-1])
+			return nil, fmt.Errorf("%s: fields %s and %s overlap", file.Fields[later].where(fileName, later),
+				previous.Name, sorted[k].Name)
+		}
+	}
+	result.fields = sorted
+	return result, nil
+}
+
+// isValidValue tells whether the value of the field is of the type of the field; blank values are valid.
+func isValidValue(fieldType string, value string) bool {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return true
+	}
+	for _, t := range numericTypes {
+		if strings.EqualFold(fieldType, t) {
+			return numericValue.MatchString(value)
+		}
+	}
+	return true
+}
+
+// fieldValue returns the value of the field in the text of the line (with tabs expanded).
+func fieldValue(text []rune, field view.LayoutField) string {
+	if field.Start >= len(text) {
+		return ""
+	}
+	end := field.Start + field.Length
+	if end > len(text) {
+		end = len(text)
+	}
+	return string(text[field.Start:end])
+}
+
+// SetLayout sets the record layout of all the files, from the layout file given.
+func (ctl *Controller) SetLayout(fileName string) error {
+	layout, err := loadLayout(fileName)
+	if err != nil {
+		return err
+	}
+	for _, doc := range ctl.docs {
+		doc.layout = layout
+	}
+	return nil
+}
+
+// SelectLayouts sets record layouts of files by the layouts section of the configuration: the layout of the first
+// rule with the pattern matching the name of a file (case insensitively).
+func (ctl *Controller) SelectLayouts() error {
+	loaded := make(map[string]*recordLayout)
+	for _, doc := range ctl.docs {
+		if doc.fileName == nil {
+			continue
+		}
+		name := strings.ToLower(filepath.Base(*doc.fileName))
+		for _, rule := range ctl.conf.Layouts {
+			if matched, err := filepath.Match(strings.ToLower(rule.Pattern), name); err != nil || !matched {
+				continue
+			}
+			fileName := rule.File
+			if dir := ctl.conf.GetDir(); !filepath.IsAbs(fileName) && len(dir) > 0 {
+				fileName = filepath.Join(dir, fileName)
+			}
+			if _, ok := loaded[fileName]; !ok {
+				layout, err := loadLayout(fileName)
+				if err != nil {
+					return err
+				}
+				loaded[fileName] = layout
+			}
+			doc.layout = loaded[fileName]
+			break
+		}
+	}
+	return nil
+}
+
+// GetLayoutFields returns fields of the record layout of the file; none in the table mode or for a hex dump.
+func (ctl *Controller) GetLayoutFields() []view.LayoutField {
+	if ctl.layout == nil || ctl.table != nil || ctl.hexShown {
+		return nil
+	}
+	return ctl.layout.fields
+}
+
+// GetColumnCursor returns the column of the cursor, which points a field of the record layout; -1 if there are
+// no fields.
+func (ctl *Controller) GetColumnCursor() int {
+	if ctl.GetLayoutFields() == nil {
+		return -1
+	}
+	return ctl.cursorColumn
+}
+
+// SetColumnCursor moves the column cursor to the column given, the view is scrolled to show it.
+func (ctl *Controller) SetColumnCursor(column int) {
+	left, top, width, _ := ctl.view.GetDisplayRect()
+	ctl.displayAt(ctl.moveCursor(column, left, width), top, ctl.view.GetTopRow())
+}
+
+// moveCursor moves the column cursor to the column given, shows it on the ruler and describes the field pointed.
+// It returns the left column of the view, which shows the cursor.
+func (ctl *Controller) moveCursor(column int, left int, width int) int {
+	fields := ctl.GetLayoutFields()
+	if fields == nil {
+		ctl.view.GetStatusBar().Message("The column cursor works with a record layout only")
+		return left
+	}
+	if column < 0 {
+		column = 0
+	}
+	ctl.cursorColumn = column
+	ctl.view.ShowRuler(true)
+	if column >= ctl.frozenColumns && !ctl.view.IsWrapped() {
+		if column < left {
+			left = column
+		} else if column >= left+width {
+			left = column - width + 1
+		}
+	}
+	if f := view.FieldAt(fields, column); f < 0 {
+		ctl.view.GetStatusBar().Message("Column %d: no field", column+1)
+	} else {
+		field := fields[f]
+		_, values := ctl.GetRecordFields()
+		ctl.view.GetStatusBar().Message("Column %d: %s (%s, columns %d-%d) = \"%s\"", column+1, field.Name,
+			describeFieldType(field.Type), field.Start+1, field.Start+field.Length, values[f].Value)
+	}
+	return left
+}
+
+// moveCursorToField moves the column cursor to the start of the next (or previous) field.
+func (ctl *Controller) moveCursorToField(left int, width int, next bool) int {
+	fields := ctl.GetLayoutFields()
+	column := ctl.cursorColumn
+	if next {
+		for _, f := range fields {
+			if f.Start > ctl.cursorColumn {
+				column = f.Start
+				break
+			}
+		}
+	} else {
+		for _, f := range fields {
+			if f.Start < ctl.cursorColumn {
+				column = f.Start
+			}
+		}
+	}
+	return ctl.moveCursor(column, left, width)
+}
+
+func describeFieldType(fieldType string) string {
+	if len(fieldType) == 0 {
+		return "no type"
+	}
+	return fieldType
+}
+
+// GetRecordFields returns the number of the line pointed (or the top one) and values of all fields of the record
+// layout in it.
+func (ctl *Controller) GetRecordFields() (int, []view.RecordField) {
+	fields := ctl.GetLayoutFields()
+	lineIndex := ctl.markedLine()
+	var text []rune
+	if line, err := ctl.shown().GetLine(lineIndex); err == nil {
+		text = []rune(ctl.searchTextExpander()(line))
+	}
+	result := make([]view.RecordField, len(fields))
+	for i, f := range fields {
+		value := fieldValue(text, f)
+		result[i] = view.RecordField{LayoutField: f, Value: value, Valid: isValidValue(f.Type, value)}
+	}
+	return ctl.GetSourceLine(lineIndex) + 1, result
+}
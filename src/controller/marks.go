@@ -0,0 +1,221 @@
+package controller
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/bry00/m/utl"
+	"github.com/bry00/m/view"
+	"gopkg.in/yaml.v2"
+)
+
+const marksFile = "marks.yaml"
+
+// maxMarkedFiles is the number of files, which marks are kept for; marks of files not opened for a long time
+// are dropped.
+const maxMarkedFiles = 200
+
+// fileMarks are marks of a file stored, together with the identity of the file they were set for. Size is the size
+// of the file, when the marks were saved: a file, which is smaller now, has been rewritten and its marks are
+// no longer valid.
+type fileMarks struct {
+	Path  string         `yaml:"path"`
+	Inode uint64         `yaml:"inode"`
+	Size  int64          `yaml:"size"`
+	Used  int64          `yaml:"used"`
+	Marks map[string]int `yaml:"marks"`
+}
+
+type marksStore struct {
+	Files []*fileMarks `yaml:"files"`
+}
+
+func readMarksStore(fileName string) *marksStore {
+	result := &marksStore{}
+	if data, err := ioutil.ReadFile(fileName); err == nil {
+		if err := yaml.Unmarshal(data, result); err != nil {
+			result.Files = nil
+		}
+	}
+	return result
+}
+
+// loadMarks returns the marks stored for the file, if it is the same file they were set for.
+func loadMarks(fileName string, filePath string) map[rune]int {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil
+	}
+	for _, f := range readMarksStore(fileName).Files {
+		if f.Path != filePath {
+			continue
+		}
+		if f.Inode != utl.FileInode(info) || f.Size > info.Size() {
+			return nil
+		}
+		result := make(map[rune]int)
+		for name, line := range f.Marks {
+			if r := []rune(name); len(r) == 1 && isMarkName(r[0]) && line >= 0 {
+				result[r[0]] = line
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// saveMarks stores the marks of the file, replacing the ones stored before.
+func saveMarks(fileName string, filePath string, marks map[rune]int) error {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	store := readMarksStore(fileName)
+	files := make([]*fileMarks, 0, len(store.Files)+1)
+	if len(marks) > 0 {
+		entry := &fileMarks{
+			Path:  filePath,
+			Inode: utl.FileInode(info),
+			Size:  info.Size(),
+			Used:  time.Now().Unix(),
+			Marks: make(map[string]int),
+		}
+		for name, line := range marks {
+			entry.Marks[string(name)] = line
+		}
+		files = append(files, entry)
+	}
+	for _, f := range store.Files {
+		if f.Path != filePath {
+			files = append(files, f)
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].Used > files[j].Used
+	})
+	if len(files) > maxMarkedFiles {
+		files = files[:maxMarkedFiles]
+	}
+	store.Files = files
+	return saveYaml(fileName, store)
+}
+
+func isMarkName(name rune) bool {
+	return name >= 'a' && name <= 'z'
+}
+
+func (ctl *Controller) getMarksFileName() string {
+	if dir := ctl.conf.GetDir(); len(dir) > 0 {
+		return path.Join(dir, marksFile)
+	}
+	return ""
+}
+
+// restoreMarks restores the marks of the document saved the last time it was browsed.
+func (ctl *Controller) restoreMarks(doc *document) {
+	if fileName := ctl.getMarksFileName(); len(fileName) > 0 && doc.fileName != nil {
+		doc.marks = loadMarks(fileName, *doc.fileName)
+	}
+}
+
+// storeMarks saves the marks of the current document, the marks of the standard input are not saved.
+func (ctl *Controller) storeMarks() {
+	if fileName := ctl.getMarksFileName(); len(fileName) > 0 && ctl.fileName != nil {
+		if err := saveMarks(fileName, *ctl.fileName, ctl.marks); err != nil {
+			ctl.view.GetStatusBar().Message("Cannot save marks: %s", err.Error())
+		}
+	}
+}
+
+// markedLine returns the index of the line to be marked: the line pointed, when it is shown, or the top one.
+func (ctl *Controller) markedLine() int {
+	_, top, _, height := ctl.view.GetDisplayRect()
+	if ctl.shownLine >= top && ctl.shownLine < top+height {
+		return ctl.shownLine
+	}
+	return top
+}
+
+// SetMark marks the line pointed (or the top one) with the letter given.
+func (ctl *Controller) SetMark(name rune) {
+	if !isMarkName(name) {
+		ctl.view.GetStatusBar().Message("Marks are letters from a to z")
+		return
+	}
+	lineIndex := ctl.markedLine()
+	if lineIndex >= ctl.shown().Len() {
+		ctl.view.GetStatusBar().Message("There is no line to mark")
+		return
+	}
+	if ctl.marks == nil {
+		ctl.marks = make(map[rune]int)
+	}
+	sourceLine := ctl.GetSourceLine(lineIndex)
+	ctl.marks[name] = sourceLine
+	ctl.storeMarks()
+	ctl.view.GetStatusBar().Message("Mark '%c' set at line #%d", name, sourceLine+1)
+}
+
+// GotoMark shows the line marked with the letter given.
+func (ctl *Controller) GotoMark(name rune) {
+	sourceLine, ok := ctl.marks[name]
+	if !ok {
+		ctl.view.GetStatusBar().Message("Mark '%c' is not set", name)
+		return
+	}
+	if sourceLine >= ctl.data.Len() {
+		ctl.view.GetStatusBar().Message("Mark '%c' is at line #%d, beyond the lines read", name, sourceLine+1)
+		return
+	}
+	ctl.recordJump()
+	left, _, width, height := ctl.view.GetDisplayRect()
+	lineIndex := utl.MinInt(ctl.shownIndex(sourceLine), ctl.shown().Len()-1)
+	top, row := ctl.positionAbove(lineIndex, height/3, width)
+	ctl.showLine(lineIndex)
+	ctl.view.GetStatusBar().Message("Mark '%c': line #%d", name, sourceLine+1)
+	ctl.displayAt(left, top, row)
+}
+
+// DeleteMark removes the mark of the letter given.
+func (ctl *Controller) DeleteMark(name rune) {
+	if _, ok := ctl.marks[name]; ok {
+		delete(ctl.marks, name)
+		ctl.storeMarks()
+	}
+}
+
+// GetMarks returns marks of the current document ordered by their letters.
+func (ctl *Controller) GetMarks() []view.Mark {
+	result := make([]view.Mark, 0, len(ctl.marks))
+	for name, sourceLine := range ctl.marks {
+		mark := view.Mark{Name: name, LineNo: sourceLine + 1}
+		if sourceLine < ctl.data.Len() {
+			if line, err := ctl.data.GetLine(sourceLine); err == nil {
+				mark.Text = ctl.visibleText(line)
+			}
+		}
+		result = append(result, mark)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// GetLineMark returns the letter of the mark of the line shown, or 0 if the line is not marked.
+func (ctl *Controller) GetLineMark(lineIndex int) rune {
+	if len(ctl.marks) == 0 {
+		return 0
+	}
+	sourceLine := ctl.GetSourceLine(lineIndex)
+	var result rune
+	for name, line := range ctl.marks {
+		if line == sourceLine && (result == 0 || name < result) {
+			result = name
+		}
+	}
+	return result
+}
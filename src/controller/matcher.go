@@ -0,0 +1,195 @@
+package controller
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+)
+
+// searchQuery is what is searched for. It is taken when a search starts, so changes made meanwhile in the UI
+// thread do not affect the search.
+type searchQuery struct {
+	text       string
+	regex      bool
+	ignoreCase bool
+	wholeWord  bool
+	smartCase  bool
+}
+
+// matcher finds all occurrences of a string or of a regular expression in lines of text. A plain string is
+// searched for in the text folded (with the full Unicode case folding, e.g. "ß" matches "SS"), when the case
+// is ignored; offsets found are mapped back to the original text. Regular expressions use the simple case
+// folding of the regexp package.
+type matcher struct {
+	re        *regexp.Regexp
+	text      string
+	fold      bool
+	wholeWord bool
+}
+
+func newMatcher(q searchQuery) (*matcher, error) {
+	ignoreCase := q.ignoreCase
+	if q.smartCase {
+		ignoreCase = !hasUpper(q.text, q.regex)
+	}
+	result := &matcher{
+		wholeWord: q.wholeWord,
+	}
+	if q.regex {
+		text := q.text
+		if ignoreCase && !strings.HasPrefix(text, "(?i)") {
+			text = "(?i)" + text
+		}
+		re, err := regexp.Compile(text)
+		if err != nil {
+			return nil, err
+		}
+		result.re = re
+		return result, nil
+	}
+	result.fold = ignoreCase
+	if ignoreCase {
+		result.text, _, _ = foldCase(q.text)
+	} else {
+		result.text = q.text
+	}
+	return result, nil
+}
+
+// findAll returns byte offsets of the start and the end of all not empty occurrences found in the text.
+func (m *matcher) findAll(text string) [][]int {
+	if m.re != nil {
+		result := m.re.FindAllStringIndex(text, -1)
+		n := 0
+		for _, found := range result {
+			if found[1] > found[0] && (!m.wholeWord || isWholeWord(text, found[0], found[1])) {
+				result[n] = found
+				n++
+			}
+		}
+		return result[:n]
+	}
+	result := make([][]int, 0)
+	if len(m.text) == 0 {
+		return result
+	}
+	searched, starts, ends := text, []int(nil), []int(nil)
+	if m.fold {
+		searched, starts, ends = foldCase(text)
+	}
+	for pos := 0; pos < len(searched); {
+		i := strings.Index(searched[pos:], m.text)
+		if i < 0 {
+			break
+		}
+		start, end := pos+i, pos+i+len(m.text)
+		origStart, origEnd := start, end
+		if m.fold {
+			origStart, origEnd = starts[start], ends[end-1]
+		}
+		if !m.wholeWord || isWholeWord(text, origStart, origEnd) {
+			result = append(result, []int{origStart, origEnd})
+			pos = end
+		} else {
+			pos = start + 1
+		}
+	}
+	return result
+}
+
+// foldedRunes caches case folding of runes other than ASCII ones.
+var foldedRunes sync.Map
+
+// foldRune returns the rune case folded. Runes differing in case only are folded the same way, though the result
+// is not necessarily in lower case.
+func foldRune(r rune) string {
+	if r < utf8.RuneSelf {
+		if 'a' <= r && r <= 'z' {
+			r -= 'a' - 'A'
+		}
+		return string(r)
+	}
+	if folded, ok := foldedRunes.Load(r); ok {
+		return folded.(string)
+	}
+	var b strings.Builder
+	for _, f := range cases.Fold().String(string(r)) {
+		b.WriteRune(minFold(f))
+	}
+	folded := b.String()
+	foldedRunes.Store(r, folded)
+	return folded
+}
+
+// minFold returns the smallest rune equivalent to the given one under the simple case folding.
+func minFold(r rune) rune {
+	result := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		if f < result {
+			result = f
+		}
+	}
+	return result
+}
+
+// foldCase returns the text case folded, and for each byte of the result: the offsets of the start and the end
+// of the character of the original text it comes from.
+func foldCase(text string) (string, []int, []int) {
+	var b strings.Builder
+	b.Grow(len(text))
+	starts := make([]int, 0, len(text))
+	ends := make([]int, 0, len(text))
+	for i, r := range text {
+		folded := foldRune(r)
+		end := i + utf8.RuneLen(r)
+		if r == utf8.RuneError {
+			_, size := utf8.DecodeRuneInString(text[i:])
+			end = i + size
+		}
+		b.WriteString(folded)
+		for j := 0; j < len(folded); j++ {
+			starts = append(starts, i)
+			ends = append(ends, end)
+		}
+	}
+	return b.String(), starts, ends
+}
+
+// hasUpper tells whether the text contains upper case letters; escaped characters of a regular expression
+// (like \S) do not count.
+func hasUpper(text string, regex bool) bool {
+	escaped := false
+	for _, r := range text {
+		if regex && !escaped && r == '\\' {
+			escaped = true
+			continue
+		}
+		if !escaped && unicode.IsUpper(r) {
+			return true
+		}
+		escaped = false
+	}
+	return false
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r)
+}
+
+// isWholeWord tells whether the part of the text is not a part of a longer word: a word character at its
+// start (or end) is not preceded (or followed) by another one.
+func isWholeWord(text string, start int, end int) bool {
+	first, _ := utf8.DecodeRuneInString(text[start:end])
+	if before, size := utf8.DecodeLastRuneInString(text[:start]); size > 0 && isWordRune(first) && isWordRune(before) {
+		return false
+	}
+	last, _ := utf8.DecodeLastRuneInString(text[start:end])
+	if after, size := utf8.DecodeRuneInString(text[end:]); size > 0 && isWordRune(last) && isWordRune(after) {
+		return false
+	}
+	return true
+}
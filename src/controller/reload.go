@@ -0,0 +1,192 @@
+package controller
+
+import (
+	"hash/fnv"
+	"os"
+	"sync"
+
+	"github.com/bry00/m/buffers"
+)
+
+// changeTracker keeps hashes of the lines read, so when the file is read again, lines which have not been
+// present in its previous version can be told apart. Tracking stops for files exceeding maxLines. Lines are not
+// tracked, until the tracker is activated, when the file is read again for the first time or reloaded
+// automatically, so files never reloaded are not hashed at all.
+type changeTracker struct {
+	mutex    sync.Mutex
+	active   bool
+	maxLines int
+	hashes   []uint64
+	old      []uint64
+	previous map[uint64]int
+	changed  []bool
+	count    int
+	missing  bool
+}
+
+func newChangeTracker(maxLines int) *changeTracker {
+	return &changeTracker{
+		active:   false,
+		maxLines: maxLines,
+		hashes:   nil,
+	}
+}
+
+// activate makes the tracker keep hashes of lines, from the next version of the file on.
+func (t *changeTracker) activate() {
+	defer t.mutex.Unlock()
+	t.mutex.Lock()
+	t.active = true
+}
+
+// start begins tracking of a new version of the file, which is compared with the previous one
+// if compare is set.
+func (t *changeTracker) start(compare bool) {
+	defer t.mutex.Unlock()
+	t.mutex.Lock()
+	t.old = nil
+	t.previous = nil
+	t.changed = nil
+	t.count = 0
+	t.missing = false
+	if !t.active {
+		t.hashes = nil
+		return
+	}
+	if compare && t.hashes != nil {
+		t.old = t.hashes
+		t.previous = make(map[uint64]int, len(t.hashes))
+		for _, h := range t.hashes {
+			t.previous[h]++
+		}
+		t.changed = []bool{}
+	}
+	t.hashes = []uint64{}
+}
+
+// keep accounts for the first lines restored from the index cache, i.e. not changed since the file was read last time.
+func (t *changeTracker) keep(noOfLines int) {
+	defer t.mutex.Unlock()
+	t.mutex.Lock()
+	if t.hashes == nil {
+		return
+	}
+	if t.previous == nil || len(t.old) < noOfLines {
+		// Hashes of the lines not read are unknown, they have to be computed later on
+		t.hashes = nil
+		t.previous = nil
+		t.changed = nil
+		t.missing = true
+		return
+	}
+	for _, h := range t.old[:noOfLines] {
+		t.hashes = append(t.hashes, h)
+		t.previous[h]--
+		t.changed = append(t.changed, false)
+	}
+}
+
+// rebuild computes the missing hashes of all the lines of the store, so the next version of the file
+// can be compared with it.
+func (t *changeTracker) rebuild(store buffers.LineStore) {
+	t.mutex.Lock()
+	missing := t.missing && store.Len() <= t.maxLines
+	t.missing = false
+	t.mutex.Unlock()
+	if !missing {
+		return
+	}
+	hashes := make([]uint64, 0, store.Len())
+	for i := store.Iterator(); i.IndexOK(); i.IndexIncrement() {
+		if line, err := i.GetLine(); err == nil {
+			hashes = append(hashes, lineHash(line))
+		} else {
+			return
+		}
+	}
+	defer t.mutex.Unlock()
+	t.mutex.Lock()
+	t.hashes = hashes
+}
+
+func lineHash(line string) uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(line))
+	return hash.Sum64()
+}
+
+func (t *changeTracker) add(line string) {
+	defer t.mutex.Unlock()
+	t.mutex.Lock()
+	if t.hashes == nil {
+		return
+	}
+	if len(t.hashes) >= t.maxLines {
+		t.hashes = nil
+		t.previous = nil
+		t.changed = nil
+		return
+	}
+	h := lineHash(line)
+	t.hashes = append(t.hashes, h)
+	if t.previous != nil {
+		isNew := t.previous[h] == 0
+		if isNew {
+			t.count++
+		} else {
+			t.previous[h]--
+		}
+		t.changed = append(t.changed, isNew)
+	}
+}
+
+func (t *changeTracker) isChanged(lineIndex int) bool {
+	defer t.mutex.Unlock()
+	t.mutex.Lock()
+	return lineIndex >= 0 && lineIndex < len(t.changed) && t.changed[lineIndex]
+}
+
+func (t *changeTracker) changedCount() (int, bool) {
+	defer t.mutex.Unlock()
+	t.mutex.Lock()
+	return t.count, t.changed != nil
+}
+
+func (ctl *Controller) SetAutoReload(autoReload bool) {
+	ctl.autoReload = autoReload
+}
+
+func (ctl *Controller) IsLineChanged(lineIndex int) bool {
+	return ctl.changes.isChanged(ctl.GetSourceLine(lineIndex))
+}
+
+// requestReload makes the reading goroutine read the file of the current document again.
+func (ctl *Controller) requestReload() {
+	if ctl.fileName == nil {
+		ctl.view.GetStatusBar().Message("The standard input cannot be reloaded")
+		return
+	}
+	select {
+	case ctl.reloadRequests <- struct{}{}:
+		ctl.view.GetStatusBar().Message("Reloading...")
+	default:
+	}
+}
+
+func (doc *document) isReloadRequested() bool {
+	select {
+	case <-doc.reloadRequests:
+		return true
+	default:
+		return false
+	}
+}
+
+// fileModified tells whether the file has been changed since it was opened.
+func fileModified(opened os.FileInfo, fileName string) bool {
+	if current, err := os.Stat(fileName); err == nil {
+		return current.Size() != opened.Size() || !current.ModTime().Equal(opened.ModTime()) ||
+			!os.SameFile(opened, current)
+	}
+	return false
+}
@@ -0,0 +1,202 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/bry00/m/buffers"
+	"github.com/bry00/m/view"
+)
+
+// maxListedResults is the number of lines listed in the search results panel, further lines found are counted only.
+const maxListedResults = 10000
+
+// resultEntry is the first occurrence found in a line, with byte offsets in the visible text of the line.
+type resultEntry struct {
+	line  int
+	start int
+	end   int
+}
+
+// searchResults are all lines with occurrences of the search string in the lines shown of a document.
+// Lines found past the ones listed are kept as line numbers only.
+type searchResults struct {
+	doc      *document
+	query    searchQuery
+	entries  []resultEntry
+	unlisted []int
+	complete bool
+	cancel   chan struct{}
+}
+
+// resultsOfSearch returns the results of the current search in the current document, nil if there are none.
+func (ctl *Controller) resultsOfSearch() *searchResults {
+	r := ctl.results
+	if r != nil && r.doc == ctl.document && r.query == ctl.currentQuery() {
+		return r
+	}
+	return nil
+}
+
+// listSearchResults shows the panel listing all lines with occurrences of the search string; lines are
+// searched in the background and added to the panel as they are found.
+func (ctl *Controller) listSearchResults() {
+	if len(ctl.searchString) == 0 {
+		ctl.view.GetStatusBar().Message("Search for something first")
+		return
+	}
+	if _, hex := ctl.getHexPattern(); hex {
+		ctl.view.GetStatusBar().Message("Hex patterns cannot be listed")
+		return
+	}
+	if ctl.resultsOfSearch() != nil {
+		ctl.view.ShowSearchResults()
+		return
+	}
+	m, err := newMatcher(ctl.currentQuery())
+	if err != nil {
+		ctl.view.GetStatusBar().Message("Wrong search string \"%s\": %s", ctl.searchString, err.Error())
+		return
+	}
+	ctl.dropSearchResults()
+	results := &searchResults{
+		doc:     ctl.document,
+		query:   ctl.currentQuery(),
+		entries: make([]resultEntry, 0),
+		cancel:  make(chan struct{}),
+	}
+	ctl.results = results
+	ctl.view.ClearSearchResults()
+	ctl.view.ShowSearchResults()
+	go ctl.collectSearchResults(results, ctl.shown(), ctl.headerTop(), m, ctl.searchTextExpander())
+}
+
+// collectSearchResults searches the lines of the store from the first one given, passing lines found to the UI thread.
+// The text searched is made by the function given, so the search does not depend on the controller.
+func (ctl *Controller) collectSearchResults(results *searchResults, store buffers.LineStore, first int, m *matcher,
+	expand func(line string) string) {
+	collected := 0
+	_, err := buffers.Search(store, &buffers.SearchRequest{
+		From: first,
+		Match: func(line string) [][]int {
+			return m.findAll(expand(line))
+		},
+		Cancel: results.cancel,
+		Collect: func(found []buffers.LineMatch) {
+			entries := make([]resultEntry, 0, len(found))
+			texts := make([]string, 0, len(found))
+			unlisted := make([]int, 0)
+			for _, f := range found {
+				if collected < maxListedResults {
+					entries = append(entries, resultEntry{line: f.Line, start: f.Found[0][0], end: f.Found[0][1]})
+					texts = append(texts, expand(f.Text))
+				} else {
+					unlisted = append(unlisted, f.Line)
+				}
+				collected++
+			}
+			ctl.view.QueueUpdateDraw(func() {
+				if ctl.results == results {
+					ctl.addSearchResults(entries, texts, unlisted)
+				}
+			})
+		},
+	})
+	ctl.view.QueueUpdateDraw(func() {
+		if ctl.results != results {
+			return
+		}
+		if err != nil {
+			hint := ""
+			if err == buffers.ErrFileChanged {
+				hint = ", press R to read it again"
+			}
+			ctl.view.GetStatusBar().Message("Search failed: %s%s", err.Error(), hint)
+			return
+		}
+		results.complete = true
+		ctl.view.AddSearchResults(nil, results.count(), true)
+		ctl.view.GetStatusBar().Message("Lines found: %d", results.count())
+	})
+}
+
+// addSearchResults adds entries found to the results and lists them, further lines found are only counted.
+func (ctl *Controller) addSearchResults(entries []resultEntry, texts []string, unlisted []int) {
+	listed := make([]view.SearchResult, 0, len(entries))
+	for i, e := range entries {
+		listed = append(listed, view.SearchResult{
+			LineNo: ctl.GetSourceLine(e.line) + 1,
+			Text:   texts[i],
+			Start:  e.start,
+			End:    e.end,
+		})
+	}
+	ctl.results.entries = append(ctl.results.entries, entries...)
+	ctl.results.unlisted = append(ctl.results.unlisted, unlisted...)
+	ctl.view.AddSearchResults(listed, ctl.results.count(), false)
+}
+
+// dropSearchResults forgets results listed, stopping the search for them. It tells whether the search was running.
+func (ctl *Controller) dropSearchResults() bool {
+	r := ctl.results
+	if r == nil {
+		return false
+	}
+	if !r.complete {
+		close(r.cancel)
+	}
+	ctl.results = nil
+	ctl.view.ClearSearchResults()
+	return !r.complete
+}
+
+// GotoSearchResult shows the line of the given entry of the search results panel.
+func (ctl *Controller) GotoSearchResult(index int) {
+	r := ctl.resultsOfSearch()
+	if r == nil || index < 0 || index >= len(r.entries) {
+		return
+	}
+	e := r.entries[index]
+	txt, err := ctl.shown().GetLine(e.line)
+	if err != nil {
+		ctl.view.GetStatusBar().Message("Cannot read line %d: %s", ctl.GetSourceLine(e.line)+1, err.Error())
+		return
+	}
+	ctl.recordJump()
+	ctl.searchLastRow = e.line
+	ctl.searchLastCol = e.end
+	ctl.showLine(e.line)
+	ctl.showSearchResult(e.line, e.start, e.end)
+	left, top, width, height := ctl.view.GetDisplayRect()
+	left, top, row := ctl.foundPosition(left, top, ctl.view.GetTopRow(), width, height,
+		e.line, e.start, e.end, ctl.searchTextExpander()(txt))
+	ctl.view.GetStatusBar().Message("%s", r.describeMatch(index))
+	ctl.displayAt(left, top, row)
+}
+
+// count returns the number of lines found so far.
+func (r *searchResults) count() int {
+	return len(r.entries) + len(r.unlisted)
+}
+
+// matchIndex returns the index of the line in the results, -1 when the line is not there.
+func (r *searchResults) matchIndex(line int) int {
+	i := sort.Search(len(r.entries), func(i int) bool {
+		return r.entries[i].line >= line
+	})
+	if i < len(r.entries) && r.entries[i].line == line {
+		return i
+	}
+	if k := sort.SearchInts(r.unlisted, line); k < len(r.unlisted) && r.unlisted[k] == line {
+		return len(r.entries) + k
+	}
+	return -1
+}
+
+// describeMatch returns "match k of N" for the index of the line in the results.
+func (r *searchResults) describeMatch(index int) string {
+	if r.complete {
+		return fmt.Sprintf("Match %d of %d", index+1, r.count())
+	}
+	return fmt.Sprintf("Match %d of %d so far", index+1, r.count())
+}
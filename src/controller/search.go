@@ -0,0 +1,206 @@
+package controller
+
+import (
+	"strings"
+	"time"
+
+	"github.com/bry00/m/buffers"
+	"github.com/bry00/m/utl"
+)
+
+// searchProgressDelay is the time of searching after which the progress is shown.
+const searchProgressDelay = 300 * time.Millisecond
+
+var errSearchCancelled = buffers.ErrSearchCancelled
+
+func (ctl *Controller) currentQuery() searchQuery {
+	return searchQuery{
+		text:       ctl.searchString,
+		regex:      ctl.searchRegex,
+		ignoreCase: ctl.searchIgnoreCase,
+		wholeWord:  ctl.searchWholeWord,
+		smartCase:  ctl.searchSmartCase,
+	}
+}
+
+// searchJob is a search running in the background, in the lines shown when it has been started. A nil job is never
+// cancelled and reports no progress, it searches for the current query in the lines shown.
+type searchJob struct {
+	query       searchQuery
+	hex         bool
+	data        buffers.LineStore
+	expand      func(line string) string
+	first       int
+	cancel      chan struct{}
+	started     time.Time
+	lastPercent int
+	progress    func(percent int)
+}
+
+// newSearchJob creates the job searching for the current query; the lines searched and the way their text is made
+// are those of the current document, so the job does not depend on the controller, when it is running.
+func (ctl *Controller) newSearchJob(progress func(percent int)) *searchJob {
+	return &searchJob{
+		query:       ctl.currentQuery(),
+		hex:         ctl.hexShown,
+		data:        ctl.shown(),
+		expand:      ctl.searchTextExpander(),
+		first:       ctl.headerTop(),
+		cancel:      make(chan struct{}),
+		started:     time.Now(),
+		lastPercent: -1,
+		progress:    progress,
+	}
+}
+
+// searchSource returns the query, the hex dump flag, the lines, the function making the text searched and the first
+// line searched of the job, or the current ones, when there is no job.
+func (ctl *Controller) searchSource(job *searchJob) (searchQuery, bool, buffers.LineStore, func(line string) string,
+	int) {
+	if job != nil {
+		return job.query, job.hex, job.data, job.expand, job.first
+	}
+	return ctl.currentQuery(), ctl.hexShown, ctl.shown(), ctl.searchTextExpander(), ctl.headerTop()
+}
+
+func (job *searchJob) cancelled() bool {
+	if job == nil {
+		return false
+	}
+	select {
+	case <-job.cancel:
+		return true
+	default:
+		return false
+	}
+}
+
+// report reports the progress of the search, when it has changed by one percent at least and the search
+// takes long enough to be worth it.
+func (job *searchJob) report(done int, total int) {
+	if job == nil || total <= 0 || time.Since(job.started) < searchProgressDelay {
+		return
+	}
+	if percent := done * 100 / total; percent != job.lastPercent {
+		job.lastPercent = percent
+		job.progress(percent)
+	}
+}
+
+// startSearch looks for the next (or previous) occurrence of the search string in the background, the result
+// is applied in the UI thread.
+func (ctl *Controller) startSearch(forward bool) {
+	if ctl.search != nil {
+		ctl.view.GetStatusBar().Message("Searching in progress, press Esc to cancel it")
+		return
+	}
+	doc := ctl.document
+	query := ctl.currentQuery()
+	job := ctl.newSearchJob(func(percent int) {
+		ctl.safeMessage(doc, "Searching \"%s\"... %d%% (press Esc to cancel)", query.text, percent)
+	})
+	ctl.search = job
+	startLine, startColumn, wrapAround := doc.searchLastRow, doc.searchLastCol, doc.searchWrapAround
+	go func() {
+		foundLine, foundStart, foundEnd, foundLineText, wrapped, err :=
+			ctl.findWrapping(job, forward, wrapAround, startLine, startColumn)
+		ctl.view.QueueUpdateDraw(func() {
+			if ctl.search == job {
+				ctl.search = nil
+			}
+			if ctl.isCurrent(doc) && err != errSearchCancelled {
+				ctl.showFound(forward, wrapped, foundLine, foundStart, foundEnd, foundLineText, err)
+			}
+		})
+	}()
+}
+
+// findWrapping looks for the next (or previous) occurrence of the search string. When there is none and the search
+// wraps around, it continues from the other end of the lines up to the start position; wrapped tells whether
+// the occurrence has been found that way.
+func (ctl *Controller) findWrapping(job *searchJob, forward bool, wrapAround bool, startLine int, startColumn int) (
+	line int, start int, end int, lineText string, wrapped bool, err error) {
+	if forward {
+		line, start, end, lineText, err = ctl.findNext(job, startLine, startColumn)
+	} else {
+		line, start, end, lineText, err = ctl.findPrevious(job, startLine, startColumn)
+	}
+	if err != nil || line >= 0 || !wrapAround {
+		return
+	}
+	if forward {
+		line, start, end, lineText, err = ctl.findNext(job, 0, 0)
+		wrapped = line >= 0 && line <= startLine
+	} else {
+		_, _, data, _, _ := ctl.searchSource(job)
+		line, start, end, lineText, err = ctl.findPrevious(job, data.Len(), -1)
+		wrapped = line >= 0 && line >= startLine
+	}
+	if !wrapped {
+		line, start, end, lineText = -1, -1, -1, ""
+	}
+	return
+}
+
+// cancelSearch stops the search running, if any, and drops the search results listed.
+func (ctl *Controller) cancelSearch() {
+	running := ctl.dropSearchResults()
+	ctl.endIncrementalJob()
+	if ctl.search != nil {
+		close(ctl.search.cancel)
+		ctl.search = nil
+		running = true
+	}
+	if running {
+		ctl.view.GetStatusBar().Message("Search cancelled")
+	}
+}
+
+// showFound shows the result of the search and moves the view to it.
+func (ctl *Controller) showFound(forward bool, wrapped bool, foundLine int, foundStart int, foundEnd int,
+	foundLineText string, err error) {
+	if err == buffers.ErrFileChanged {
+		ctl.view.GetStatusBar().Message("Search failed: %s, press R to read it again", err.Error())
+		return
+	} else if err != nil {
+		ctl.view.GetStatusBar().Message("Wrong search string \"%s\": %s", ctl.searchString, err.Error())
+		return
+	}
+	ctl.searchLastRow = foundLine
+	ctl.searchLastCol = foundEnd
+	ctl.showSearchResult(foundLine, foundStart, foundEnd)
+	if foundLine < 0 {
+		if forward {
+			ctl.view.GetStatusBar().Message("Cannot find: \"%s\"", ctl.searchString)
+			ctl.searchLastRow = 0
+			ctl.searchLastCol = 0
+		} else {
+			ctl.view.GetStatusBar().Message("Cannot find previous: \"%s\"", ctl.searchString)
+			ctl.searchLastRow = ctl.NoOfLines() - 1
+			ctl.searchLastCol = -1
+		}
+		return
+	}
+	ctl.recordJump()
+	left, top, width, height := ctl.view.GetDisplayRect()
+	left, top, row := ctl.foundPosition(left, top, ctl.view.GetTopRow(), width, height,
+		foundLine, foundStart, foundEnd, foundLineText)
+	format := "Found at: %d:%d \"%s\"%s"
+	if !forward {
+		format = "Previous at: %d:%d \"%s\"%s"
+	}
+	if wrapped && forward {
+		format = "Search wrapped to the beginning, found at: %d:%d \"%s\"%s"
+	} else if wrapped {
+		format = "Search wrapped to the end, previous at: %d:%d \"%s\"%s"
+	}
+	match := ""
+	if r := ctl.resultsOfSearch(); r != nil {
+		if i := r.matchIndex(foundLine); i >= 0 {
+			match = ", " + strings.ToLower(r.describeMatch(i))
+		}
+	}
+	ctl.view.GetStatusBar().Message(format,
+		ctl.GetSourceLine(foundLine)+1, utl.CountRunesAtIndex(foundLineText, foundStart)+1, ctl.searchString, match)
+	ctl.displayAt(left, top, row)
+}
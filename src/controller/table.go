@@ -0,0 +1,443 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bry00/m/markup"
+	"github.com/bry00/m/utl"
+	"github.com/bry00/m/view"
+	"github.com/gdamore/tcell"
+)
+
+// tableSampleBlocks is the number of blocks of lines, spread over the data, the widths of columns are taken from.
+const tableSampleBlocks = 8
+
+// tableSeparator separates columns of a table row.
+const tableSeparator = " │ "
+
+// tableEllipsis ends a field cut to the width of its column.
+const tableEllipsis = '…'
+
+// tableDelimiters are delimiters recognized, when the delimiter is detected.
+var tableDelimiters = []rune{',', '\t', ';', '|'}
+
+// tableLayout describes how lines are shown as rows of a table: lines are split into fields, which are padded
+// to the widths of their columns. A layout is never changed, a new one is made instead, so a search running
+// in the background can use it safely.
+type tableLayout struct {
+	delimiter rune     // 0 splits fields at runs of blanks
+	quote     rune     // 0 when fields are not quoted
+	widths    []int    // widths of all columns, in characters
+	names     []string // names of columns from the header row, if any
+	columns   []int    // indexes of columns shown, in the order shown
+	header    bool     // whether the first line is the header row
+	style     markup.Style
+}
+
+// splitFields splits the line into fields separated by the delimiter; a field starting with the quote may contain
+// delimiters, a doubled quote stands for the quote itself.
+func splitFields(line string, delimiter rune, quote rune) []string {
+	var fields []string
+	var field strings.Builder
+	quoted, inField := false, false
+	for i := 0; i < len(line); {
+		r, size := utf8.DecodeRuneInString(line[i:])
+		i += size
+		switch {
+		case quoted && r == quote:
+			if next, nextSize := utf8.DecodeRuneInString(line[i:]); next == quote && nextSize > 0 {
+				field.WriteRune(quote)
+				i += nextSize
+			} else {
+				quoted = false
+			}
+		case quoted:
+			field.WriteRune(r)
+		case quote != 0 && r == quote && field.Len() == 0:
+			quoted, inField = true, true
+		case delimiter == 0 && (r == ' ' || r == '\t'):
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		case r == delimiter:
+			fields = append(fields, field.String())
+			field.Reset()
+			inField = true
+		default:
+			field.WriteRune(r)
+			inField = true
+		}
+	}
+	if inField || delimiter != 0 && len(fields) > 0 {
+		fields = append(fields, field.String())
+	}
+	return fields
+}
+
+// parseDelimiter returns the delimiter configured: a single character, "tab", "whitespace" (0) or "auto" (-1).
+func parseDelimiter(delimiter string) (rune, error) {
+	switch strings.ToLower(delimiter) {
+	case "", "auto":
+		return -1, nil
+	case "tab", "\\t":
+		return '\t', nil
+	case "whitespace", "space", "blank":
+		return 0, nil
+	}
+	if utf8.RuneCountInString(delimiter) != 1 {
+		return -1, fmt.Errorf("wrong table delimiter: \"%s\"", delimiter)
+	}
+	r, _ := utf8.DecodeRuneInString(delimiter)
+	return r, nil
+}
+
+// detectDelimiter returns the delimiter splitting most of the lines into the same number of fields, the more
+// fields, the better; lines split at runs of blanks, when there is none.
+func detectDelimiter(lines []string, quote rune) rune {
+	result, best := rune(0), 1
+	for _, delimiter := range tableDelimiters {
+		counts := make(map[int]int)
+		for _, line := range lines {
+			counts[len(splitFields(line, delimiter, quote))]++
+		}
+		for fields, count := range counts {
+			if fields > best && count*5 >= len(lines)*4 {
+				result, best = delimiter, fields
+			}
+		}
+	}
+	return result
+}
+
+// newTableLayout makes the layout of the table with widths of columns taken from the sample lines; columns are
+// not wider than maxWidth. The first line of the sample is the header row, if header is set.
+func newTableLayout(sample []string, delimiter rune, quote rune, maxWidth int, header bool,
+	style markup.Style) *tableLayout {
+	if delimiter < 0 {
+		delimiter = detectDelimiter(sample, quote)
+	}
+	result := &tableLayout{
+		delimiter: delimiter,
+		quote:     quote,
+		header:    header,
+		style:     style,
+	}
+	for i, line := range sample {
+		fields := splitFields(line, delimiter, quote)
+		for c, field := range fields {
+			if c == len(result.widths) {
+				result.widths = append(result.widths, 1)
+			}
+			width := utf8.RuneCountInString(field)
+			if maxWidth > 0 && width > maxWidth {
+				width = maxWidth
+			}
+			if width > result.widths[c] {
+				result.widths[c] = width
+			}
+		}
+		if i == 0 && header {
+			result.names = fields
+		}
+	}
+	result.columns = make([]int, len(result.widths))
+	for i := range result.columns {
+		result.columns[i] = i
+	}
+	return result
+}
+
+// withColumns returns a copy of the layout, which shows the columns given in their order.
+func (l *tableLayout) withColumns(columns []int) *tableLayout {
+	result := *l
+	result.columns = make([]int, 0, len(columns))
+	for _, c := range columns {
+		if c >= 0 && c < len(l.widths) {
+			result.columns = append(result.columns, c)
+		}
+	}
+	return &result
+}
+
+// allShown tells whether all columns are shown in their original order.
+func (l *tableLayout) allShown() bool {
+	if len(l.columns) != len(l.widths) {
+		return false
+	}
+	for i, c := range l.columns {
+		if i != c {
+			return false
+		}
+	}
+	return true
+}
+
+// formatRow returns the text of the line laid out as a row of the table, with separators of columns styled.
+// Fields not fitting their columns are cut; fields beyond the columns known are appended, when all columns
+// are shown in their order.
+func (l *tableLayout) formatRow(line string) (string, []markup.Span) {
+	fields := splitFields(line, l.delimiter, l.quote)
+	var b strings.Builder
+	spans := make([]markup.Span, 0, len(l.columns))
+	separator := func() {
+		spans = append(spans, markup.Span{Start: b.Len(), End: b.Len() + len(tableSeparator), Style: l.style})
+		b.WriteString(tableSeparator)
+	}
+	for i, c := range l.columns {
+		if i > 0 {
+			separator()
+		}
+		field := ""
+		if c < len(fields) {
+			field = fields[c]
+		}
+		writeField(&b, field, l.widths[c])
+	}
+	if l.allShown() {
+		for c := len(l.widths); c < len(fields); c++ {
+			separator()
+			b.WriteString(cleanField(fields[c]))
+		}
+	}
+	return strings.TrimRightFunc(b.String(), unicode.IsSpace), spans
+}
+
+// format returns the text of the line laid out as a row of the table.
+func (l *tableLayout) format(line string) string {
+	text, _ := l.formatRow(line)
+	return text
+}
+
+// writeField writes the field padded (or cut) to the width given.
+func writeField(b *strings.Builder, field string, width int) {
+	runes := []rune(cleanField(field))
+	if len(runes) > width {
+		runes = append(runes[:width-1], tableEllipsis)
+	}
+	b.WriteString(string(runes))
+	b.WriteString(strings.Repeat(" ", width-len(runes)))
+}
+
+// cleanField replaces control characters (like tabs) of the field with spaces, so they do not break the layout.
+func cleanField(field string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, field)
+}
+
+// columnStarts returns offsets (in characters) of columns shown in a row.
+func (l *tableLayout) columnStarts() []int {
+	result := make([]int, len(l.columns))
+	offset := 0
+	for i, c := range l.columns {
+		result[i] = offset
+		offset += l.widths[c] + utf8.RuneCountInString(tableSeparator)
+	}
+	return result
+}
+
+// width returns the width of a row of the table, in characters.
+func (l *tableLayout) width() int {
+	result := 0
+	for i, c := range l.columns {
+		if i > 0 {
+			result += utf8.RuneCountInString(tableSeparator)
+		}
+		result += l.widths[c]
+	}
+	return result
+}
+
+// columnName returns the name of the column from the header row, or its number.
+func (l *tableLayout) columnName(c int) string {
+	if c < len(l.names) && len(strings.TrimSpace(l.names[c])) > 0 {
+		return strings.TrimSpace(cleanField(l.names[c]))
+	}
+	return fmt.Sprintf("Column %d", c+1)
+}
+
+// describeDelimiter returns the name of the delimiter to show.
+func describeDelimiter(delimiter rune) string {
+	switch delimiter {
+	case 0:
+		return "blanks"
+	case '\t':
+		return "tab"
+	}
+	return fmt.Sprintf("\"%c\"", delimiter)
+}
+
+// tableSample returns lines, which widths of columns are taken from: the first lines of the data and blocks of
+// lines spread evenly over the rest of it.
+func (ctl *Controller) tableSample() []string {
+	store := ctl.data
+	total := store.Len()
+	size := ctl.conf.Table.SampleLines
+	if size < tableSampleBlocks {
+		size = tableSampleBlocks
+	}
+	starts := []int{0}
+	block := total
+	if total > size {
+		block = size / tableSampleBlocks
+		for i := 1; i < tableSampleBlocks; i++ {
+			starts = append(starts, i*(total-block)/(tableSampleBlocks-1))
+		}
+	}
+	render, overstrike := ctl.ansiMode == markup.AnsiRender, ctl.overstrike
+	result := make([]string, 0, utl.MinInt(size, total))
+	for _, start := range starts {
+		iter := store.Iterator()
+		for ok := iter.IndexSet(start, false); ok && iter.IndexOK() && iter.Index() < start+block; iter.IndexIncrement() {
+			if line, err := iter.GetLine(); err == nil {
+				result = append(result, markup.Strip(line, render, overstrike))
+			}
+		}
+	}
+	return result
+}
+
+// toggleTableMode shows lines as rows of a table with aligned columns, or as they are.
+func (ctl *Controller) toggleTableMode() {
+	if ctl.table != nil {
+		ctl.table = nil
+		ctl.resetTableView()
+		ctl.view.GetStatusBar().Message("Table mode off")
+		return
+	}
+	if ctl.hexShown {
+		ctl.view.GetStatusBar().Message("The table mode is not available for a hex dump")
+		return
+	}
+	delimiter, err := parseDelimiter(ctl.conf.Table.Delimiter)
+	if err != nil {
+		ctl.view.GetStatusBar().Message("%s", err.Error())
+		return
+	}
+	quote, _ := utf8.DecodeRuneInString(ctl.conf.Table.Quote)
+	if quote == utf8.RuneError {
+		quote = 0
+	}
+	sample := ctl.tableSample()
+	if len(sample) == 0 {
+		ctl.view.GetStatusBar().Message("There are no lines to show as a table")
+		return
+	}
+	ctl.table = newTableLayout(sample, delimiter, quote, ctl.conf.Table.MaxColumnWidth, ctl.conf.Table.Header,
+		markup.Style{
+			Foreground: tcell.GetColor(ctl.conf.Visual.Table.SeparatorColor),
+			Background: tcell.ColorDefault,
+			Attributes: tcell.AttrNone,
+		})
+	ctl.resetTableView()
+	ctl.view.GetStatusBar().Message("Table mode: %d columns separated by %s",
+		len(ctl.table.widths), describeDelimiter(ctl.table.delimiter))
+}
+
+// resetTableView shows the beginning of lines, after they are laid out again; occurrences found before are
+// no longer where they were.
+func (ctl *Controller) resetTableView() {
+	ctl.cancelSearch()
+	ctl.showSearchResult(-1, -1, -1)
+	ctl.searchLastCol = -1
+	_, top, _, _ := ctl.view.GetDisplayRect()
+	ctl.displayAt(0, top, 0)
+}
+
+// lineLength returns the length of the longest line, as shown.
+func (ctl *Controller) lineLength() int {
+	if ctl.table != nil {
+		return ctl.table.width()
+	}
+	return ctl.maxLineLength
+}
+
+// moveColumn returns the left offset of the next (or previous) column of the table.
+func (ctl *Controller) moveColumn(left int, next bool) int {
+	if ctl.table == nil {
+		ctl.view.GetStatusBar().Message("Moving by columns works in the table mode or with a record layout only")
+		return left
+	}
+	starts := ctl.table.columnStarts()
+	result := left
+	if next {
+		for _, start := range starts {
+			if start > left {
+				return start
+			}
+		}
+	} else {
+		for _, start := range starts {
+			if start < left {
+				result = start
+			}
+		}
+	}
+	return result
+}
+
+// GetTableHeader returns the header row of the table, when lines are shown as a table with the header row; the
+// header row is one of the frozen lines, when there are any.
+func (ctl *Controller) GetTableHeader() (string, []markup.Span) {
+	if ctl.table == nil || !ctl.table.header || ctl.frozenLines > 0 || ctl.data.Len() == 0 {
+		return "", nil
+	}
+	line, err := ctl.data.GetLine(0)
+	if err != nil {
+		return "", nil
+	}
+	text, separators := ctl.table.formatRow(ctl.visibleText(line))
+	header := markup.Style{
+		Foreground: tcell.GetColor(ctl.conf.Visual.Table.HeaderColor),
+		Background: tcell.ColorDefault,
+		Attributes: tcell.AttrBold,
+	}
+	spans := make([]markup.Span, 0, len(separators)*2+1)
+	start := 0
+	for _, separator := range append(separators, markup.Span{Start: len(text), End: len(text)}) {
+		if separator.Start > start {
+			spans = append(spans, markup.Span{Start: start, End: separator.Start, Style: header})
+		}
+		if separator.End > separator.Start {
+			spans = append(spans, separator)
+		}
+		start = separator.End
+	}
+	return text, spans
+}
+
+// GetTableColumns returns columns of the table: the ones shown in their order, then the hidden ones.
+func (ctl *Controller) GetTableColumns() []view.TableColumn {
+	if ctl.table == nil {
+		return nil
+	}
+	result := make([]view.TableColumn, 0, len(ctl.table.widths))
+	shown := make([]bool, len(ctl.table.widths))
+	for _, c := range ctl.table.columns {
+		shown[c] = true
+		result = append(result, view.TableColumn{Index: c, Name: ctl.table.columnName(c), Shown: true})
+	}
+	for c := range ctl.table.widths {
+		if !shown[c] {
+			result = append(result, view.TableColumn{Index: c, Name: ctl.table.columnName(c), Shown: false})
+		}
+	}
+	return result
+}
+
+// SetTableColumns shows the columns of the indexes given, in their order.
+func (ctl *Controller) SetTableColumns(columns []int) {
+	if ctl.table == nil {
+		return
+	}
+	ctl.table = ctl.table.withColumns(columns)
+	ctl.resetTableView()
+}
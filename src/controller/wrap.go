@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"strings"
+
+	"github.com/bry00/m/utl"
+	"github.com/bry00/m/view"
+)
+
+// SetWrapped makes long lines be wrapped (or scrolled horizontally).
+func (ctl *Controller) SetWrapped(wrap bool) {
+	ctl.view.SetWrapped(wrap)
+}
+
+// lineRows returns the number of rows taken by the line as it is shown (with tabs expanded, or as the row of the
+// table in the table mode), when wrapped at the given width.
+func (ctl *Controller) lineRows(lineIndex int, width int) int {
+	line, err := ctl.shown().GetLine(lineIndex)
+	if err != nil {
+		return 1
+	}
+	text, _ := ctl.ParseLine(line)
+	text = strings.Replace(text, "\t", strings.Repeat(" ", ctl.conf.View.SpacesPerTab), -1)
+	return len(view.WrapRows([]rune(text), width))
+}
+
+// moveRows returns the position (the line and its row) the given number of rows below (or above, for a negative
+// delta) the one given. The position returned is not before the beginning nor after the end of the data.
+func (ctl *Controller) moveRows(line int, row int, delta int, width int) (int, int) {
+	for delta > 0 && line < ctl.shown().Len() {
+		rows := ctl.lineRows(line, width)
+		if row+delta < rows {
+			return line, row + delta
+		}
+		delta -= rows - row
+		line++
+		row = 0
+	}
+	for delta < 0 {
+		if row+delta >= 0 {
+			return line, row + delta
+		}
+		if line <= 0 {
+			return 0, 0
+		}
+		delta += row + 1
+		line--
+		row = ctl.lineRows(line, width) - 1
+	}
+	return line, row
+}
+
+// positionAbove returns the position of the top of the view, where the given line is shown the given number
+// of rows below the top.
+func (ctl *Controller) positionAbove(lineIndex int, rows int, width int) (int, int) {
+	if ctl.view.IsWrapped() {
+		return ctl.moveRows(lineIndex, 0, -rows, width)
+	}
+	return lineIndex - rows, 0
+}
+
+// scrollRows returns the position of the top of the view scrolled by the given number of rows.
+func (ctl *Controller) scrollRows(top int, row int, delta int, width int) (int, int) {
+	if ctl.view.IsWrapped() {
+		return ctl.moveRows(top, row, delta, width)
+	}
+	return top + delta, 0
+}
+
+// foundPosition returns the position of the view, where the found string is visible.
+func (ctl *Controller) foundPosition(left int, top int, row int, width int, height int,
+	foundLine int, foundStart int, foundEnd int, foundLineText string) (int, int, int) {
+	if !ctl.view.IsWrapped() {
+		left, top = setFoundStringPosition(left, top, width, height, foundLine, foundStart, foundEnd, foundLineText)
+		return left, top, 0
+	}
+	if foundLine < 0 || foundStart < 0 {
+		return left, top, row
+	}
+	start := utl.CountRunesAtIndex(foundLineText, foundStart)
+	foundRow := 0
+	for i, rowStart := range view.WrapRows([]rune(foundLineText), width) {
+		if rowStart <= start {
+			foundRow = i
+		}
+	}
+	bottomLine, bottomRow := ctl.moveRows(top, row, height-1, width)
+	if comparePositions(foundLine, foundRow, top, row) < 0 || comparePositions(foundLine, foundRow, bottomLine, bottomRow) > 0 {
+		top, row = ctl.moveRows(foundLine, foundRow, -height/3, width)
+	}
+	return 0, top, row
+}
+
+// comparePositions compares positions given as lines and their rows.
+func comparePositions(line1 int, row1 int, line2 int, row2 int) int {
+	switch {
+	case line1 < line2 || line1 == line2 && row1 < row2:
+		return -1
+	case line1 == line2 && row1 == row2:
+		return 0
+	}
+	return 1
+}
+
+// displayWrapped shows the wrapped lines from the given position, but not further than needed to fill the view
+// with the last rows of the data.
+func (ctl *Controller) displayWrapped(top int, row int, width int, height int) {
+	if bottomLine, bottomRow := ctl.moveRows(ctl.shown().Len(), 0, -height, width); comparePositions(top, row, bottomLine, bottomRow) > 0 {
+		top, row = bottomLine, bottomRow
+	}
+	if top < 0 {
+		top, row = 0, 0
+	}
+	if frozenTop := ctl.frozenTop(); top < frozenTop && frozenTop < ctl.shown().Len() {
+		top, row = frozenTop, 0
+	}
+	ctl.view.DisplayAtRow(top, row)
+}
@@ -4,6 +4,8 @@ go 1.15
 
 require (
 	github.com/gdamore/tcell v1.4.0
+	github.com/mattn/go-runewidth v0.0.9
 	github.com/rivo/tview v0.0.0-20200818120338-53d50e499bf9
+	golang.org/x/text v0.3.2
 	gopkg.in/yaml.v2 v2.3.0
 )
@@ -6,6 +6,7 @@ import (
 	"github.com/bry00/m/buffers"
 	"github.com/bry00/m/config"
 	"github.com/bry00/m/controller"
+	"github.com/bry00/m/markup"
 	"github.com/bry00/m/view/tv"
 	"log"
 	"os"
@@ -19,9 +20,16 @@ const DefaultBlockSizeMB = 4
 const DefaultTotalSizeMB = 64
 
 var (
-	fileName         string
+	fileNames        []string
 	title            string
 	removeBackspaces bool
+	follow           bool
+	autoReload       bool
+	encoding         string
+	hexMode          bool
+	wrap             bool
+	ansiMode         string
+	layout           string
 	blockSizeLimitMB int
 	totalSizeLimitMB int
 )
@@ -30,7 +38,7 @@ func init() {
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Program %s is designated to view and browse flat, text files.\n", prog)
 		fmt.Fprintf(os.Stderr, "Usage:\n")
-		fmt.Fprintf(os.Stderr, "\t%s <options> [file]\n", prog)
+		fmt.Fprintf(os.Stderr, "\t%s <options> [file...]\n", prog)
 		fmt.Fprintf(os.Stderr, "where <options> are:\n")
 
 		fmt.Fprintf(os.Stderr, "\t-h\thelp, shows this text\n")
@@ -47,6 +55,13 @@ func init() {
 
 	flag.StringVar(&title, "t", "", "title to show")
 	flag.BoolVar(&removeBackspaces, "b", false, "remove backspaces")
+	flag.BoolVar(&follow, "f", false, "follow the file as it grows (press F to toggle)")
+	flag.BoolVar(&autoReload, "reload", false, "reload the file automatically when it changes (press R to reload)")
+	flag.StringVar(&encoding, "encoding", "", "input encoding, e.g. utf-16le, iso-8859-2, windows-1250 or auto")
+	flag.StringVar(&ansiMode, "ansi", "", "ANSI color escape sequences: render, strip or raw")
+	flag.BoolVar(&hexMode, "x", false, "show the input as a hex dump (press x to toggle)")
+	flag.BoolVar(&wrap, "w", false, "wrap long lines (press w to toggle)")
+	flag.StringVar(&layout, "layout", "", "record layout file of fixed-width lines, shown on the ruler (press V to see fields)")
 	flag.IntVar(&blockSizeLimitMB, "block", DefaultBlockSizeMB, "single data block size limit (MB)")
 	flag.IntVar(&totalSizeLimitMB, "total", DefaultTotalSizeMB, "total data size limit (MB)")
 
@@ -57,7 +72,7 @@ func main() {
 	setupLogger()
 
 	if len(flag.Args()) > 0 {
-		fileName = composeFileName(flag.Args())
+		fileNames = composeFileNames(flag.Args(), fileExists)
 	}
 
 	conf := config.GetConfig(prog)
@@ -65,9 +80,38 @@ func main() {
 	checkDefaultValue(&blockSizeLimitMB, conf.DataBuffer.BlockSizeLimitMB, buffers.DefaultBlockSizeLimit)
 	checkDefaultValue(&totalSizeLimitMB, conf.DataBuffer.TotalSizeLimitMB, buffers.DefaultTotalSizeLimit)
 
-	ctl := controller.NewController(fileName, title,
+	ctl := controller.NewController(fileNames, title,
 		buffers.NewBufferedDataMB(blockSizeLimitMB, totalSizeLimitMB),
 		tv.NewView(), conf, removeBackspaces)
+	ctl.SetFollowing(follow)
+	if autoReload {
+		ctl.SetAutoReload(true)
+	}
+	if hexMode {
+		ctl.SetHexMode(true)
+	}
+	if wrap {
+		ctl.SetWrapped(true)
+	}
+	if len(ansiMode) > 0 {
+		if mode, err := markup.ParseAnsiMode(ansiMode); err != nil {
+			log.Fatal(err)
+		} else {
+			ctl.SetAnsiMode(mode)
+		}
+	}
+	if len(encoding) > 0 {
+		if err := ctl.SetEncoding(encoding); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if len(layout) > 0 {
+		if err := ctl.SetLayout(layout); err != nil {
+			log.Fatal(err)
+		}
+	} else if err := ctl.SelectLayouts(); err != nil {
+		log.Fatal(err)
+	}
 	defer ctl.OnExit()
 	ctl.Run()
 }
@@ -86,8 +130,24 @@ func getProg(args []string) string {
 	}
 }
 
-func composeFileName(args []string) string {
-	return strings.Join(args, " ")
+// composeFileNames treats each argument as a separate file, unless just the arguments joined with spaces
+// name an existing file (i.e. a file name containing spaces has not been quoted).
+func composeFileNames(args []string, exists func(string) bool) []string {
+	allExist := true
+	for _, arg := range args {
+		allExist = allExist && exists(arg)
+	}
+	if !allExist && len(args) > 1 {
+		if joined := strings.Join(args, " "); exists(joined) {
+			return []string{joined}
+		}
+	}
+	return args
+}
+
+func fileExists(fileName string) bool {
+	info, err := os.Stat(fileName)
+	return err == nil && !info.IsDir()
 }
 
 func checkDefaultValue(value *int, config int, defaultValue int) {
@@ -28,21 +28,35 @@ func TestGetProg(t *testing.T) {
 	}
 }
 
-func TestComposeFilename(t *testing.T) {
+func TestComposeFilenames(t *testing.T) {
+	existing := map[string]bool{
+		"m":     true,
+		"m.exe": true,
+		"/usr/local/data/very important file.txt": true,
+		"/usr/local/data/very-important-file.txt": true,
+		"a.log": true,
+		"b.log": true,
+	}
+	exists := func(fileName string) bool {
+		return existing[fileName]
+	}
 	values := []struct {
-		Expected string
+		Expected []string
 		Args     []string
 	}{
-		{"m", []string{"m"}},
-		{"m.exe", []string{"m.exe"}},
-		{"the file", []string{"the", "file"}},
-		{"/usr/local/data/very important file.txt", []string{"/usr/local/data/very", "important", "file.txt"}},
-		{"/usr/local/data/very-important-file.txt", []string{"/usr/local/data/very-important-file.txt"}},
+		{[]string{"m"}, []string{"m"}},
+		{[]string{"m.exe"}, []string{"m.exe"}},
+		{[]string{"the", "file"}, []string{"the", "file"}},
+		{[]string{"/usr/local/data/very important file.txt"}, []string{"/usr/local/data/very", "important", "file.txt"}},
+		{[]string{"/usr/local/data/very-important-file.txt"}, []string{"/usr/local/data/very-important-file.txt"}},
+		{[]string{"a.log", "b.log"}, []string{"a.log", "b.log"}},
+		{[]string{"a.log", "c.log"}, []string{"a.log", "c.log"}},
 	}
 	for _, v := range values {
-		got := composeFileName(v.Args)
-		if got != v.Expected {
-			t.Errorf("composeFileName(\"%s\") = \"%s\"; want \"%s\"", strings.Join(v.Args, "\", \""), got, v.Expected)
+		got := composeFileNames(v.Args, exists)
+		if strings.Join(got, "\", \"") != strings.Join(v.Expected, "\", \"") {
+			t.Errorf("composeFileNames(\"%s\") = \"%s\"; want \"%s\"", strings.Join(v.Args, "\", \""),
+				strings.Join(got, "\", \""), strings.Join(v.Expected, "\", \""))
 		}
 	}
 }
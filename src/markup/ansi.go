@@ -0,0 +1,165 @@
+package markup
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gdamore/tcell"
+)
+
+// AnsiMode tells what to do with ANSI escape sequences found in the text.
+type AnsiMode int
+
+const (
+	AnsiRender AnsiMode = iota // show colors and attributes of SGR sequences
+	AnsiStrip                  // remove escape sequences
+	AnsiRaw                    // show escape sequences as they are
+)
+
+var ansiModeNames = []string{
+	"render",
+	"strip",
+	"raw",
+}
+
+func (mode AnsiMode) String() string {
+	if int(mode) < len(ansiModeNames) {
+		return ansiModeNames[mode]
+	}
+	return "unknown"
+}
+
+func ParseAnsiMode(name string) (AnsiMode, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for i, modeName := range ansiModeNames {
+		if name == modeName {
+			return AnsiMode(i), nil
+		}
+	}
+	return AnsiRender, errors.New(fmt.Sprintf("unknown ANSI mode \"%s\", use one of: %s",
+		name, strings.Join(ansiModeNames, ", ")))
+}
+
+const esc = '\x1b'
+
+// StripAnsi returns the line without escape sequences.
+func StripAnsi(line string) string {
+	text, _ := Parse(line, true, false)
+	return text
+}
+
+// escapeSequence returns the length of the escape sequence at the beginning of the text, and for control
+// sequences (CSI) also their parameters and final byte.
+func escapeSequence(text string) (length int, params string, final byte) {
+	if len(text) < 2 {
+		return len(text), "", 0
+	}
+	switch text[1] {
+	case '[': // CSI: parameters, intermediate bytes and the final byte
+		i := 2
+		for i < len(text) && text[i] >= 0x30 && text[i] <= 0x3f {
+			i++
+		}
+		paramsEnd := i
+		for i < len(text) && text[i] >= 0x20 && text[i] <= 0x2f {
+			i++
+		}
+		if i < len(text) && text[i] >= 0x40 && text[i] <= 0x7e {
+			return i + 1, text[2:paramsEnd], text[i]
+		}
+		return i, "", 0
+	case ']', 'P', '_', '^': // OSC and other strings terminated by BEL or ST
+		for i := 2; i < len(text); i++ {
+			if text[i] == '\a' {
+				return i + 1, "", 0
+			}
+			if text[i] == esc && i+1 < len(text) && text[i+1] == '\\' {
+				return i + 2, "", 0
+			}
+		}
+		return len(text), "", 0
+	}
+	i := 1
+	for i < len(text) && text[i] >= 0x20 && text[i] <= 0x2f {
+		i++
+	}
+	if i < len(text) && text[i] >= 0x30 && text[i] <= 0x7e {
+		i++
+	}
+	return i, "", 0
+}
+
+func applySGR(style Style, params string) Style {
+	codes := strings.FieldsFunc(params, func(r rune) bool { return r == ';' || r == ':' })
+	if len(codes) == 0 {
+		return DefaultStyle
+	}
+	code := func(i int) int {
+		if i < len(codes) {
+			if n, err := strconv.Atoi(codes[i]); err == nil {
+				return n
+			}
+		}
+		return -1
+	}
+	for i := 0; i < len(codes); i++ {
+		switch n := code(i); {
+		case n == 0:
+			style = DefaultStyle
+		case n == 1:
+			style.Attributes |= tcell.AttrBold
+		case n == 2:
+			style.Attributes |= tcell.AttrDim
+		case n == 3:
+			style.Attributes |= tcell.AttrItalic
+		case n == 4:
+			style.Attributes |= tcell.AttrUnderline
+		case n == 5 || n == 6:
+			style.Attributes |= tcell.AttrBlink
+		case n == 7:
+			style.Attributes |= tcell.AttrReverse
+		case n == 22:
+			style.Attributes &^= tcell.AttrBold | tcell.AttrDim
+		case n == 23:
+			style.Attributes &^= tcell.AttrItalic
+		case n == 24:
+			style.Attributes &^= tcell.AttrUnderline
+		case n == 25:
+			style.Attributes &^= tcell.AttrBlink
+		case n == 27:
+			style.Attributes &^= tcell.AttrReverse
+		case n >= 30 && n <= 37:
+			style.Foreground = tcell.Color(n - 30)
+		case n >= 90 && n <= 97:
+			style.Foreground = tcell.Color(n - 90 + 8)
+		case n == 39:
+			style.Foreground = tcell.ColorDefault
+		case n >= 40 && n <= 47:
+			style.Background = tcell.Color(n - 40)
+		case n >= 100 && n <= 107:
+			style.Background = tcell.Color(n - 100 + 8)
+		case n == 49:
+			style.Background = tcell.ColorDefault
+		case n == 38 || n == 48:
+			var color tcell.Color
+			switch code(i + 1) {
+			case 5:
+				color = tcell.Color(code(i+2) & 0xff)
+				i += 2
+			case 2:
+				color = tcell.NewRGBColor(int32(code(i+2)&0xff), int32(code(i+3)&0xff), int32(code(i+4)&0xff))
+				i += 4
+			default:
+				continue
+			}
+			if n == 38 {
+				style.Foreground = color
+			} else {
+				style.Background = color
+			}
+		}
+	}
+	return style
+}
@@ -0,0 +1,153 @@
+// Package markup turns in-line formatting of text lines (ANSI escape sequences and overstrike) into styles.
+package markup
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell"
+)
+
+// Style of a part of a line; tcell.ColorDefault stands for the color of the viewer, not of the terminal.
+type Style struct {
+	Foreground tcell.Color
+	Background tcell.Color
+	Attributes tcell.AttrMask
+}
+
+var DefaultStyle = Style{
+	Foreground: tcell.ColorDefault,
+	Background: tcell.ColorDefault,
+	Attributes: tcell.AttrNone,
+}
+
+// Span is a part of the visible text of a line, Start and End are its byte offsets.
+type Span struct {
+	Start int
+	End   int
+	Style Style
+}
+
+// Apply applies the style to the given one, colors are replaced unless they are defaults.
+func (s Style) Apply(style tcell.Style) tcell.Style {
+	if s.Foreground != tcell.ColorDefault {
+		style = style.Foreground(s.Foreground)
+	}
+	if s.Background != tcell.ColorDefault {
+		style = style.Background(s.Background)
+	}
+	attrs := s.Attributes
+	return style.Bold(attrs&tcell.AttrBold != 0).
+		Dim(attrs&tcell.AttrDim != 0).
+		Italic(attrs&tcell.AttrItalic != 0).
+		Underline(attrs&tcell.AttrUnderline != 0).
+		Blink(attrs&tcell.AttrBlink != 0).
+		Reverse(attrs&tcell.AttrReverse != 0)
+}
+
+// StyleAt returns the style of the text at the given byte offset; spans are sorted by their offsets
+// and searched from the index given, which is updated for the next call.
+func StyleAt(spans []Span, offset int, index *int) Style {
+	for *index < len(spans) && spans[*index].End <= offset {
+		*index++
+	}
+	if *index < len(spans) && spans[*index].Start <= offset {
+		return spans[*index].Style
+	}
+	return DefaultStyle
+}
+
+// Overlay lays the style over the given one: colors are replaced unless they are defaults, attributes are added.
+func (s Style) Overlay(style tcell.Style) tcell.Style {
+	_, _, attrs := style.Decompose()
+	s.Attributes |= attrs
+	return s.Apply(style)
+}
+
+// HighlightAt returns the style of the last of the spans, which may overlap, containing the given byte offset.
+func HighlightAt(spans []Span, offset int) (Style, bool) {
+	for i := len(spans) - 1; i >= 0; i-- {
+		if spans[i].Start <= offset && offset < spans[i].End {
+			return spans[i].Style, true
+		}
+	}
+	return DefaultStyle, false
+}
+
+// Strip returns the visible text of the line, see Parse.
+func Strip(line string, ansi bool, overstrike bool) string {
+	text, _ := Parse(line, ansi, overstrike)
+	return text
+}
+
+// Parse returns the visible text of the line and the spans of its styled parts, interpreting ANSI escape
+// sequences and/or overstrike (backspaces) as requested. Spans of the default style are omitted.
+func Parse(line string, ansi bool, overstrike bool) (string, []Span) {
+	ansi = ansi && strings.IndexByte(line, esc) >= 0
+	overstrike = overstrike && strings.IndexByte(line, '\b') >= 0
+	if !ansi && !overstrike {
+		return line, nil
+	}
+	text := make([]byte, 0, len(line))
+	styles := make([]Style, 0, len(line)) // of each byte of the text
+	style := DefaultStyle
+	write := func(r rune, style Style) {
+		n := len(text)
+		text = append(text, string(r)...)
+		for ; n < len(text); n++ {
+			styles = append(styles, style)
+		}
+	}
+	for i := 0; i < len(line); {
+		switch r, size := utf8.DecodeRuneInString(line[i:]); {
+		case ansi && r == esc:
+			length, params, final := escapeSequence(line[i:])
+			if final == 'm' {
+				style = applySGR(style, params)
+			}
+			i += length
+		case overstrike && r == '\b':
+			i += size
+			previous, previousSize := utf8.DecodeLastRune(text)
+			if previousSize == 0 || i >= len(line) {
+				continue
+			}
+			next, nextSize := utf8.DecodeRuneInString(line[i:])
+			if next == '\b' || ansi && next == esc {
+				continue
+			}
+			i += nextSize
+			struck := styles[len(styles)-1]
+			text = text[:len(text)-previousSize]
+			styles = styles[:len(styles)-previousSize]
+			write(overstruck(previous, next, &struck), struck)
+		default:
+			write(r, style)
+			i += size
+		}
+	}
+	var spans []Span
+	for start, end := 0, 0; start < len(text); start = end {
+		for end = start + 1; end < len(text) && styles[end] == styles[start]; end++ {
+		}
+		if styles[start] != DefaultStyle {
+			spans = append(spans, Span{Start: start, End: end, Style: styles[start]})
+		}
+	}
+	return string(text), spans
+}
+
+// overstruck returns the character printed over another one, like on a typewriter: a character struck twice
+// is bold, with the underscore it is underlined.
+func overstruck(previous rune, next rune, style *Style) rune {
+	switch {
+	case previous == next:
+		style.Attributes |= tcell.AttrBold
+	case previous == '_':
+		style.Attributes |= tcell.AttrUnderline
+	case next == '_':
+		style.Attributes |= tcell.AttrUnderline
+		return previous
+	}
+	return next
+}
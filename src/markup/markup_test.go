@@ -0,0 +1,113 @@
+package markup
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gdamore/tcell"
+)
+
+func TestStripAnsi(t *testing.T) {
+	values := []struct {
+		Line     string
+		Expected string
+	}{
+		{"Litwo! Ojczyzno moja!", "Litwo! Ojczyzno moja!"},
+		{"\x1b[1;31mLitwo!\x1b[0m Ojczyzno moja!", "Litwo! Ojczyzno moja!"},
+		{"\x1b[38;5;208mLitwo!\x1b[m \x1b[KOjczyzno \x1b]8;;http://x\x07moja!\x1b]8;;\x1b\\", "Litwo! Ojczyzno moja!"},
+		{"\x1b(BLitwo!\x1b[", "Litwo!"},
+	}
+	for _, v := range values {
+		if got := StripAnsi(v.Line); got != v.Expected {
+			t.Errorf("StripAnsi(%q) => %q; want %q", v.Line, got, v.Expected)
+		}
+	}
+}
+
+func TestParseAnsiSGR(t *testing.T) {
+	red := Style{Foreground: tcell.ColorMaroon, Background: tcell.ColorDefault, Attributes: tcell.AttrBold}
+	orange := Style{Foreground: tcell.Color(208), Background: tcell.NewRGBColor(0, 0, 128), Attributes: tcell.AttrNone}
+	underlined := Style{Foreground: tcell.ColorDefault, Background: tcell.ColorDefault, Attributes: tcell.AttrUnderline}
+	values := []struct {
+		Line     string
+		Text     string
+		Expected []Span
+	}{
+		{"Litwo!", "Litwo!", nil},
+		{"\x1b[1;31mLitwo!\x1b[0m Ojczyzno", "Litwo! Ojczyzno", []Span{{0, 6, red}}},
+		{"\x1b[38;5;208;48;2;0;0;128mLitwo!\x1b[39;49;4m Ojczyzno\x1b[24m moja!", "Litwo! Ojczyzno moja!",
+			[]Span{{0, 6, orange}, {6, 15, underlined}}},
+	}
+	for _, v := range values {
+		text, spans := Parse(v.Line, true, false)
+		if text != v.Text || !reflect.DeepEqual(spans, v.Expected) {
+			t.Errorf("Parse(%q) => %q, %v; want %q, %v", v.Line, text, spans, v.Text, v.Expected)
+		}
+	}
+}
+
+func TestStyleAt(t *testing.T) {
+	red := Style{Foreground: tcell.ColorMaroon, Background: tcell.ColorDefault, Attributes: tcell.AttrNone}
+	spans := []Span{{2, 4, red}, {6, 7, red}}
+	expected := []Style{DefaultStyle, DefaultStyle, red, red, DefaultStyle, DefaultStyle, red, DefaultStyle}
+	index := 0
+	for offset, e := range expected {
+		if got := StyleAt(spans, offset, &index); got != e {
+			t.Errorf("StyleAt(%d) => %v; want %v", offset, got, e)
+		}
+	}
+}
+
+func TestHighlightAt(t *testing.T) {
+	red := Style{Foreground: tcell.ColorMaroon, Background: tcell.ColorDefault, Attributes: tcell.AttrNone}
+	green := Style{Foreground: tcell.ColorGreen, Background: tcell.ColorYellow, Attributes: tcell.AttrNone}
+	spans := []Span{{1, 5, red}, {3, 4, green}, {0, 2, green}}
+	expected := []Style{green, green, red, green, red, DefaultStyle}
+	for offset, e := range expected {
+		if got, ok := HighlightAt(spans, offset); got != e || ok != (e != DefaultStyle) {
+			t.Errorf("HighlightAt(%d) => %v, %v; want %v", offset, got, ok, e)
+		}
+	}
+	base := tcell.StyleDefault.Foreground(tcell.ColorWhite).Background(tcell.ColorBlack).Bold(true)
+	fg, bg, attrs := green.Overlay(base).Decompose()
+	if fg != tcell.ColorGreen || bg != tcell.ColorYellow || attrs != tcell.AttrBold {
+		t.Errorf("Overlay() => %v, %v, %v; want %v, %v, %v", fg, bg, attrs, tcell.ColorGreen, tcell.ColorYellow, tcell.AttrBold)
+	}
+}
+
+func TestParseAnsiMode(t *testing.T) {
+	for _, mode := range []AnsiMode{AnsiRender, AnsiStrip, AnsiRaw} {
+		if got, err := ParseAnsiMode(mode.String()); err != nil || got != mode {
+			t.Errorf("ParseAnsiMode(\"%s\") => %v, %v; want %v", mode.String(), got, err, mode)
+		}
+	}
+	if _, err := ParseAnsiMode("colors"); err == nil {
+		t.Errorf("ParseAnsiMode(\"colors\") => nil error; want an error")
+	}
+}
+
+func TestParseOverstrike(t *testing.T) {
+	bold := Style{Foreground: tcell.ColorDefault, Background: tcell.ColorDefault, Attributes: tcell.AttrBold}
+	underlined := Style{Foreground: tcell.ColorDefault, Background: tcell.ColorDefault, Attributes: tcell.AttrUnderline}
+	values := []struct {
+		Line     string
+		Text     string
+		Expected []Span
+	}{
+		{"NAME", "NAME", nil},
+		{"N\bNA\bAM\bME\bE", "NAME", []Span{{0, 4, bold}}},
+		{"ls \b_-\b_l", "ls -l", []Span{{2, 4, underlined}}},
+		{"m\bm_\b_x\b_", "m_x", []Span{{0, 2, bold}, {2, 3, underlined}}},
+		{"_\bf_\bi_\bl_\bę", "filę", []Span{{0, 5, underlined}}},
+		{"\bx\b", "x", nil},
+	}
+	for _, v := range values {
+		text, spans := Parse(v.Line, false, true)
+		if text != v.Text || !reflect.DeepEqual(spans, v.Expected) {
+			t.Errorf("Parse(%q) => %q, %v; want %q, %v", v.Line, text, spans, v.Text, v.Expected)
+		}
+	}
+	if got := Strip("\x1b[1mN\bNAME\x1b[0m", true, true); got != "NAME" {
+		t.Errorf("Strip(\"\\x1b[1mN\\bNAME\\x1b[0m\") => %q; want \"NAME\"", got)
+	}
+}
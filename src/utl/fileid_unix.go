@@ -0,0 +1,17 @@
+//go:build !windows
+// +build !windows
+
+package utl
+
+import (
+	"os"
+	"syscall"
+)
+
+// FileInode returns the inode number of the file described by info, or 0 if it is unknown.
+func FileInode(info os.FileInfo) uint64 {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Ino)
+	}
+	return 0
+}
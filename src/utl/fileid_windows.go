@@ -0,0 +1,13 @@
+//go:build windows
+// +build windows
+
+package utl
+
+import (
+	"os"
+)
+
+// FileInode returns the inode number of the file described by info, or 0 if it is unknown.
+func FileInode(info os.FileInfo) uint64 {
+	return 0
+}
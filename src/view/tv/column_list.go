@@ -0,0 +1,113 @@
+package tv
+
+import (
+	"github.com/bry00/m/utl"
+	"github.com/bry00/m/view"
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+)
+
+const columnListTitle = " Columns (space - show/hide, -/+ - move) "
+
+// ColumnList lets the user choose columns of the table shown and their order.
+type ColumnList struct {
+	*tview.List
+	view    *View
+	columns []view.TableColumn
+}
+
+func newColumnList(view *View, screenWidth int, screenHeight int) (list *ColumnList, width int, height int) {
+	width = utl.MinInt(utl.MaxInt(len(columnListTitle)+4, screenWidth/3), screenWidth)
+	height = utl.MaxInt(screenHeight/3*2, utl.MinInt(5, screenHeight))
+
+	list = &ColumnList{
+		List: tview.NewList().ShowSecondaryText(false),
+		view: view,
+	}
+	list.SetBorder(true).SetTitle(columnListTitle)
+	list.SetSelectedFunc(func(index int, mainText string, secondaryText string, shortcut rune) {
+		view.pages.SwitchToPage(pageMain)
+	})
+	list.SetDoneFunc(func() {
+		view.pages.SwitchToPage(pageMain)
+	})
+	list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() != tcell.KeyRune {
+			return event
+		}
+		switch event.Rune() {
+		case 'q':
+			view.pages.SwitchToPage(pageMain)
+		case ' ':
+			list.toggle(list.GetCurrentItem())
+		case '-':
+			list.move(list.GetCurrentItem(), -1)
+		case '+':
+			list.move(list.GetCurrentItem(), 1)
+		default:
+			return event
+		}
+		return nil
+	})
+	view.columnList = list
+	return
+}
+
+func (l *ColumnList) Display() {
+	l.columns = l.view.ctl.GetTableColumns()
+	l.fill()
+	l.SetCurrentItem(0)
+	l.view.pages.ShowPage(pageColumns)
+	l.view.app.SetFocus(l)
+}
+
+func (l *ColumnList) fill() {
+	l.Clear()
+	for _, c := range l.columns {
+		check := "[ ] "
+		if c.Shown {
+			check = "[x] "
+		}
+		l.AddItem(tview.Escape(check+c.Name), "", 0, nil)
+	}
+}
+
+// toggle shows or hides the column; the last column shown cannot be hidden.
+func (l *ColumnList) toggle(index int) {
+	if index < 0 || index >= len(l.columns) {
+		return
+	}
+	if l.columns[index].Shown && len(l.shownColumns()) == 1 {
+		l.view.GetStatusBar().Message("At least one column must be shown")
+		return
+	}
+	l.columns[index].Shown = !l.columns[index].Shown
+	l.apply(index)
+}
+
+// move moves the column up (or down) the list, i.e. to the left (or right) in the table.
+func (l *ColumnList) move(index int, delta int) {
+	target := index + delta
+	if index < 0 || target < 0 || target >= len(l.columns) {
+		return
+	}
+	l.columns[index], l.columns[target] = l.columns[target], l.columns[index]
+	l.apply(target)
+}
+
+func (l *ColumnList) shownColumns() []int {
+	result := make([]int, 0, len(l.columns))
+	for _, c := range l.columns {
+		if c.Shown {
+			result = append(result, c.Index)
+		}
+	}
+	return result
+}
+
+// apply shows the columns chosen, the item of the index given stays selected.
+func (l *ColumnList) apply(index int) {
+	l.view.ctl.SetTableColumns(l.shownColumns())
+	l.fill()
+	l.SetCurrentItem(index)
+}
@@ -0,0 +1,61 @@
+package tv
+
+import (
+	"github.com/bry00/m/utl"
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+)
+
+const documentListTitle = " Files "
+
+type DocumentList struct {
+	*tview.List
+	view *View
+}
+
+func newDocumentList(view *View, screenWidth int, screenHeight int) (list *DocumentList, width int, height int) {
+	titles := view.ctl.GetDocumentTitles()
+	width = len(documentListTitle)
+	for _, title := range titles {
+		width = utl.MaxInt(width, len(title))
+	}
+	width = utl.MinInt(width+8, screenWidth)
+	height = utl.MinInt(len(titles)+2, screenHeight-5)
+
+	list = &DocumentList{
+		List: tview.NewList().ShowSecondaryText(false),
+		view: view,
+	}
+	list.SetBorder(true).SetTitle(documentListTitle)
+	list.SetSelectedFunc(func(index int, mainText string, secondaryText string, shortcut rune) {
+		view.pages.SwitchToPage(pageMain)
+		view.ctl.SwitchDocument(index)
+	})
+	list.SetDoneFunc(func() {
+		view.pages.SwitchToPage(pageMain)
+	})
+	list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyRune && event.Rune() == 'q' {
+			view.pages.SwitchToPage(pageMain)
+			return nil
+		}
+		return event
+	})
+	view.documentList = list
+	return
+}
+
+func (l *DocumentList) Display() {
+	l.Clear()
+	for i, title := range l.view.ctl.GetDocumentTitles() {
+		var shortcut rune
+		if i < 9 {
+			shortcut = rune('1' + i)
+		}
+		l.AddItem(tview.Escape(title), "", shortcut, nil)
+	}
+	current, _ := l.view.ctl.GetDocumentIndex()
+	l.SetCurrentItem(current)
+	l.view.pages.ShowPage(pageDocuments)
+	l.view.app.SetFocus(l)
+}
@@ -0,0 +1,106 @@
+package tv
+
+import (
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+	"strings"
+)
+
+type FilterDialog struct {
+	*tview.Form
+	view        *View
+	startOfEdit bool
+}
+
+func newFilterDialog(view *View, screenWidth int) (dialog *FilterDialog, width int, height int) {
+	width = screenWidth / 3 * 2
+	if width < 20 {
+		width = 20
+	}
+	form := tview.NewForm().
+		AddInputField("Filter:", "", width-12, nil, nil).
+		AddCheckbox("Exclude:", false, nil)
+
+	dialog = &FilterDialog{
+		Form: form,
+		view: view,
+	}
+	cancelFun := func() {
+		view.pages.SwitchToPage(pageMain)
+	}
+
+	okFun := func() {
+		pattern := strings.TrimSpace(dialog.GetPattern())
+		if len(pattern) > 0 {
+			if err := view.ctl.AddFilter(pattern, dialog.IsExclude()); err != nil {
+				view.GetStatusBar().Message("Wrong filter \"%s\": %s", pattern, err.Error())
+				return
+			}
+		}
+		view.pages.SwitchToPage(pageMain)
+	}
+	form.SetButtonsAlign(tview.AlignRight).
+		AddButton("Add", func() {
+			dialog.view.app.SetFocus(dialog.GetPatternField())
+			view.app.QueueEvent(tcell.NewEventKey(tcell.KeyEnter, '\x00', 0))
+		}).
+		AddButton("Remove all", func() {
+			view.ctl.ClearFilters()
+			view.pages.SwitchToPage(pageMain)
+		}).
+		AddButton("Cancel", func() {
+			dialog.view.app.SetFocus(dialog.GetPatternField())
+			view.app.QueueEvent(tcell.NewEventKey(tcell.KeyEscape, '\x00', 0))
+		}).
+		SetCancelFunc(cancelFun)
+	form.SetBorder(true)
+	form.SetTitle(" Show lines matching (or, if excluded, not matching) the pattern ")
+
+	patternField := dialog.GetPatternField()
+	patternField.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		view.GetStatusBar().Reset()
+		switch event.Key() {
+		case tcell.KeyEnter:
+			okFun()
+			return nil
+		case tcell.KeyHome:
+			return event
+		case tcell.KeyRune:
+			if dialog.startOfEdit {
+				patternField.SetText("")
+				dialog.startOfEdit = false
+			}
+		default:
+			dialog.startOfEdit = false
+		}
+		return event
+	})
+
+	height = 9
+	view.filterDialog = dialog
+	return
+}
+
+func (s *FilterDialog) Display() {
+	s.view.pages.ShowPage(pageFilter)
+	s.view.app.SetFocus(s.GetPatternField())
+	s.startOfEdit = true
+	s.GetExcludeCheck().SetChecked(false)
+	s.view.app.QueueEvent(tcell.NewEventKey(tcell.KeyHome, 0, 0))
+}
+
+func (s *FilterDialog) GetPatternField() *tview.InputField {
+	return s.GetFormItem(0).(*tview.InputField)
+}
+
+func (s *FilterDialog) GetExcludeCheck() *tview.Checkbox {
+	return s.GetFormItem(1).(*tview.Checkbox)
+}
+
+func (s *FilterDialog) GetPattern() string {
+	return s.GetPatternField().GetText()
+}
+
+func (s *FilterDialog) IsExclude() bool {
+	return s.GetExcludeCheck().IsChecked()
+}
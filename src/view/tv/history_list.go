@@ -0,0 +1,98 @@
+package tv
+
+import (
+	"github.com/bry00/m/utl"
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+)
+
+// HistoryList is the popup listing the history of a dialog input field, an entry selected is put in the field.
+type HistoryList struct {
+	*tview.List
+	view     *View
+	back     tview.Primitive
+	selected func(index int)
+}
+
+func newHistoryList(view *View, screenWidth int, screenHeight int) (list *HistoryList, width int, height int) {
+	width = utl.MaxInt(screenWidth/3*2, utl.MinInt(20, screenWidth))
+	height = utl.MaxInt(screenHeight/2, utl.MinInt(5, screenHeight))
+
+	list = &HistoryList{
+		List: tview.NewList().ShowSecondaryText(false),
+		view: view,
+	}
+	list.SetBorder(true)
+	list.SetSelectedFunc(func(index int, mainText string, secondaryText string, shortcut rune) {
+		list.close()
+		if list.selected != nil {
+			list.selected(index)
+		}
+	})
+	list.SetDoneFunc(list.close)
+	list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyRune && event.Rune() == 'q' {
+			list.close()
+			return nil
+		}
+		return event
+	})
+	view.historyList = list
+	return
+}
+
+// Display shows the entries given, with the current one selected, over the dialog (or the main page); the focus
+// goes back to the primitive given, when the list is closed.
+func (l *HistoryList) Display(title string, entries []string, current int, back tview.Primitive,
+	selected func(index int)) {
+	if len(entries) == 0 {
+		l.view.GetStatusBar().Message("The history is empty")
+		return
+	}
+	l.Clear()
+	for _, entry := range entries {
+		l.AddItem(tview.Escape(entry), "", 0, nil)
+	}
+	l.SetCurrentItem(current)
+	l.SetTitle(" " + title + " ")
+	l.back = back
+	l.selected = selected
+	l.view.pages.ShowPage(pageHistory)
+	l.view.app.SetFocus(l)
+}
+
+func (l *HistoryList) close() {
+	l.view.pages.HidePage(pageHistory)
+	if l.back != nil {
+		l.view.app.SetFocus(l.back)
+	}
+}
+
+// historyRecall walks through the history of an input field with Up and Down keys. The position -1 stands for
+// the text typed in the field, before going through the history.
+type historyRecall struct {
+	position int
+	draft    string
+}
+
+func (r *historyRecall) reset() {
+	r.position = -1
+	r.draft = ""
+}
+
+// move goes to an older (or newer) entry of the history of the length given. It returns the position of the entry
+// to show, -1 for the text typed (kept in draft); false if there is nowhere to go.
+func (r *historyRecall) move(older bool, length int, text string) (int, bool) {
+	position := r.position - 1
+	if older {
+		position = r.position + 1
+	}
+	if position < -1 || position >= length {
+		return r.position, false
+	}
+	if r.position < 0 {
+		r.draft = text
+	}
+	r.position = position
+	return position, true
+}
@@ -11,14 +11,15 @@ type LineDialog struct {
 	*tview.Form
 	view        *View
 	startOfEdit bool
+	recall      historyRecall
 }
 
 func newLineDialog(view *View) (dialog *LineDialog, width int, height int) {
-	width = 23
+	width = 36
 	height = 7
 
 	form := tview.NewForm().
-		AddInputField("Line: ", "", width-10, func(textToCheck string, lastChar rune) bool {
+		AddInputField("Line: ", "", 13, func(textToCheck string, lastChar rune) bool {
 			if unicode.IsDigit(lastChar) {
 				return true
 			}
@@ -36,12 +37,13 @@ func newLineDialog(view *View) (dialog *LineDialog, width int, height int) {
 
 	okFun := func() {
 		lineNo := dialog.GetLineNo()
-		lines := view.ctl.NoOfLines()
+		lines := view.ctl.GetSourceLine(view.ctl.NoOfLines()-1) + 1
 		if lineNo > lines {
 			view.GetStatusBar().Message("There are only %d lines in this file, thus you cannot go to line %d",
 				lines, lineNo)
 		} else {
 			if lineNo > 0 {
+				view.ctl.AddGotoHistory(lineNo)
 				view.ctl.SetPointedLine(lineNo)
 				view.app.QueueEvent(tcell.NewEventKey(tcell.KeyRune, ':', 0))
 			} else {
@@ -55,6 +57,7 @@ func newLineDialog(view *View) (dialog *LineDialog, width int, height int) {
 			dialog.view.app.SetFocus(dialog.GetLineField())
 			view.app.QueueEvent(tcell.NewEventKey(tcell.KeyEnter, '\x00', 0))
 		}).
+		AddButton("History", dialog.showHistory).
 		AddButton("Cancel", func() {
 			dialog.view.app.SetFocus(dialog.GetLineField())
 			view.app.QueueEvent(tcell.NewEventKey(tcell.KeyEscape, '\x00', 0))
@@ -69,6 +72,12 @@ func newLineDialog(view *View) (dialog *LineDialog, width int, height int) {
 		case tcell.KeyEnter:
 			okFun()
 			return nil
+		case tcell.KeyUp, tcell.KeyDown:
+			dialog.recallHistory(event.Key() == tcell.KeyUp)
+			return nil
+		case tcell.KeyCtrlR:
+			dialog.showHistory()
+			return nil
 		case tcell.KeyHome:
 			return event
 		case tcell.KeyRune:
@@ -90,6 +99,7 @@ func (s *LineDialog) Display() {
 	s.view.pages.ShowPage(pageGoToLine)
 	s.view.app.SetFocus(s.GetLineField())
 	s.startOfEdit = true
+	s.recall.reset()
 	s.view.app.QueueEvent(tcell.NewEventKey(tcell.KeyHome, 0, 0))
 }
 
@@ -104,3 +114,30 @@ func (s *LineDialog) GetLineNo() int {
 		return result
 	}
 }
+
+// recallHistory puts an older (or newer) line number of the history in the line field.
+func (s *LineDialog) recallHistory(older bool) {
+	lines := s.view.ctl.GetGotoHistory()
+	if position, ok := s.recall.move(older, len(lines), s.GetLineField().GetText()); ok {
+		s.startOfEdit = false
+		if position < 0 {
+			s.GetLineField().SetText(s.recall.draft)
+		} else {
+			s.GetLineField().SetText(strconv.Itoa(lines[position]))
+		}
+	}
+}
+
+// showHistory shows the popup with line numbers gone to recently.
+func (s *LineDialog) showHistory() {
+	lines := s.view.ctl.GetGotoHistory()
+	texts := make([]string, len(lines))
+	for i, lineNo := range lines {
+		texts[i] = strconv.Itoa(lineNo)
+	}
+	s.view.historyList.Display("Go to history", texts, 0, s.GetLineField(), func(index int) {
+		s.recall.reset()
+		s.startOfEdit = false
+		s.GetLineField().SetText(texts[index])
+	})
+}
@@ -0,0 +1,77 @@
+package tv
+
+import (
+	"fmt"
+
+	"github.com/bry00/m/utl"
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+)
+
+const markListTitle = " Marks (Del - delete) "
+
+type MarkList struct {
+	*tview.List
+	view  *View
+	names []rune
+}
+
+func newMarkList(view *View, screenWidth int, screenHeight int) (list *MarkList, width int, height int) {
+	width = utl.MaxInt(screenWidth/3*2, utl.MinInt(40, screenWidth))
+	height = utl.MinInt('z'-'a'+3, screenHeight-5)
+
+	list = &MarkList{
+		List: tview.NewList().ShowSecondaryText(false),
+		view: view,
+	}
+	list.SetBorder(true).SetTitle(markListTitle)
+	list.SetSelectedFunc(func(index int, mainText string, secondaryText string, shortcut rune) {
+		view.pages.SwitchToPage(pageMain)
+		view.ctl.GotoMark(list.names[index])
+	})
+	list.SetDoneFunc(func() {
+		view.pages.SwitchToPage(pageMain)
+	})
+	list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch {
+		case event.Key() == tcell.KeyRune && event.Rune() == 'q':
+			view.pages.SwitchToPage(pageMain)
+			return nil
+		case event.Key() == tcell.KeyDelete && len(list.names) > 0:
+			index := list.GetCurrentItem()
+			view.ctl.DeleteMark(list.names[index])
+			list.fill()
+			if len(list.names) == 0 {
+				view.pages.SwitchToPage(pageMain)
+			} else {
+				list.SetCurrentItem(utl.MinInt(index, len(list.names)-1))
+			}
+			return nil
+		}
+		return event
+	})
+	view.markList = list
+	return
+}
+
+func (l *MarkList) Display() {
+	l.fill()
+	if len(l.names) == 0 {
+		l.view.GetStatusBar().Message("There are no marks, press m and a letter to set one")
+		return
+	}
+	l.SetCurrentItem(0)
+	l.view.pages.ShowPage(pageMarks)
+	l.view.app.SetFocus(l)
+}
+
+// fill lists the marks of the current file; the letter of a mark is the shortcut to go to it.
+func (l *MarkList) fill() {
+	l.Clear()
+	marks := l.view.ctl.GetMarks()
+	l.names = make([]rune, len(marks))
+	for i, m := range marks {
+		l.names[i] = m.Name
+		l.AddItem(fmt.Sprintf("%7d: %s", m.LineNo, tview.Escape(m.Text)), "", m.Name, nil)
+	}
+}
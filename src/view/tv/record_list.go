@@ -0,0 +1,79 @@
+package tv
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bry00/m/utl"
+	"github.com/bry00/m/view"
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+)
+
+// RecordList shows the line pointed (or the top one) broken out into fields of the record layout; selecting a field
+// moves the column cursor to it.
+type RecordList struct {
+	*tview.List
+	view   *View
+	fields []view.RecordField
+}
+
+func newRecordList(view *View, screenWidth int, screenHeight int) (list *RecordList, width int, height int) {
+	width = utl.MaxInt(screenWidth/3*2, utl.MinInt(40, screenWidth))
+	height = utl.MaxInt(screenHeight/3*2, utl.MinInt(5, screenHeight))
+
+	list = &RecordList{
+		List: tview.NewList().ShowSecondaryText(false),
+		view: view,
+	}
+	list.SetBorder(true)
+	list.SetSelectedFunc(func(index int, mainText string, secondaryText string, shortcut rune) {
+		view.pages.SwitchToPage(pageMain)
+		view.ctl.SetColumnCursor(list.fields[index].Start)
+	})
+	list.SetDoneFunc(func() {
+		view.pages.SwitchToPage(pageMain)
+	})
+	list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyRune && event.Rune() == 'q' {
+			view.pages.SwitchToPage(pageMain)
+			return nil
+		}
+		return event
+	})
+	view.recordList = list
+	return
+}
+
+// Display lists fields of the record with their columns, types and values; values not matching the type of
+// their fields are shown in the no match color.
+func (l *RecordList) Display() {
+	lineNo, fields := l.view.ctl.GetRecordFields()
+	l.fields = fields
+	nameWidth, typeWidth := 0, 0
+	for _, f := range fields {
+		nameWidth = utl.MaxInt(nameWidth, utf8.RuneCountInString(f.Name))
+		typeWidth = utl.MaxInt(typeWidth, utf8.RuneCountInString(f.Type))
+	}
+	noMatchColor := l.view.ctl.GetConfig().Visual.Highlight.NoMatchColor
+	cursor := view.FieldAt(l.view.ctl.GetLayoutFields(), l.view.ctl.GetColumnCursor())
+	l.Clear()
+	for _, f := range fields {
+		value := tview.Escape(f.Value)
+		if !f.Valid {
+			value = fmt.Sprintf("[%s]%s[-]", noMatchColor, value)
+		}
+		l.AddItem(fmt.Sprintf("%s %5d-%-5d %s │%s│", tview.Escape(pad(f.Name, nameWidth)), f.Start+1,
+			f.Start+f.Length, tview.Escape(pad(f.Type, typeWidth)), value), "", 0, nil)
+	}
+	l.SetCurrentItem(utl.MaxInt(cursor, 0))
+	l.SetTitle(fmt.Sprintf(" Record: line #%d ", lineNo))
+	l.view.pages.ShowPage(pageRecord)
+	l.view.app.SetFocus(l)
+}
+
+// pad pads the text with spaces to the width given.
+func pad(text string, width int) string {
+	return text + strings.Repeat(" ", utl.MaxInt(width-utf8.RuneCountInString(text), 0))
+}
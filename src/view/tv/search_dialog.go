@@ -1,6 +1,8 @@
 package tv
 
 import (
+	"github.com/bry00/m/utl"
+	"github.com/bry00/m/view"
 	"github.com/gdamore/tcell"
 	"github.com/rivo/tview"
 	"strings"
@@ -14,30 +16,58 @@ type SearchDialog struct {
 	view                *View
 	startOfEdit         bool
 	searchFromBeginning bool
+	recall              historyRecall
+}
+
+// searchInput is the input field of the search string, which turns red when the string is not found.
+type searchInput struct {
+	*tview.InputField
+	noMatch      bool
+	noMatchColor tcell.Color
+}
+
+func (i *searchInput) SetFormAttributes(labelWidth int, labelColor, bgColor, fieldTextColor,
+	fieldBgColor tcell.Color) tview.FormItem {
+	if i.noMatch {
+		fieldBgColor = i.noMatchColor
+	}
+	i.InputField.SetFormAttributes(labelWidth, labelColor, bgColor, fieldTextColor, fieldBgColor)
+	return i
 }
 
 func newSearchDialog(view *View, screenWidth int) (dialog *SearchDialog, width int, height int) {
 	cnf := view.ctl.GetConfig()
-	width = screenWidth / 3 * 2
+	width = utl.MaxInt(screenWidth/3*2, utl.MinInt(66, screenWidth))
 	if width < 20 {
 		width = 20
 	}
+	input := &searchInput{
+		InputField:   tview.NewInputField().SetLabel("Find:").SetFieldWidth(width - 10),
+		noMatchColor: tcell.GetColor(cnf.Visual.Highlight.NoMatchColor),
+	}
 	form := tview.NewForm().
-		AddInputField("Find:", "", width-10, nil, nil).
+		AddFormItem(input).
 		AddCheckbox("Ignore Case:", cnf.Search.IgnoreCase, nil).
-		AddCheckbox("Plain:", false, nil)
+		AddCheckbox("Plain:", false, nil).
+		AddCheckbox("Whole Word:", cnf.Search.WholeWord, nil).
+		AddCheckbox("Smart Case:", cnf.Search.SmartCase, nil).
+		AddCheckbox("Wrap Around:", cnf.Search.WrapAround, nil)
 
 	dialog = &SearchDialog{
 		Form: form,
 		view: view,
 	}
 	cancelFun := func() {
+		view.ctl.EndIncrementalSearch(true)
 		view.pages.SwitchToPage(pageMain)
 	}
 
 	okFun := func() {
+		view.ctl.EndIncrementalSearch(false)
 		searchText := strings.TrimSpace(dialog.GetSearchText())
 		if len(searchText) > 0 {
+			view.ctl.AddSearchHistory(searchText, dialog.IsRegexSearch(), dialog.IsIgnoreCaseSearch())
+			dialog.setSearchOptions()
 			view.ctl.SetSearchText(searchText, dialog.IsRegexSearch(), dialog.IsIgnoreCaseSearch())
 			var key rune
 			if dialog.searchFromBeginning {
@@ -64,8 +94,12 @@ func newSearchDialog(view *View, screenWidth int) (dialog *SearchDialog, width i
 			f.SetText("")
 			dialog.GetIgnoreCaseCheck().SetChecked(false)
 			dialog.GetPlainCheck().SetChecked(false)
+			dialog.GetWholeWordCheck().SetChecked(false)
+			dialog.GetSmartCaseCheck().SetChecked(false)
+			dialog.GetWrapAroundCheck().SetChecked(false)
 			dialog.view.app.SetFocus(f)
 		}).
+		AddButton("History", dialog.showHistory).
 		AddButton("Cancel", func() {
 			dialog.view.app.SetFocus(dialog.GetSearchField())
 			view.app.QueueEvent(tcell.NewEventKey(tcell.KeyEscape, '\x00', 0))
@@ -74,11 +108,28 @@ func newSearchDialog(view *View, screenWidth int) (dialog *SearchDialog, width i
 	form.SetBorder(true)
 
 	searchField := dialog.GetSearchField()
+	if cnf.Search.Incremental {
+		searchField.SetChangedFunc(func(text string) {
+			dialog.searchIncrementally()
+		})
+		for _, check := range []*tview.Checkbox{dialog.GetIgnoreCaseCheck(), dialog.GetPlainCheck(),
+			dialog.GetWholeWordCheck(), dialog.GetSmartCaseCheck(), dialog.GetWrapAroundCheck()} {
+			check.SetChangedFunc(func(checked bool) {
+				dialog.searchIncrementally()
+			})
+		}
+	}
 	searchField.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		switch event.Key() {
 		case tcell.KeyEnter:
 			okFun()
 			return nil
+		case tcell.KeyUp, tcell.KeyDown:
+			dialog.recallHistory(event.Key() == tcell.KeyUp)
+			return nil
+		case tcell.KeyCtrlR:
+			dialog.showHistory()
+			return nil
 		case tcell.KeyHome:
 			return event
 		case tcell.KeyRune:
@@ -92,7 +143,7 @@ func newSearchDialog(view *View, screenWidth int) (dialog *SearchDialog, width i
 		return event
 	})
 
-	height = 11
+	height = 17
 	view.searchDialog = dialog
 	return
 }
@@ -102,11 +153,14 @@ func (s *SearchDialog) Display() {
 	s.view.app.SetFocus(s.GetSearchField())
 	s.startOfEdit = true
 	s.searchFromBeginning = false
+	s.recall.reset()
+	s.GetFormItem(0).(*searchInput).noMatch = false
+	s.view.ctl.BeginIncrementalSearch()
 	s.view.app.QueueEvent(tcell.NewEventKey(tcell.KeyHome, 0, 0))
 }
 
 func (s *SearchDialog) GetSearchField() *tview.InputField {
-	return s.GetFormItem(0).(*tview.InputField)
+	return s.GetFormItem(0).(*searchInput).InputField
 }
 
 func (s *SearchDialog) GetIgnoreCaseCheck() *tview.Checkbox {
@@ -117,6 +171,18 @@ func (s *SearchDialog) GetPlainCheck() *tview.Checkbox {
 	return s.GetFormItem(2).(*tview.Checkbox)
 }
 
+func (s *SearchDialog) GetWholeWordCheck() *tview.Checkbox {
+	return s.GetFormItem(3).(*tview.Checkbox)
+}
+
+func (s *SearchDialog) GetSmartCaseCheck() *tview.Checkbox {
+	return s.GetFormItem(4).(*tview.Checkbox)
+}
+
+func (s *SearchDialog) GetWrapAroundCheck() *tview.Checkbox {
+	return s.GetFormItem(5).(*tview.Checkbox)
+}
+
 func (s *SearchDialog) GetSearchText() string {
 	return s.GetSearchField().GetText()
 }
@@ -128,3 +194,53 @@ func (s *SearchDialog) IsIgnoreCaseSearch() bool {
 func (s *SearchDialog) IsRegexSearch() bool {
 	return !s.GetPlainCheck().IsChecked()
 }
+
+// searchIncrementally shows the occurrence of the text typed so far; the field turns red, when there is none.
+func (s *SearchDialog) searchIncrementally() {
+	input := s.GetFormItem(0).(*searchInput)
+	s.setSearchOptions()
+	s.view.ctl.IncrementalSearch(strings.TrimSpace(s.GetSearchText()), s.IsRegexSearch(), s.IsIgnoreCaseSearch(),
+		func(found bool) {
+			input.noMatch = !found
+		})
+}
+
+// setSearchOptions passes the options checked to the controller.
+func (s *SearchDialog) setSearchOptions() {
+	s.view.ctl.SetSearchOptions(s.GetWholeWordCheck().IsChecked(), s.GetSmartCaseCheck().IsChecked(),
+		s.GetWrapAroundCheck().IsChecked())
+}
+
+// recallHistory puts an older (or newer) search string of the history in the search field.
+func (s *SearchDialog) recallHistory(older bool) {
+	entries := s.view.ctl.GetSearchHistory()
+	if position, ok := s.recall.move(older, len(entries), s.GetSearchText()); ok {
+		if position < 0 {
+			s.setSearch(view.SearchHistoryEntry{Text: s.recall.draft, Regex: s.IsRegexSearch(),
+				IgnoreCase: s.IsIgnoreCaseSearch()})
+		} else {
+			s.setSearch(entries[position])
+		}
+	}
+}
+
+// showHistory shows the popup with the search history.
+func (s *SearchDialog) showHistory() {
+	entries := s.view.ctl.GetSearchHistory()
+	texts := make([]string, len(entries))
+	for i, e := range entries {
+		texts[i] = e.Text
+	}
+	s.view.historyList.Display("Search history", texts, 0, s.GetSearchField(), func(index int) {
+		s.recall.reset()
+		s.setSearch(entries[index])
+	})
+}
+
+// setSearch puts the search string and its options in the dialog.
+func (s *SearchDialog) setSearch(entry view.SearchHistoryEntry) {
+	s.startOfEdit = false
+	s.GetIgnoreCaseCheck().SetChecked(entry.IgnoreCase)
+	s.GetPlainCheck().SetChecked(!entry.Regex)
+	s.GetSearchField().SetText(entry.Text)
+}
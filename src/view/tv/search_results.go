@@ -0,0 +1,114 @@
+package tv
+
+import (
+	"fmt"
+
+	"github.com/bry00/m/utl"
+	"github.com/bry00/m/view"
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+)
+
+// resultLead is the number of characters shown before an occurrence, which is too far from the start of its line.
+const resultLead = 20
+
+type SearchResultsList struct {
+	*tview.List
+	view     *View
+	listed   int
+	found    int
+	complete bool
+}
+
+func newSearchResultsList(view *View, screenWidth int, screenHeight int) (list *SearchResultsList, width int, height int) {
+	width = utl.MaxInt(screenWidth/6*5, utl.MinInt(40, screenWidth))
+	height = utl.MaxInt(screenHeight/3*2, utl.MinInt(5, screenHeight))
+
+	list = &SearchResultsList{
+		List: tview.NewList().ShowSecondaryText(false),
+		view: view,
+	}
+	list.SetBorder(true)
+	list.SetSelectedFunc(func(index int, mainText string, secondaryText string, shortcut rune) {
+		view.pages.SwitchToPage(pageMain)
+		view.ctl.GotoSearchResult(index)
+	})
+	list.SetChangedFunc(func(index int, mainText string, secondaryText string, shortcut rune) {
+		list.showMatch(index)
+	})
+	list.SetDoneFunc(func() {
+		view.pages.SwitchToPage(pageMain)
+	})
+	list.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyRune && event.Rune() == 'q' {
+			view.pages.SwitchToPage(pageMain)
+			return nil
+		}
+		return event
+	})
+	list.updateTitle()
+	view.searchResultsList = list
+	return
+}
+
+func (l *SearchResultsList) Display() {
+	l.view.pages.ShowPage(pageSearchResults)
+	l.view.app.SetFocus(l)
+}
+
+func (l *SearchResultsList) Reset() {
+	l.Clear()
+	l.listed = 0
+	l.found = 0
+	l.complete = false
+	l.updateTitle()
+}
+
+// Add appends results to the list; found is the number of all lines found so far.
+func (l *SearchResultsList) Add(results []view.SearchResult, found int, complete bool) {
+	highlight := l.view.ctl.GetConfig().Visual.Highlight
+	tag := fmt.Sprintf("[%s:%s]", highlight.MatchTextColor, highlight.MatchBackgroundColor)
+	for _, r := range results {
+		l.AddItem(fmt.Sprintf("%7d: %s", r.LineNo, formatResult(r, tag)), "", 0, nil)
+	}
+	l.listed += len(results)
+	l.found = found
+	l.complete = complete
+	l.updateTitle()
+}
+
+func (l *SearchResultsList) updateTitle() {
+	title := fmt.Sprintf(" Search results: %d lines ", l.found)
+	if l.listed < l.found {
+		title = fmt.Sprintf(" Search results: %d lines, first %d listed ", l.found, l.listed)
+	}
+	if !l.complete {
+		title += "(searching...) "
+	}
+	l.SetTitle(title)
+}
+
+// showMatch shows "match k of N" for the item selected.
+func (l *SearchResultsList) showMatch(index int) {
+	if l.complete {
+		l.view.GetStatusBar().Message("Match %d of %d", index+1, l.found)
+	} else {
+		l.view.GetStatusBar().Message("Match %d of %d so far", index+1, l.found)
+	}
+}
+
+// formatResult returns the text of the result, with the occurrence highlighted by the color tag given.
+func formatResult(r view.SearchResult, tag string) string {
+	start := utl.CountRunesAtIndex(r.Text, r.Start)
+	end := utl.CountRunesAtIndex(r.Text, r.End)
+	runes := []rune(r.Text)
+	prefix := ""
+	from := 0
+	if start > resultLead*2 {
+		from = start - resultLead
+		prefix = "…"
+	}
+	return prefix + tview.Escape(string(runes[from:start])) +
+		tag + tview.Escape(string(runes[start:end])) + "[-:-]" +
+		tview.Escape(string(runes[end:]))
+}
@@ -58,6 +58,9 @@ func (sb *StatusBar) Draw(screen tcell.Screen) {
 	conf := sb.view.ctl.GetConfig()
 	color := tcell.GetColor(conf.Visual.StatusBar.TextColor)
 	statusLabel := sb.status.Display()
+	if info := sb.view.ctl.GetInputInfo(); len(info) > 0 {
+		statusLabel = tview.Escape(fmt.Sprintf("[%s]", info)) + " " + statusLabel
+	}
 	statusLabelWidth := tview.TaggedStringWidth(statusLabel)
 	if statusLabelWidth > 0 {
 		xLabel := width - (statusLabelWidth + 1)
@@ -68,10 +71,16 @@ func (sb *StatusBar) Draw(screen tcell.Screen) {
 		text = *sb.text
 	} else {
 		bottomRow := topRow + height
+		if sb.view.text.wrap {
+			bottomRow = sb.view.text.lastLine + 1
+		}
 		topRow++
 		leftColumn++
 		totalRows := sb.view.ctl.NoOfLines()
 		text = fmt.Sprintf("[::%s]%d:%d - %d / %d", conf.Visual.StatusBar.TextAttrs, topRow, leftColumn, bottomRow, totalRows)
+		if current, count := sb.view.ctl.GetDocumentIndex(); count > 1 {
+			text = fmt.Sprintf("[::%s](%d/%d) ", conf.Visual.StatusBar.TextAttrs, current+1, count) + text
+		}
 	}
 	tview.Print(screen, text, x+1, y, width, tview.AlignLeft, color)
 
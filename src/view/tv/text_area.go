@@ -7,12 +7,17 @@ import (
 	"strings"
 	"unicode/utf8"
 
+	"github.com/bry00/m/markup"
 	"github.com/bry00/m/utl"
 	"github.com/bry00/m/view"
 	"github.com/gdamore/tcell"
 	"github.com/rivo/tview"
 )
 
+// pinnedLine is the index of a line drawn on top of the others (the header row of the table or a frozen line
+// filtered out), which is neither pointed nor found.
+const pinnedLine = -2
+
 type TextArea struct {
 	*tview.Box
 	view          *View
@@ -27,6 +32,12 @@ type TextArea struct {
 	pointedLine   int
 	showRuler     bool
 	showNumbers   bool
+	wrap          bool
+	firstRow      int // the first row shown of the first line, when lines are wrapped
+	lastLine      int // the last line shown, at least partially
+
+	// pendingMark is the action of setting a mark (or going to it) waiting for the letter of the mark
+	pendingMark view.Action
 }
 
 func newTextArea(view *View) *TextArea {
@@ -47,7 +58,9 @@ func newTextArea(view *View) *TextArea {
 	}
 }
 
-func (t *TextArea) drawRuler(screen tcell.Screen, x int, y int, textWidth int) {
+// drawRuler draws the ruler with numbers of columns shown, the frozen ones first. With a record layout, the top
+// row of the ruler shows fields and the column cursor is shown in reverse.
+func (t *TextArea) drawRuler(screen tcell.Screen, x int, y int, textWidth int, frozen int) {
 	var (
 		line strings.Builder
 	)
@@ -55,12 +68,16 @@ func (t *TextArea) drawRuler(screen tcell.Screen, x int, y int, textWidth int) {
 	color := tcell.GetColor(config.Visual.Ruler.Color)
 	attr := fmt.Sprintf("[::%s]", config.Visual.Ruler.Attrs)
 	line.Grow(textWidth + len(attr))
+	fields := t.view.ctl.GetLayoutFields()
 
 	for j := 0; j < 3; j++ {
 		line.WriteString(attr)
+		if j == 0 && fields != nil {
+			line.WriteString(tview.Escape(string(t.fieldLabels(fields, textWidth, frozen))))
+		}
 		topPrintedDigits := 0
-		for c := 0; c < textWidth; c++ {
-			n := (c + t.firstColumn + 1)
+		for c := 0; c < textWidth && (j > 0 || fields == nil); c++ {
+			n := t.rulerColumn(c, frozen) + 1
 			digit := n % 10
 			switch j {
 			case 0:
@@ -86,6 +103,54 @@ func (t *TextArea) drawRuler(screen tcell.Screen, x int, y int, textWidth int) {
 		tview.Print(screen, line.String(), x, y+j, textWidth, tview.AlignLeft, color)
 		line.Reset()
 	}
+	if cursor := t.view.ctl.GetColumnCursor(); cursor >= 0 {
+		for c := 0; c < textWidth; c++ {
+			if t.rulerColumn(c, frozen) == cursor {
+				for j := 0; j < 3; j++ {
+					r, combining, style, _ := screen.GetContent(x+c, y+j)
+					_, _, attrs := style.Decompose()
+					screen.SetContent(x+c, y+j, r, combining, style.Reverse(attrs&tcell.AttrReverse == 0))
+				}
+			}
+		}
+	}
+}
+
+// rulerColumn returns the column of the line (counted from 0) shown at the position given of the text area.
+func (t *TextArea) rulerColumn(c int, frozen int) int {
+	if c >= frozen {
+		return c - frozen + t.firstColumn
+	}
+	return c
+}
+
+// fieldLabels returns the top row of the ruler with fields of the record layout: a field starts with a bar and
+// its name, which is repeated at the start of the part shown of a field cut on the left.
+func (t *TextArea) fieldLabels(fields []view.LayoutField, textWidth int, frozen int) []rune {
+	result := make([]rune, textWidth)
+	var label []rune
+	current := -1
+	for c := range result {
+		column := t.rulerColumn(c, frozen)
+		f := view.FieldAt(fields, column)
+		switch {
+		case f < 0:
+			result[c] = ' '
+			current = -1
+			continue
+		case column == fields[f].Start:
+			label = append([]rune{tcell.RuneVLine}, []rune(fields[f].Name)...)
+		case f != current || c == frozen:
+			label = []rune(fields[f].Name)
+		}
+		current = f
+		if len(label) > 0 {
+			result[c], label = label[0], label[1:]
+		} else {
+			result[c] = tcell.RuneHLine
+		}
+	}
+	return result
 }
 
 func (t *TextArea) getRulerPosition() int {
@@ -93,7 +158,7 @@ func (t *TextArea) getRulerPosition() int {
 		t.rulerPosition = t.height / 2
 	}
 	lines := t.view.ctl.NoOfLines()
-	if t.view.ctl.DataReady() {
+	if t.view.ctl.DataReady() && !t.wrap {
 		lines = utl.MinInt(t.height, lines)
 	} else {
 		lines = t.height
@@ -104,9 +169,6 @@ func (t *TextArea) getRulerPosition() int {
 	return t.rulerPosition
 }
 
-const aReverse = "[::r]"
-const aNormal = "[::-]"
-
 func numberString(n int, width int) string {
 	num := strconv.Itoa(n)
 	l := len(num)
@@ -129,11 +191,29 @@ func (t *TextArea) Draw(screen tcell.Screen) {
 	if t.view.ctl != nil {
 		conf := t.view.ctl.GetConfig()
 		numbersColor := tcell.GetColor(conf.Visual.Numbers.Color)
+		changedColor := tcell.GetColor(conf.Visual.Numbers.ChangedColor)
+		changedStyle := tcell.StyleDefault.Background(tview.Styles.PrimitiveBackgroundColor).Foreground(changedColor)
+		changedMark := rune(conf.Visual.Numbers.ChangedMark)
+		markStyle := tcell.StyleDefault.Background(tview.Styles.PrimitiveBackgroundColor).
+			Foreground(tcell.GetColor(conf.Visual.Numbers.MarkColor)).Bold(true)
 		arrowLeft := fmt.Sprintf("[%s::%s]%c", conf.Visual.SideArrows.Color, conf.Visual.SideArrows.Attrs, conf.Visual.SideArrows.Left)
 		arrowRight := fmt.Sprintf("[%s::%s]%c", conf.Visual.SideArrows.Color, conf.Visual.SideArrows.Attrs, conf.Visual.SideArrows.Right)
-		tabSpaces := strings.Repeat(" ", conf.View.SpacesPerTab)
+		t.SetTitle(" " + tview.Escape(t.view.ctl.GetFileNameTitle()) + " ")
 		t.Box.Draw(screen)
 		xBase, yTop, width, height := t.GetInnerRect()
+		header, headerSpans := t.view.ctl.GetTableHeader()
+		frozenLines := t.view.ctl.GetFrozenLines()
+		pinnedY := yTop
+		pinned := len(frozenLines)
+		if len(header) > 0 {
+			pinned = 1
+		}
+		if pinned = utl.MinInt(pinned, height-1); pinned > 0 {
+			yTop += pinned
+			height -= pinned
+		} else {
+			pinned = 0
+		}
 		showRuler := t.showRuler && height > rulerHeight
 		if showRuler {
 			height = height - rulerHeight
@@ -155,100 +235,247 @@ func (t *TextArea) Draw(screen tcell.Screen) {
 			textWidth = 0
 		}
 
-		t.width = textWidth
+		frozenWidth := 0
+		if !t.wrap {
+			frozenWidth = utl.MinInt(t.view.ctl.GetFrozenColumns(), textWidth)
+			t.firstColumn = utl.MaxInt(t.firstColumn, frozenWidth)
+		}
+		t.width = textWidth - frozenWidth
+
+		// gutter draws the number of the line (of the index given, -1 if not shown) and its mark, or arrow
+		gutter := func(lineIndex int, lineNo int, y int) {
+			changed := lineIndex >= 0 && t.view.ctl.IsLineChanged(lineIndex)
+			if t.showNumbers {
+				color := numbersColor
+				if changed {
+					color = changedColor
+				}
+				tview.Print(screen, numberString(lineNo, nummbersWidth), xBase, y, nummbersWidth, tview.AlignLeft, color)
+			}
+			mark := rune(0)
+			if lineIndex >= 0 {
+				mark = t.view.ctl.GetLineMark(lineIndex)
+			}
+			if mark != 0 {
+				screen.SetContent(xLeft, y, mark, nil, markStyle)
+			} else if !t.wrap && t.firstColumn > frozenWidth {
+				tview.PrintSimple(screen, arrowLeft, xLeft, y)
+			} else if changed {
+				screen.SetContent(xLeft, y, changedMark, nil, changedStyle)
+			}
+		}
+
+		if len(header) > 0 && pinned > 0 {
+			t.drawRow(screen, textCells(header, headerSpans, nil, 0), pinnedLine, xLeft+1, pinnedY, textWidth, frozenWidth)
+		} else {
+			for i, frozen := range frozenLines[:pinned] {
+				lineIndex := frozen.LineIndex
+				if lineIndex < 0 {
+					lineIndex = pinnedLine
+				}
+				gutter(frozen.LineIndex, frozen.LineNo, pinnedY+i)
+				if t.drawRow(screen, t.lineCells(frozen.Text), lineIndex, xLeft+1, pinnedY+i, textWidth, frozenWidth) &&
+					!t.wrap {
+					tview.PrintSimple(screen, arrowRight, xLeft+textWidth+1, pinnedY+i)
+				}
+			}
+		}
 
 		if iter, ok := t.view.ctl.GetDataIterator(t.firstLine); ok {
-			var i int
+			i := 0
 			rulerDrawn := false
-			for i = 0; i < height && iter.IndexOK(); i++ {
-				y := yTop + i
-				if t.showRuler {
-					if i == rulerIndex {
-						t.drawRuler(screen, xLeft+1, y, textWidth)
-						rulerDrawn = true
-					}
-					if i >= rulerIndex {
-						y += rulerHeight
-					}
-				}
-				if line, err := iter.GetLine(); err != nil {
+			firstRow := 0
+			if t.wrap {
+				firstRow = t.firstRow
+			}
+			t.lastLine = t.firstLine
+			for ; i < height && iter.IndexOK(); iter.IndexIncrement() {
+				line, err := iter.GetLine()
+				if err != nil {
 					log.Fatal(err)
-				} else {
-					lineIndex := t.firstLine + i
-					if t.showNumbers {
-						tview.Print(screen, numberString(lineIndex+1, nummbersWidth),
-							xBase, y, nummbersWidth, tview.AlignLeft, numbersColor)
+				}
+				lineIndex := iter.Index()
+				cells := t.lineCells(line)
+				rows := []int{t.firstColumn}
+				if t.wrap {
+					rows = view.WrapRows(cellRunes(cells), textWidth)
+					rows = rows[utl.MinInt(firstRow, len(rows)-1):]
+					firstRow = 0
+				}
+				for r, start := range rows {
+					if i >= height {
+						break
 					}
-
-					theLine := tview.Escape(strings.Replace(line, "\t", tabSpaces, -1))
-
-					if t.firstColumn >= utf8.RuneCountInString(theLine) {
-						line = ""
-					} else {
-						firstColumnIdx := utl.R2x(theLine, t.firstColumn)
-						if lineIndex == t.foundLine && t.foundStart >= 0 && t.foundEnd > firstColumnIdx {
-							var str strings.Builder
-							if firstColumnIdx < t.foundStart {
-								str.WriteString(theLine[firstColumnIdx:t.foundStart])
-							}
-							if lineIndex == t.pointedLine {
-								str.WriteString(aNormal)
-							} else {
-								str.WriteString(aReverse)
-							}
-							if firstColumnIdx > t.foundStart {
-								str.WriteString(theLine[firstColumnIdx:t.foundEnd])
-							} else {
-								str.WriteString(theLine[t.foundStart:t.foundEnd])
-							}
-							if lineIndex == t.pointedLine {
-								str.WriteString(aReverse)
-							} else {
-								str.WriteString(aNormal)
-							}
-							str.WriteString(theLine[t.foundEnd:])
-							line = str.String()
-						} else {
-							line = theLine[firstColumnIdx:]
+					y := yTop + i
+					if t.showRuler {
+						if i == rulerIndex {
+							t.drawRuler(screen, xLeft+1, y, textWidth, frozenWidth)
+							rulerDrawn = true
+						}
+						if i >= rulerIndex {
+							y += rulerHeight
 						}
 					}
-
-					lineLen := tview.TaggedStringWidth(line)
-
-					if lineIndex == t.pointedLine {
-						line = fmt.Sprintf("[::r]%-*s", textWidth, line)
+					if r == 0 {
+						gutter(lineIndex, t.view.ctl.GetSourceLine(lineIndex)+1, y)
 					}
-
-					if t.firstColumn > 0 {
-						tview.PrintSimple(screen, arrowLeft, xLeft, y)
-
-					}
-					tview.Print(screen, line, xLeft+1, y, textWidth, tview.AlignLeft, tview.Styles.PrimaryTextColor)
-
-					if lineLen > textWidth {
+					if t.wrap {
+						end := len(cells)
+						if r+1 < len(rows) {
+							end = rows[r+1]
+						}
+						t.drawLine(screen, cells[:end], start, lineIndex, xLeft+1, y, textWidth)
+					} else if t.drawRow(screen, cells, lineIndex, xLeft+1, y, textWidth, frozenWidth) {
 						tview.PrintSimple(screen, arrowRight, xLeft+textWidth+1, y)
 					}
+					t.lastLine = lineIndex
+					i++
 				}
-				iter.IndexIncrement()
 			}
 			if t.showRuler && !rulerDrawn {
-				t.drawRuler(screen, xLeft+1, yTop+i, textWidth)
+				t.drawRuler(screen, xLeft+1, yTop+i, textWidth, frozenWidth)
 				t.rulerPosition = i
 			}
 		}
 	}
 }
 
+// drawRow draws cells of the line from the first column shown, after the given number of frozen columns, which
+// are always drawn. It returns true, when the cells do not fit into the width given.
+func (t *TextArea) drawRow(screen tcell.Screen, cells []textCell, lineIndex int, x int, y int, width int, frozen int) bool {
+	if t.wrap {
+		return t.drawLine(screen, cells, 0, lineIndex, x, y, width)
+	}
+	if frozen > 0 {
+		t.drawLine(screen, cells[:utl.MinInt(frozen, len(cells))], 0, lineIndex, x, y, frozen)
+	}
+	return t.drawLine(screen, cells, t.firstColumn, lineIndex, x+frozen, y, width-frozen)
+}
+
+// textCell is a single character of a line, offset is its byte offset in the line shown (i.e. without escape
+// sequences and backspaces, with tabs expanded), as used by the search.
+type textCell struct {
+	r           rune
+	offset      int
+	style       markup.Style
+	highlight   markup.Style
+	highlighted bool
+}
+
+// lineCells splits the line into characters with their styles.
+func (t *TextArea) lineCells(line string) []textCell {
+	highlights := t.view.ctl.GetHighlights(line)
+	line, spans := t.view.ctl.ParseLine(line)
+	return textCells(line, spans, highlights, t.view.ctl.GetConfig().View.SpacesPerTab)
+}
+
+// textCells splits the visible text of a line into characters with styles of the spans and highlights given.
+func textCells(line string, spans []markup.Span, highlights []markup.Span, spacesPerTab int) []textCell {
+	cells := make([]textCell, 0, len(line))
+	offset := 0
+	spanIndex := 0
+	for i, r := range line {
+		style := markup.StyleAt(spans, i, &spanIndex)
+		if r == '\t' {
+			for j := 0; j < spacesPerTab; j++ {
+				cells = append(cells, textCell{r: ' ', offset: offset, style: style})
+				offset++
+			}
+		} else {
+			cells = append(cells, textCell{r: r, offset: offset, style: style})
+			offset += utf8.RuneLen(r)
+		}
+	}
+	if len(highlights) > 0 {
+		for i := range cells {
+			cells[i].highlight, cells[i].highlighted = markup.HighlightAt(highlights, cells[i].offset)
+		}
+	}
+	return cells
+}
+
+// cellRunes returns characters of the cells.
+func cellRunes(cells []textCell) []rune {
+	result := make([]rune, len(cells))
+	for i, cell := range cells {
+		result[i] = cell.r
+	}
+	return result
+}
+
+// drawLine draws cells of the line from the given one, with the found string and the pointed line
+// highlighted. It returns true, when the cells do not fit into the width given.
+func (t *TextArea) drawLine(screen tcell.Screen, cells []textCell, from int, lineIndex int, x int, y int, width int) bool {
+	baseStyle := tcell.StyleDefault.
+		Background(tview.Styles.PrimitiveBackgroundColor).
+		Foreground(tview.Styles.PrimaryTextColor)
+	pointed := lineIndex == t.pointedLine
+	found := lineIndex == t.foundLine && t.foundStart >= 0
+	xEnd := x + width
+	c := from
+	for ; c < len(cells); c++ {
+		cell := cells[c]
+		w := view.CellWidth(cell.r)
+		if x+w > xEnd {
+			break
+		}
+		style := cell.style.Apply(baseStyle)
+		if cell.highlighted {
+			style = cell.highlight.Overlay(style)
+		}
+		if highlighted := found && cell.offset >= t.foundStart && cell.offset < t.foundEnd; highlighted != pointed {
+			_, _, attrs := style.Decompose()
+			style = style.Reverse(attrs&tcell.AttrReverse == 0)
+		}
+		screen.SetContent(x, y, cell.r, nil, style)
+		x += w
+	}
+	if pointed {
+		for ; x < xEnd; x++ {
+			screen.SetContent(x, y, ' ', nil, baseStyle.Reverse(true))
+		}
+	}
+	return c < len(cells)
+}
+
 func (t *TextArea) InputHandler() func(event *tcell.EventKey, setFocus func(p tview.Primitive)) {
 	return t.WrapInputHandler(func(event *tcell.EventKey, setFocus func(p tview.Primitive)) {
 		t.view.statusBar.Reset()
-		action := textAreaShortcutMap.mapKeys(event)
-		if action != view.ActionUnknown {
+		if t.pendingMark != view.ActionUnknown {
+			t.markKey(event)
+			return
+		}
+		switch action := textAreaShortcutMap.mapKeys(event); action {
+		case view.ActionUnknown:
+		case view.ActionSetMark, view.ActionGotoMark:
+			t.pendingMark = action
+			if action == view.ActionSetMark {
+				t.view.statusBar.Message("Set mark: press a letter (a-z)")
+			} else {
+				t.view.statusBar.Message("Go to mark: press a letter (a-z)")
+			}
+		default:
 			t.view.ctl.DoAction(action)
 		}
 	})
 }
 
+// markKey sets the mark (or goes to the mark) of the letter typed after the key of the action.
+func (t *TextArea) markKey(event *tcell.EventKey) {
+	action := t.pendingMark
+	t.pendingMark = view.ActionUnknown
+	switch {
+	case event.Key() == tcell.KeyRune && event.Rune() >= 'a' && event.Rune() <= 'z':
+		if action == view.ActionSetMark {
+			t.view.ctl.SetMark(event.Rune())
+		} else {
+			t.view.ctl.GotoMark(event.Rune())
+		}
+	case event.Key() != tcell.KeyEscape:
+		t.view.statusBar.Message("Marks are letters from a to z")
+	}
+}
+
 var (
 	textAreaShortcuts = []shortcut{
 		{key: tcell.KeyUp, action: view.ActionScrollUp},
@@ -288,9 +515,36 @@ var (
 		{r: '\\', action: view.ActionReset},
 		{r: 'g', action: view.ActionTop},
 		{r: 'G', action: view.ActionBottom},
+		{r: 'F', action: view.ActionFollow},
+		{r: 'R', action: view.ActionReload},
+		{r: ']', action: view.ActionNextFile},
+		{r: '[', action: view.ActionPreviousFile},
+		{r: 'b', action: view.ActionFileList},
+		{r: 'x', action: view.ActionHexMode},
+		{r: 'w', action: view.ActionWrap},
+		{r: '&', action: view.ActionFilter},
+		{r: '*', action: view.ActionRemoveFilter},
+		{r: 'H', action: view.ActionMarker},
+		{r: 'K', action: view.ActionClearMarkers},
+		{r: 'L', action: view.ActionSearchResults},
+		{r: 'm', action: view.ActionSetMark},
+		{r: '\'', action: view.ActionGotoMark},
+		{r: 'M', action: view.ActionMarkList},
+		{key: tcell.KeyCtrlO, action: view.ActionJumpBack},
+		{key: tcell.KeyTab, action: view.ActionJumpForward},
+		{r: 'J', action: view.ActionJumpList},
+		{r: 't', action: view.ActionTableMode},
+		{r: '>', action: view.ActionNextColumn},
+		{r: '<', action: view.ActionPreviousColumn},
+		{r: 'T', action: view.ActionTableColumns},
+		{r: 'z', action: view.ActionFreezeLines},
+		{r: 'Z', action: view.ActionFreezeColumns},
+		{r: ',', action: view.ActionCursorLeft},
+		{r: '.', action: view.ActionCursorRight},
+		{r: 'V', action: view.ActionRecordFields},
 
 		{r: 'q', action: view.ActionQuit},
-		{key: tcell.KeyEscape, action: view.ActionQuit},
+		{key: tcell.KeyEscape, action: view.ActionCancel},
 
 		{key: tcell.KeyF1, action: view.ActionShortcuts},
 		{r: 'h', action: view.ActionShortcuts},
@@ -1,6 +1,7 @@
 package tv
 
 import (
+	"fmt"
 	"github.com/bry00/m/view"
 	"github.com/gdamore/tcell"
 	"github.com/rivo/tview"
@@ -14,6 +15,13 @@ const pageMain = "main"
 const pageSearch = "search"
 const pageGoToLine = "goto-line"
 const pageShortcuts = "shortcuts"
+const pageDocuments = "documents"
+const pageFilter = "filter"
+const pageSearchResults = "search-results"
+const pageHistory = "history"
+const pageMarks = "marks"
+const pageColumns = "columns"
+const pageRecord = "record"
 
 type View struct {
 	app            *tview.Application
@@ -24,6 +32,14 @@ type View struct {
 	searchDialog   *SearchDialog
 	lineDialog     *LineDialog
 	shortcutWindow *ShortcutsWindow
+	documentList   *DocumentList
+	filterDialog   *FilterDialog
+
+	searchResultsList *SearchResultsList
+	historyList       *HistoryList
+	markList          *MarkList
+	columnList        *ColumnList
+	recordList        *RecordList
 }
 
 func (view *View) ShowSearchResult(lineIndex int, start int, end int) {
@@ -92,6 +108,25 @@ func (v *View) StopApplication() {
 func (v *View) DisplayAt(left int, top int) {
 	v.text.firstLine = top
 	v.text.firstColumn = left
+	v.text.firstRow = 0
+}
+
+func (v *View) DisplayAtRow(top int, row int) {
+	v.text.firstLine = top
+	v.text.firstRow = row
+	v.text.firstColumn = 0
+}
+
+func (v *View) GetTopRow() int {
+	return v.text.firstRow
+}
+
+func (v *View) IsWrapped() bool {
+	return v.text.wrap
+}
+
+func (v *View) SetWrapped(wrap bool) {
+	v.text.wrap = wrap
 }
 
 func (v *View) GetDisplayRect() (int, int, int, int) {
@@ -102,6 +137,10 @@ func (v *View) Refresh() {
 	v.app.Draw()
 }
 
+func (v *View) QueueUpdateDraw(f func()) {
+	v.app.QueueUpdateDraw(f)
+}
+
 func (v *View) newModal(modal tview.Primitive, width int, height int) tview.Primitive {
 	return tview.NewGrid().
 		SetColumns(0, width, 0).
@@ -146,8 +185,7 @@ func (v *View) Prepare() {
 	v.text.SetTitleColor(tview.Styles.TitleColor)
 	v.text.SetBackgroundColor(tview.Styles.PrimitiveBackgroundColor)
 
-	v.text.SetBorder(true).
-		SetTitle(" " + v.ctl.GetFileNameTitle() + " ")
+	v.text.SetBorder(true)
 	v.statusBar = newStatusBar(v)
 
 	v.app = tview.NewApplication()
@@ -168,7 +206,14 @@ func (v *View) Prepare() {
 	v.pages.AddPage(pageMain, pgMain, true, true).
 		AddPage(pageSearch, v.newModal(newSearchDialog(v, screenWidth)), true, false).
 		AddPage(pageGoToLine, v.newModal(newLineDialog(v)), true, false).
-		AddPage(pageShortcuts, v.newModal(newShortcutsWindow(v.GetKeyShortcuts(), v, screenWidth, screenHeight)), true, false)
+		AddPage(pageShortcuts, v.newModal(newShortcutsWindow(v.GetKeyShortcuts(), v, screenWidth, screenHeight)), true, false).
+		AddPage(pageDocuments, v.newModal(newDocumentList(v, screenWidth, screenHeight)), true, false).
+		AddPage(pageFilter, v.newModal(newFilterDialog(v, screenWidth)), true, false).
+		AddPage(pageSearchResults, v.newModal(newSearchResultsList(v, screenWidth, screenHeight)), true, false).
+		AddPage(pageHistory, v.newModal(newHistoryList(v, screenWidth, screenHeight)), true, false).
+		AddPage(pageMarks, v.newModal(newMarkList(v, screenWidth, screenHeight)), true, false).
+		AddPage(pageColumns, v.newModal(newColumnList(v, screenWidth, screenHeight)), true, false).
+		AddPage(pageRecord, v.newModal(newRecordList(v, screenWidth, screenHeight)), true, false)
 
 	v.app.EnableMouse(true)
 }
@@ -186,3 +231,70 @@ func (view *View) GetKeyShortcuts() map[view.Action][]string {
 func (view *View) ShowShortcuts() {
 	view.pages.ShowPage(pageShortcuts)
 }
+
+func (view *View) ShowDocumentList() {
+	if view.documentList != nil {
+		view.documentList.Display()
+	}
+}
+
+func (view *View) ShowFilterDialog() {
+	if view.filterDialog != nil {
+		view.filterDialog.Display()
+	}
+}
+
+func (view *View) ShowSearchResults() {
+	if view.searchResultsList != nil {
+		view.searchResultsList.Display()
+	}
+}
+
+func (view *View) ClearSearchResults() {
+	if view.searchResultsList != nil {
+		view.searchResultsList.Reset()
+	}
+}
+
+func (view *View) AddSearchResults(results []view.SearchResult, found int, complete bool) {
+	if view.searchResultsList != nil {
+		view.searchResultsList.Add(results, found, complete)
+	}
+}
+
+func (view *View) ShowJumpList() {
+	jumps := view.ctl.GetJumps()
+	if len(jumps) == 0 {
+		view.GetStatusBar().Message("The jump list is empty")
+		return
+	}
+	entries := make([]string, len(jumps))
+	current := 0
+	for i, j := range jumps {
+		prefix := "  "
+		if j.Current {
+			prefix = "> "
+			current = i
+		}
+		entries[i] = fmt.Sprintf("%s%7d: %s", prefix, j.LineNo, j.Text)
+	}
+	view.historyList.Display("Jumps", entries, current, view.text, view.ctl.GotoJump)
+}
+
+func (view *View) ShowMarkList() {
+	if view.markList != nil {
+		view.markList.Display()
+	}
+}
+
+func (view *View) ShowColumnList() {
+	if view.columnList != nil {
+		view.columnList.Display()
+	}
+}
+
+func (view *View) ShowRecordFields() {
+	if view.recordList != nil {
+		view.recordList.Display()
+	}
+}
@@ -23,3 +23,30 @@ func TestNumberString(t *testing.T) {
 		}
 	}
 }
+
+func TestHistoryRecall(t *testing.T) {
+	values := []struct {
+		Older    bool
+		Position int
+		Moved    bool
+	}{
+		{false, -1, false},
+		{true, 0, true},
+		{true, 1, true},
+		{true, 1, false},
+		{false, 0, true},
+		{false, -1, true},
+		{false, -1, false},
+	}
+	var r historyRecall
+	r.reset()
+	for i, v := range values {
+		position, moved := r.move(v.Older, 2, "typed")
+		if position != v.Position || moved != v.Moved {
+			t.Errorf("#%d move(%v) => %d, %v; want %d, %v", i, v.Older, position, moved, v.Position, v.Moved)
+		}
+	}
+	if r.draft != "typed" {
+		t.Errorf("draft => \"%s\"; want \"%s\"", r.draft, "typed")
+	}
+}
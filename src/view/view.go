@@ -3,6 +3,8 @@ package view
 import (
 	"github.com/bry00/m/buffers"
 	"github.com/bry00/m/config"
+	"github.com/bry00/m/markup"
+	"github.com/mattn/go-runewidth"
 )
 
 type Action int
@@ -33,8 +35,36 @@ const (
 	ActionMoveRulerDown
 	ActionReset
 	ActionShortcuts
+	ActionFollow
+	ActionReload
+	ActionNextFile
+	ActionPreviousFile
+	ActionFileList
+	ActionHexMode
+	ActionWrap
+	ActionFilter
+	ActionRemoveFilter
+	ActionMarker
+	ActionClearMarkers
+	ActionCancel
+	ActionSearchResults
+	ActionSetMark
+	ActionGotoMark
+	ActionMarkList
+	ActionJumpBack
+	ActionJumpForward
+	ActionJumpList
+	ActionTableMode
+	ActionNextColumn
+	ActionPreviousColumn
+	ActionTableColumns
+	ActionFreezeLines
+	ActionFreezeColumns
+	ActionCursorLeft
+	ActionCursorRight
+	ActionRecordFields
 )
-const lastAction = int(ActionShortcuts)
+const lastAction = int(ActionRecordFields)
 
 var actionNames = []string{
 	"unknown",
@@ -62,6 +92,34 @@ var actionNames = []string{
 	"move ruler down",
 	"reset",
 	"show shortcuts",
+	"follow",
+	"reload",
+	"next file",
+	"previous file",
+	"list of files",
+	"hex mode",
+	"wrap lines",
+	"filter lines",
+	"remove last filter",
+	"highlight search term",
+	"remove highlights",
+	"cancel search or quit",
+	"list search results",
+	"set mark",
+	"go to mark",
+	"list marks",
+	"jump back",
+	"jump forward",
+	"list jumps",
+	"table mode",
+	"next column",
+	"previous column",
+	"choose columns",
+	"freeze lines",
+	"freeze columns",
+	"move column cursor left",
+	"move column cursor right",
+	"show record fields",
 }
 
 func (action Action) Count() int {
@@ -83,6 +141,7 @@ const (
 	StatusReady
 	StatusReading
 	StatusReceivingData
+	StatusFollowing
 )
 
 func (status AppStatus) String() string {
@@ -91,6 +150,7 @@ func (status AppStatus) String() string {
 		"ready",
 		"reading",
 		"receiving",
+		"following",
 	}
 	a := int(status)
 	if a < 0 || a >= len(names) {
@@ -105,6 +165,7 @@ func (status AppStatus) Display() string {
 		"READY",
 		"Reading...",
 		"Receiving...",
+		"FOLLOWING",
 	}
 	a := int(status)
 	if a < 0 || a >= len(names) {
@@ -118,10 +179,45 @@ type TheViewController interface {
 	NoOfLines() int
 	GetConfig() *config.Config
 	GetFileNameTitle() string
-	GetDataIterator(firstRow int) (*buffers.LineIndex, bool)
+	GetInputInfo() string
+	ParseLine(line string) (string, []markup.Span)
+	GetDataIterator(firstRow int) (buffers.LineIterator, bool)
 	DataReady() bool
 	SetSearchText(text string, regex bool, ignoreCase bool)
+	SetSearchOptions(wholeWord bool, smartCase bool, wrapAround bool)
 	SetPointedLine(lineNo int)
+	IsLineChanged(lineIndex int) bool
+	GetDocumentIndex() (int, int)
+	GetDocumentTitles() []string
+	SwitchDocument(index int)
+	AddFilter(pattern string, exclude bool) error
+	ClearFilters()
+	GetSourceLine(lineIndex int) int
+	GetHighlights(line string) []markup.Span
+	GotoSearchResult(index int)
+	BeginIncrementalSearch()
+	IncrementalSearch(text string, regex bool, ignoreCase bool, done func(found bool))
+	EndIncrementalSearch(cancel bool)
+	GetSearchHistory() []SearchHistoryEntry
+	AddSearchHistory(text string, regex bool, ignoreCase bool)
+	GetGotoHistory() []int
+	AddGotoHistory(lineNo int)
+	SetMark(name rune)
+	GotoMark(name rune)
+	DeleteMark(name rune)
+	GetMarks() []Mark
+	GetLineMark(lineIndex int) rune
+	GetJumps() []Jump
+	GotoJump(index int)
+	GetTableHeader() (string, []markup.Span)
+	GetTableColumns() []TableColumn
+	SetTableColumns(columns []int)
+	GetFrozenLines() []FrozenLine
+	GetFrozenColumns() int
+	GetLayoutFields() []LayoutField
+	GetColumnCursor() int
+	SetColumnCursor(column int)
+	GetRecordFields() (int, []RecordField)
 }
 
 type TheStatusBar interface {
@@ -132,25 +228,136 @@ type TheStatusBar interface {
 	SafeStatus(status AppStatus)
 }
 
+// SearchResult is a line with an occurrence of the search string, listed in the search results panel.
+type SearchResult struct {
+	LineNo int    // the number of the line in the whole data
+	Text   string // the visible text of the line, with tabs expanded
+	Start  int    // byte offset of the start of the occurrence in the text
+	End    int    // byte offset of the end of the occurrence in the text
+}
+
+// SearchHistoryEntry is a search string entered in the search dialog recently, with its options.
+type SearchHistoryEntry struct {
+	Text       string
+	Regex      bool
+	IgnoreCase bool
+}
+
+// Mark is a line marked with a letter, to go back to it.
+type Mark struct {
+	Name   rune   // the letter of the mark
+	LineNo int    // the number of the line in the whole data
+	Text   string // the visible text of the line
+}
+
+// Jump is a position of the view in the jump list.
+type Jump struct {
+	LineNo  int    // the number of the top line in the whole data
+	Text    string // the visible text of the top line
+	Current bool   // whether it is the position gone back to
+}
+
+// TableColumn is a column of the table, in the table mode.
+type TableColumn struct {
+	Index int    // the index of the column in the line
+	Name  string // the name of the column from the header row, or its number
+	Shown bool   // whether the column is shown
+}
+
+// FrozenLine is a line frozen at the top of the view.
+type FrozenLine struct {
+	Text      string // the line, as read
+	LineNo    int    // the number of the line in the whole data
+	LineIndex int    // the index of the line shown, or -1 when the line is filtered out
+}
+
+// LayoutField is a field of the record layout of fixed-width lines.
+type LayoutField struct {
+	Name   string
+	Start  int // the first column of the field, counted from 0
+	Length int // the number of columns of the field
+	Type   string
+}
+
+// RecordField is a field of the layout with its value in a line.
+type RecordField struct {
+	LayoutField
+	Value string
+	Valid bool // whether the value is of the type of the field
+}
+
 type TheView interface {
+	AddSearchResults(results []SearchResult, found int, complete bool)
 	AreNumbersShown() bool
+	ClearSearchResults()
 	DisplayAt(left int, top int)
+	DisplayAtRow(top int, row int)
 	GetDisplayRect() (int, int, int, int)
 	GetKeyShortcuts() map[Action][]string
 	GetRulerPosition() int
 	GetStatusBar() TheStatusBar
+	GetTopRow() int
 	IsRulerShown() bool
+	IsWrapped() bool
 	Prepare()
+	QueueUpdateDraw(f func())
 	Refresh()
 	SetController(ctl TheViewController)
 	SetRulerPosition(index int)
+	SetWrapped(wrap bool)
 	Show()
+	ShowDocumentList()
+	ShowFilterDialog()
 	ShowGotoLineDialog()
 	ShowLine(lineIndex int)
 	ShowNumbers(show bool)
 	ShowRuler(show bool)
 	ShowSearchDialog()
 	ShowSearchResult(lineIndex int, start int, end int)
+	ShowSearchResults()
+	ShowMarkList()
+	ShowJumpList()
+	ShowColumnList()
+	ShowRecordFields()
 	ShowShortcuts()
 	StopApplication()
 }
+
+// CellWidth returns the number of screen columns taken by the character.
+func CellWidth(r rune) int {
+	if width := runewidth.RuneWidth(r); width > 0 {
+		return width
+	}
+	return 1
+}
+
+// WrapRows returns indexes of the characters starting consecutive rows of a line (with tabs expanded)
+// wrapped at the given width. There is always at least one row.
+func WrapRows(line []rune, width int) []int {
+	result := []int{0}
+	x := 0
+	for i, r := range line {
+		w := CellWidth(r)
+		if x+w > width && x > 0 {
+			result = append(result, i)
+			x = 0
+		}
+		x += w
+	}
+	return result
+}
+
+// FieldAt returns the index of the field (sorted by their starts) covering the column; -1 if there is none.
+// The field starting last wins, when fields overlap.
+func FieldAt(fields []LayoutField, column int) int {
+	result := -1
+	for i, f := range fields {
+		if f.Start > column {
+			break
+		}
+		if column < f.Start+f.Length {
+			result = i
+		}
+	}
+	return result
+}
@@ -1,6 +1,9 @@
 package view
 
-import "testing"
+import (
+	"reflect"
+	"testing"
+)
 
 func TestActionsNamesDefinition(t *testing.T) {
 	expected := lastAction + 1
@@ -49,7 +52,8 @@ func TestAppStatusString(t *testing.T) {
 		{1, "ready"},
 		{2, "reading"},
 		{3, "receiving"},
-		{4, "unknown"},
+		{4, "following"},
+		{5, "unknown"},
 	}
 	for _, v := range values {
 		got := AppStatus(v.AppStatusInt).String()
@@ -70,7 +74,8 @@ func TestAppStatusDisplay(t *testing.T) {
 		{1, "READY"},
 		{2, "Reading..."},
 		{3, "Receiving..."},
-		{4, ""},
+		{4, "FOLLOWING"},
+		{5, ""},
 	}
 	for _, v := range values {
 		got := AppStatus(v.AppStatusInt).Display()
@@ -80,3 +85,54 @@ func TestAppStatusDisplay(t *testing.T) {
 		}
 	}
 }
+
+func TestWrapRows(t *testing.T) {
+	values := []struct {
+		Line     string
+		Width    int
+		Expected []int
+	}{
+		{"", 10, []int{0}},
+		{"Litwo!", 6, []int{0}},
+		{"Litwo! Ojczyzno", 6, []int{0, 6, 12}},
+		{"Litwo!", 0, []int{0, 1, 2, 3, 4, 5}},
+		{"Ojczyzno 日本語", 10, []int{0, 9}},
+		{"Ojczyzno日本語", 9, []int{0, 8}},
+		{"Ojczyzno日本語", 4, []int{0, 4, 8, 10}},
+	}
+	for _, v := range values {
+		got := WrapRows([]rune(v.Line), v.Width)
+		if !reflect.DeepEqual(got, v.Expected) {
+			t.Errorf("WrapRows(\"%s\", %d) => %v; want %v", v.Line, v.Width, got, v.Expected)
+		}
+	}
+}
+
+func TestFieldAt(t *testing.T) {
+	fields := []LayoutField{
+		{Name: "ID", Start: 0, Length: 4},
+		{Name: "NAME", Start: 4, Length: 10},
+		{Name: "FIRST", Start: 4, Length: 5},
+		{Name: "AMOUNT", Start: 20, Length: 8},
+	}
+	values := []struct {
+		Column int
+		Field  int
+	}{
+		{0, 0},
+		{3, 0},
+		{4, 2},
+		{8, 2},
+		{9, 1},
+		{13, 1},
+		{14, -1},
+		{20, 3},
+		{27, 3},
+		{28, -1},
+	}
+	for _, v := range values {
+		if got := FieldAt(fields, v.Column); got != v.Field {
+			t.Errorf("FieldAt(%d) => %d; want %d", v.Column, got, v.Field)
+		}
+	}
+}